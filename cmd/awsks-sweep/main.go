@@ -0,0 +1,45 @@
+// Command awsks-sweep removes AWS resources left behind by failed or
+// abandoned awsks environments.
+//
+// Usage:
+//
+//	awsks-sweep --name ks-basic-flow --region eu-central-1 --dry-run
+//
+// Credentials are taken from AWS_ACCESS_KEY and AWS_SECRET_KEY environment
+// variables (as in the rest of this repository) or from default AWS
+// credentials chain when those are not set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/sweeper"
+)
+
+func main() {
+	name := flag.String("name", "", "module name (M_NAME) of environment to remove")
+	region := flag.String("region", "eu-central-1", "AWS region of environment")
+	dryRun := flag.Bool("dry-run", false, "only print resources which would be removed")
+	workers := flag.Int("workers", 4, "maximal number of resources removed concurrently")
+	flag.Parse()
+
+	s, err := sweeper.New(sweeper.Config{
+		ModuleName: *name,
+		Region:     *region,
+		AccessKey:  os.Getenv("AWS_ACCESS_KEY"),
+		SecretKey:  os.Getenv("AWS_SECRET_KEY"),
+		Workers:    *workers,
+		Logger:     sweeper.WriterLogger(os.Stdout),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "awsks-sweep: %s\n", err)
+		os.Exit(2)
+	}
+
+	if err := s.Sweep(*dryRun); err != nil {
+		fmt.Fprintf(os.Stderr, "awsks-sweep: %s\n", err)
+		os.Exit(1)
+	}
+}
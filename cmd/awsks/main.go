@@ -0,0 +1,60 @@
+// Command awsks is the entrypoint of the AWS Kubernetes Service module image.
+//
+// Usage:
+//
+//	awsks [M_NAME=value | --M_NAME=value ...] command [command ...]
+//
+// Module parameters are read from M_* environment variables and can be
+// overridden by arguments. Commands are run in order, metadata is printed
+// when no command is given.
+//
+// Exit status is 2 for invalid usage, 3 when audit detected drift, 4 when
+// preflight checks failed and 1 for other failures.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/audit"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/preflight"
+)
+
+func main() {
+	for _, arg := range os.Args[1:] {
+		if arg == "-h" || arg == "--help" || arg == "help" {
+			fmt.Print(awsks.Usage())
+			return
+		}
+	}
+
+	vars, commands, err := awsks.ParseArgs(os.Args[1:], os.Environ())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "awsks: %s\n\n%s", err, awsks.Usage())
+		os.Exit(2)
+	}
+	if len(commands) == 0 {
+		commands = []string{awsks.DefaultCommand}
+	}
+	for _, c := range commands {
+		if !awsks.IsCommand(c) {
+			fmt.Fprintf(os.Stderr, "awsks: unknown command: %s\n\n%s", c, awsks.Usage())
+			os.Exit(2)
+		}
+	}
+
+	if err := awsks.New(vars).Run(commands...); err != nil {
+		fmt.Fprintf(os.Stderr, "awsks: %s\n", err)
+		var driftErr *audit.DriftError
+		if errors.As(err, &driftErr) {
+			os.Exit(3)
+		}
+		var preflightErr *preflight.FailedError
+		if errors.As(err, &preflightErr) {
+			os.Exit(4)
+		}
+		os.Exit(1)
+	}
+}
@@ -6,5 +6,7 @@ require (
 	github.com/aws/aws-sdk-go v1.27.1
 	github.com/go-test/deep v1.0.7
 	github.com/gruntwork-io/terratest v0.30.8
+	github.com/santhosh-tekuri/jsonschema/v5 v5.0.0
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,502 @@
+// Package audit compares resources recorded in the awsks section of state
+// file and in terraform state with resources which really exist in AWS and
+// in the cluster.
+//
+// Every compared property is a Check. Missing resources are reported as
+// drift, other AWS errors stop the audit.
+package audit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfstate"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/upgrade"
+)
+
+const (
+	present = "present"
+	missing = "missing"
+)
+
+// Check is a single compared property of a resource.
+type Check struct {
+	Resource string `json:"resource"`
+	Property string `json:"property"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Drift    bool   `json:"drift"`
+}
+
+// Report lists all checks in order they were made.
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Drifted returns checks which found drift.
+func (r *Report) Drifted() []Check {
+	var result []Check
+	for _, c := range r.Checks {
+		if c.Drift {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Err returns *DriftError when any check found drift.
+func (r *Report) Err() error {
+	if drifted := len(r.Drifted()); drifted > 0 {
+		return &DriftError{Drifted: drifted, Total: len(r.Checks)}
+	}
+	return nil
+}
+
+// WriteTable prints checks as a table.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tPROPERTY\tEXPECTED\tACTUAL\tDRIFT")
+	for _, c := range r.Checks {
+		drift := "no"
+		if c.Drift {
+			drift = "YES"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Resource, c.Property, orDash(c.Expected), orDash(c.Actual), drift)
+	}
+	return tw.Flush()
+}
+
+// DriftError is returned when remote resources differ from state.
+type DriftError struct {
+	Drifted int
+	Total   int
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("drift detected in %d of %d checks", e.Drifted, e.Total)
+}
+
+// Auditor checks AWS resources and autoscaler release of a single cluster.
+type Auditor struct {
+	eks    awsapi.EKSAPI
+	addons awsapi.EKSAddonsAPI
+	iam    awsapi.IAMAPI
+	logs   awsapi.CloudWatchLogsAPI
+	helm   Helm
+
+	report *Report
+}
+
+// New creates Auditor using provided AWS clients and helm.
+func New(clients awsapi.Clients, helm Helm) *Auditor {
+	return &Auditor{
+		eks:    clients.EKS,
+		addons: clients.EKSAddons,
+		iam:    clients.IAM,
+		logs:   clients.CloudWatchLogs,
+		helm:   helm,
+	}
+}
+
+// requiredResources are resource types which have to be present in
+// terraform state of applied module. Autoscaler release is not deployed in
+// clusters without worker groups.
+func requiredResources(st *state.AWSKS) []string {
+	types := []string{
+		"aws_eks_cluster",
+		"aws_iam_openid_connect_provider",
+		"aws_cloudwatch_log_group",
+	}
+	if st.HasAutoscaler() {
+		types = append(types, "helm_release")
+	}
+	return types
+}
+
+// Audit compares awsks section of state file and terraform state with remote
+// resources. Drift is reported in returned Report, error is returned only
+// when audit could not be completed.
+func (a *Auditor) Audit(st *state.AWSKS, tf *tfstate.State) (*Report, error) {
+	for _, t := range requiredResources(st) {
+		if tf.Instance(t) == nil {
+			return nil, fmt.Errorf("terraform state has no %s resource, run apply first", t)
+		}
+	}
+
+	a.report = &Report{}
+	cluster, err := a.checkCluster(st, tf)
+	if err != nil {
+		return nil, err
+	}
+	if cluster != nil {
+		if err := a.checkNodegroups(st, tf); err != nil {
+			return nil, err
+		}
+		if err := a.checkFargateProfiles(st); err != nil {
+			return nil, err
+		}
+		if err := a.checkAddons(st.Name, tf); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.checkRoles(st); err != nil {
+		return nil, err
+	}
+	if err := a.checkOpenIDConnectProvider(tf, cluster); err != nil {
+		return nil, err
+	}
+	if err := a.checkLogGroup(tf); err != nil {
+		return nil, err
+	}
+	if st.HasAutoscaler() {
+		if err := a.checkRelease(st, tf); err != nil {
+			return nil, err
+		}
+	}
+	return a.report, nil
+}
+
+func (a *Auditor) compare(resource, property, expected, actual string) {
+	a.report.Checks = append(a.report.Checks, Check{
+		Resource: resource,
+		Property: property,
+		Expected: expected,
+		Actual:   actual,
+		Drift:    expected != actual,
+	})
+}
+
+// pendingUpgrade returns finished upgrade which terraform state does not
+// know about yet. Upgrade changes versions outside of terraform, so until
+// the next apply expected versions are taken from its steps.
+func pendingUpgrade(st *state.AWSKS, tf *tfstate.State) *state.Upgrade {
+	u := st.Upgrade
+	if u == nil || !u.Finished() || config.CompareVersions(tf.Instance("aws_eks_cluster").String("version"), u.To) >= 0 {
+		return nil
+	}
+	return u
+}
+
+// upgradedVersion returns version set by the last step of action in
+// pending upgrade, or empty string.
+func upgradedVersion(st *state.AWSKS, tf *tfstate.State, action string) string {
+	u := pendingUpgrade(st, tf)
+	if u == nil {
+		return ""
+	}
+	version := ""
+	for _, s := range u.Steps {
+		if s.Action == action {
+			version = s.Version
+		}
+	}
+	return version
+}
+
+func (a *Auditor) checkCluster(st *state.AWSKS, tf *tfstate.State) (*eks.Cluster, error) {
+	resource := "eks cluster/" + st.Name
+	out, err := a.eks.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(st.Name)})
+	if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+		a.compare(resource, "exists", present, missing)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe cluster %s: %w", st.Name, err)
+	}
+
+	a.compare(resource, "exists", present, present)
+	a.compare(resource, "status", eks.ClusterStatusActive, aws.StringValue(out.Cluster.Status))
+	version := tf.Instance("aws_eks_cluster").String("version")
+	if v := upgradedVersion(st, tf, upgrade.ActionControlPlane); v != "" {
+		version = v
+	}
+	a.compare(resource, "version", version, aws.StringValue(out.Cluster.Version))
+	return out.Cluster, nil
+}
+
+func (a *Auditor) checkNodegroups(st *state.AWSKS, tf *tfstate.State) error {
+	expected := make(map[string]bool)
+	for _, wg := range st.WorkerGroups {
+		expected[wg.Name] = true
+		resource := "eks nodegroup/" + wg.Name
+		out, err := a.eks.DescribeNodegroup(&eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(st.Name),
+			NodegroupName: aws.String(wg.Name),
+		})
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			a.compare(resource, "exists", present, missing)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot describe node group %s: %w", wg.Name, err)
+		}
+		ng := out.Nodegroup
+
+		// Terraform state holds scaling applied to AWS, state file holds
+		// configuration, so limits are taken from terraform state when
+		// possible.
+		minSize, maxSize := fmt.Sprint(wg.AsgMinSize), fmt.Sprint(wg.AsgMaxSize)
+		if i := nodegroupInstance(tf, wg.Name); i != nil {
+			minSize, maxSize = i.String("scaling_config.0.min_size"), i.String("scaling_config.0.max_size")
+		}
+
+		a.compare(resource, "exists", present, present)
+		a.compare(resource, "status", eks.NodegroupStatusActive, aws.StringValue(ng.Status))
+		a.compare(resource, "instance_types", strings.Join(wg.AllInstanceTypes(), ","), strings.Join(aws.StringValueSlice(ng.InstanceTypes), ","))
+		if ng.ScalingConfig == nil {
+			a.compare(resource, "scaling_config", present, missing)
+			continue
+		}
+		a.compare(resource, "min_size", minSize, fmt.Sprint(aws.Int64Value(ng.ScalingConfig.MinSize)))
+		a.compare(resource, "max_size", maxSize, fmt.Sprint(aws.Int64Value(ng.ScalingConfig.MaxSize)))
+		// Desired size is changed by the autoscaler, so it only has to stay
+		// within limits.
+		desired := aws.Int64Value(ng.ScalingConfig.DesiredSize)
+		limits := fmt.Sprintf("%d..%d", aws.Int64Value(ng.ScalingConfig.MinSize), aws.Int64Value(ng.ScalingConfig.MaxSize))
+		actual := limits
+		if desired < aws.Int64Value(ng.ScalingConfig.MinSize) || desired > aws.Int64Value(ng.ScalingConfig.MaxSize) {
+			actual = fmt.Sprint(desired)
+		}
+		a.compare(resource, "desired_size", limits, actual)
+	}
+
+	var extra []string
+	err := a.eks.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: aws.String(st.Name)},
+		func(page *eks.ListNodegroupsOutput, lastPage bool) bool {
+			for _, name := range aws.StringValueSlice(page.Nodegroups) {
+				if !expected[name] {
+					extra = append(extra, name)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return fmt.Errorf("cannot list node groups of cluster %s: %w", st.Name, err)
+	}
+	for _, name := range extra {
+		a.compare("eks nodegroup/"+name, "exists", missing, present)
+	}
+	return nil
+}
+
+func nodegroupInstance(tf *tfstate.State, name string) *tfstate.Instance {
+	for _, i := range tf.Instances("aws_eks_node_group") {
+		if i.String("node_group_name") == name {
+			i := i
+			return &i
+		}
+	}
+	return nil
+}
+
+// checkAddons checks managed add-ons recorded in terraform state. Versions
+// are taken from terraform state, where defaults of k8s_version are already
+// resolved.
+func (a *Auditor) checkAddons(clusterName string, tf *tfstate.State) error {
+	for _, i := range tf.Instances("aws_eks_addon") {
+		name := i.String("addon_name")
+		resource := "eks addon/" + name
+		out, err := a.addons.DescribeAddon(&awsapi.DescribeAddonInput{
+			ClusterName: aws.String(clusterName),
+			AddonName:   aws.String(name),
+		})
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			a.compare(resource, "exists", present, missing)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot describe add-on %s: %w", name, err)
+		}
+
+		a.compare(resource, "exists", present, present)
+		a.compare(resource, "status", awsapi.AddonStatusActive, aws.StringValue(out.Addon.Status))
+		a.compare(resource, "version", i.String("addon_version"), aws.StringValue(out.Addon.AddonVersion))
+	}
+	return nil
+}
+
+// checkFargateProfiles checks configured Fargate profiles and reports
+// profiles created outside of terraform.
+func (a *Auditor) checkFargateProfiles(st *state.AWSKS) error {
+	expected := make(map[string]bool)
+	for _, fp := range st.FargateProfiles {
+		expected[fp.Name] = true
+		resource := "eks fargate profile/" + fp.Name
+		out, err := a.eks.DescribeFargateProfile(&eks.DescribeFargateProfileInput{
+			ClusterName:        aws.String(st.Name),
+			FargateProfileName: aws.String(fp.Name),
+		})
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			a.compare(resource, "exists", present, missing)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot describe Fargate profile %s: %w", fp.Name, err)
+		}
+
+		var namespaces, actual []string
+		for _, s := range fp.Selectors {
+			namespaces = append(namespaces, s.Namespace)
+		}
+		for _, s := range out.FargateProfile.Selectors {
+			actual = append(actual, aws.StringValue(s.Namespace))
+		}
+		a.compare(resource, "exists", present, present)
+		a.compare(resource, "status", eks.FargateProfileStatusActive, aws.StringValue(out.FargateProfile.Status))
+		a.compare(resource, "namespaces", strings.Join(namespaces, ","), strings.Join(actual, ","))
+	}
+
+	var extra []string
+	err := a.eks.ListFargateProfilesPages(&eks.ListFargateProfilesInput{ClusterName: aws.String(st.Name)},
+		func(page *eks.ListFargateProfilesOutput, lastPage bool) bool {
+			for _, name := range aws.StringValueSlice(page.FargateProfileNames) {
+				if !expected[name] {
+					extra = append(extra, name)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return fmt.Errorf("cannot list Fargate profiles of cluster %s: %w", st.Name, err)
+	}
+	for _, name := range extra {
+		a.compare("eks fargate profile/"+name, "exists", missing, present)
+	}
+	return nil
+}
+
+// checkRoles checks IAM roles created by terraform modules together with
+// their attached managed policies.
+func (a *Auditor) checkRoles(st *state.AWSKS) error {
+	type role struct {
+		name     string
+		policies []string
+	}
+	name := st.Name
+	roles := []role{
+		{name + "-eks-cluster-iam-role", []string{"AmazonEKSClusterPolicy", "AmazonEKSVPCResourceController"}},
+		{name + "-eks-nodes-iam-role", []string{"AmazonEC2ContainerRegistryReadOnly", "AmazonEKSWorkerNodePolicy", "AmazonEKS_CNI_Policy"}},
+	}
+	if len(st.FargateProfiles) > 0 {
+		roles = append(roles, role{name + "-eks-fargate-iam-role", []string{"AmazonEKSFargatePodExecutionRolePolicy"}})
+	}
+	if st.HasAutoscaler() {
+		roles = append(roles, role{name + "-cluster-autoscaler", []string{name + "-cluster-autoscaler"}})
+	}
+	for _, role := range roles {
+		resource := "iam role/" + role.name
+		_, err := a.iam.GetRole(&iam.GetRoleInput{RoleName: aws.String(role.name)})
+		if awsapi.IsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			a.compare(resource, "exists", present, missing)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot get role %s: %w", role.name, err)
+		}
+		out, err := a.iam.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(role.name)})
+		if err != nil {
+			return fmt.Errorf("cannot list policies of role %s: %w", role.name, err)
+		}
+		var attached []string
+		for _, p := range out.AttachedPolicies {
+			arn := aws.StringValue(p.PolicyArn)
+			attached = append(attached, arn[strings.LastIndex(arn, "/")+1:])
+		}
+		sort.Strings(attached)
+
+		a.compare(resource, "exists", present, present)
+		a.compare(resource, "attached_policies", strings.Join(role.policies, ","), strings.Join(attached, ","))
+	}
+	return nil
+}
+
+// checkOpenIDConnectProvider checks provider created for cluster issuer.
+// Issuer url is compared only when cluster exists.
+func (a *Auditor) checkOpenIDConnectProvider(tf *tfstate.State, cluster *eks.Cluster) error {
+	arn := tf.Instance("aws_iam_openid_connect_provider").String("arn")
+	resource := "iam oidc provider/" + arn[strings.LastIndex(arn, "/")+1:]
+	out, err := a.iam.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: aws.String(arn)})
+	if awsapi.IsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		a.compare(resource, "exists", present, missing)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot get OpenID Connect provider %s: %w", arn, err)
+	}
+
+	a.compare(resource, "exists", present, present)
+	if cluster != nil && cluster.Identity != nil && cluster.Identity.Oidc != nil {
+		issuer := strings.TrimPrefix(aws.StringValue(cluster.Identity.Oidc.Issuer), "https://")
+		a.compare(resource, "url", issuer, strings.TrimPrefix(aws.StringValue(out.Url), "https://"))
+	}
+	return nil
+}
+
+func (a *Auditor) checkLogGroup(tf *tfstate.State) error {
+	i := tf.Instance("aws_cloudwatch_log_group")
+	name := i.String("name")
+	resource := "log group/" + name
+	out, err := a.logs.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("cannot describe log group %s: %w", name, err)
+	}
+	for _, lg := range out.LogGroups {
+		if aws.StringValue(lg.LogGroupName) == name {
+			a.compare(resource, "exists", present, present)
+			a.compare(resource, "retention_in_days", i.String("retention_in_days"), fmt.Sprint(aws.Int64Value(lg.RetentionInDays)))
+			return nil
+		}
+	}
+	a.compare(resource, "exists", present, missing)
+	return nil
+}
+
+func (a *Auditor) checkRelease(st *state.AWSKS, tf *tfstate.State) error {
+	i := tf.Instance("helm_release")
+	name, namespace := i.String("name"), i.String("namespace")
+	resource := "helm release/" + namespace + "/" + name
+	release, err := a.helm.Release(st.Output.Kubeconfig, name, namespace)
+	if err != nil {
+		return fmt.Errorf("cannot get helm release %s: %w", name, err)
+	}
+	if release == nil {
+		a.compare(resource, "exists", present, missing)
+		return nil
+	}
+
+	a.compare(resource, "exists", present, present)
+	a.compare(resource, "status", "deployed", release.Status)
+	a.compare(resource, "chart_version", i.String("version"), release.ChartVersion)
+	for n := 0; ; n++ {
+		prefix := fmt.Sprintf("set.%d.", n)
+		setName := i.String(prefix + "name")
+		if setName == "" {
+			break
+		}
+		if setName == "image.tag" {
+			tag := i.String(prefix + "value")
+			if v := upgradedVersion(st, tf, upgrade.ActionAutoscaler); v != "" {
+				tag = v
+			}
+			a.compare(resource, "image.tag", tag, release.Value("image.tag"))
+		}
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,556 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi/fake"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfstate"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/upgrade"
+	"github.com/go-test/deep"
+)
+
+const (
+	issuer  = "https://oidc.eks.eu-central-1.amazonaws.com/id/ABC"
+	oidcArn = "arn:aws:iam::123456789012:oidc-provider/oidc.eks.eu-central-1.amazonaws.com/id/ABC"
+)
+
+// terraformState is a trimmed terraform state of applied module named "ks".
+const terraformState = `{
+  "version": 4,
+  "resources": [
+    {
+      "module": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_eks_cluster",
+      "name": "eks_cluster",
+      "instances": [{"attributes": {"name": "ks", "version": "1.18"}}]
+    },
+    {
+      "module": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_iam_openid_connect_provider",
+      "name": "eks_openid_connect_provider",
+      "instances": [{"attributes": {"arn": "` + oidcArn + `"}}]
+    },
+    {
+      "module": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_cloudwatch_log_group",
+      "name": "eks_log_group",
+      "instances": [{"attributes": {"name": "ks-log-group", "retention_in_days": 30}}]
+    },
+    {
+      "module": "module.nodes",
+      "mode": "managed",
+      "type": "aws_eks_node_group",
+      "name": "eks_nodes",
+      "instances": [
+        {
+          "index_key": 0,
+          "attributes": {
+            "node_group_name": "default_wg",
+            "scaling_config": [{"desired_size": 2, "max_size": 3, "min_size": 1}]
+          }
+        }
+      ]
+    },
+    {
+      "module": "module.addons",
+      "mode": "managed",
+      "type": "aws_eks_addon",
+      "name": "addon",
+      "instances": [
+        {"index_key": "coredns", "attributes": {"addon_name": "coredns", "addon_version": "v1.7.0-eksbuild.1"}},
+        {"index_key": "vpc-cni", "attributes": {"addon_name": "vpc-cni", "addon_version": "v1.9.1-eksbuild.1"}}
+      ]
+    },
+    {
+      "module": "module.autoscaler",
+      "mode": "managed",
+      "type": "helm_release",
+      "name": "cluster-autoscaler",
+      "instances": [
+        {
+          "attributes": {
+            "name": "cluster-autoscaler",
+            "namespace": "kube-system",
+            "version": "7.3.4",
+            "set": [
+              {"name": "cloudProvider", "type": "string", "value": "aws"},
+              {"name": "image.tag", "type": "string", "value": "v1.18.3"}
+            ]
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+type fakeHelm struct {
+	releases map[string]*Release
+}
+
+func (h *fakeHelm) Release(kubeconfig, name, namespace string) (*Release, error) {
+	if kubeconfig == "" {
+		return nil, errors.New("empty kubeconfig")
+	}
+	return h.releases[namespace+"/"+name], nil
+}
+
+func awsksState() *state.AWSKS {
+	return &state.AWSKS{
+		Status: state.StatusApplied,
+		AWSKS: config.AWSKS{
+			Name:   "ks",
+			Region: "eu-central-1",
+			WorkerGroups: []config.WorkerGroup{
+				{Name: "default_wg", InstanceType: "t2.small", AsgDesiredCapacity: 2, AsgMinSize: 1, AsgMaxSize: 3},
+			},
+		},
+		Output: state.AWSKSOutput{Kubeconfig: "apiVersion: v1\n"},
+	}
+}
+
+func seedCluster(cloud *fake.Cloud, version string) {
+	cloud.AddCluster(&eks.Cluster{
+		Name:     aws.String("ks"),
+		Version:  aws.String(version),
+		Identity: &eks.Identity{Oidc: &eks.OIDC{Issuer: aws.String(issuer)}},
+	})
+}
+
+func seedNodegroup(cloud *fake.Cloud, name string, min, desired, max int64) {
+	cloud.AddNodegroup(&eks.Nodegroup{
+		ClusterName:   aws.String("ks"),
+		NodegroupName: aws.String(name),
+		InstanceTypes: aws.StringSlice([]string{"t2.small"}),
+		ScalingConfig: &eks.NodegroupScalingConfig{MinSize: aws.Int64(min), DesiredSize: aws.Int64(desired), MaxSize: aws.Int64(max)},
+	})
+}
+
+func seedAddon(cloud *fake.Cloud, name, version string) {
+	cloud.AddAddon("ks", &awsapi.Addon{AddonName: aws.String(name), AddonVersion: aws.String(version)})
+}
+
+// withFargateProfile adds Fargate profile "system" running kube-system pods.
+func withFargateProfile(cfg *config.AWSKS) {
+	cfg.FargateProfiles = []config.FargateProfile{
+		{Name: "system", Selectors: []config.FargateSelector{{Namespace: "kube-system"}}},
+	}
+}
+
+// seedFargateProfile creates resources matching withFargateProfile.
+func seedFargateProfile(cloud *fake.Cloud, helm *fakeHelm) {
+	cloud.AddFargateProfile(&eks.FargateProfile{
+		ClusterName:        aws.String("ks"),
+		FargateProfileName: aws.String("system"),
+		Selectors:          []*eks.FargateProfileSelector{{Namespace: aws.String("kube-system")}},
+	})
+	cloud.AddRole("ks-eks-fargate-iam-role", []string{"arn:aws:iam::aws:policy/AmazonEKSFargatePodExecutionRolePolicy"}, nil)
+}
+
+// seedEnvironment creates resources matching awsksState and terraformState.
+func seedEnvironment(cloud *fake.Cloud, helm *fakeHelm) {
+	seedCluster(cloud, "1.18")
+	seedNodegroup(cloud, "default_wg", 1, 2, 3)
+	seedAddon(cloud, "coredns", "v1.7.0-eksbuild.1")
+	seedAddon(cloud, "vpc-cni", "v1.9.1-eksbuild.1")
+	cloud.AddRole("ks-eks-cluster-iam-role", []string{
+		"arn:aws:iam::aws:policy/AmazonEKSClusterPolicy",
+		"arn:aws:iam::aws:policy/AmazonEKSVPCResourceController",
+	}, nil)
+	cloud.AddRole("ks-eks-nodes-iam-role", []string{
+		"arn:aws:iam::aws:policy/AmazonEKSWorkerNodePolicy",
+		"arn:aws:iam::aws:policy/AmazonEKS_CNI_Policy",
+		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+	}, nil)
+	cloud.AddRole("ks-cluster-autoscaler", []string{"arn:aws:iam::123456789012:policy/ks-cluster-autoscaler"}, nil)
+	cloud.AddOpenIDConnectProvider(issuer)
+	cloud.AddLogGroup("ks-log-group", 30)
+	helm.releases["kube-system/cluster-autoscaler"] = &Release{
+		Status:       "deployed",
+		ChartVersion: "7.3.4",
+		Values:       map[string]interface{}{"image": map[string]interface{}{"tag": "v1.18.3"}},
+	}
+}
+
+// upgradeTo119 returns upgrade of awsksState to Kubernetes 1.19, finished
+// or stopped before the autoscaler step.
+func upgradeTo119(finished bool) *state.Upgrade {
+	return &state.Upgrade{
+		From: "1.18",
+		To:   "1.19",
+		Steps: []state.UpgradeStep{
+			{Action: upgrade.ActionControlPlane, Version: "1.19", Done: true},
+			{Action: upgrade.ActionNodegroup, Target: "default_wg", Version: "1.19", Done: true},
+			{Action: upgrade.ActionAutoscaler, Target: "cluster-autoscaler", Version: "v1.19.1", Done: finished},
+		},
+	}
+}
+
+// upgradeEnvironment changes versions in seeded environment as upgradeTo119
+// does.
+func upgradeEnvironment(cloud *fake.Cloud, helm *fakeHelm) {
+	seedCluster(cloud, "1.19")
+	seedNodegroup(cloud, "default_wg", 1, 2, 3)
+	seedAddon(cloud, "coredns", "v1.7.0-eksbuild.1")
+	seedAddon(cloud, "vpc-cni", "v1.9.1-eksbuild.1")
+	helm.releases["kube-system/cluster-autoscaler"].Values = map[string]interface{}{"image": map[string]interface{}{"tag": "v1.19.1"}}
+}
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    func(cfg *config.AWSKS)
+		upgrade   *state.Upgrade
+		modify    func(cloud *fake.Cloud, helm *fakeHelm)
+		tfstate   *strings.Replacer
+		wantDrift []Check
+	}{
+		{
+			name: "no drift",
+		},
+		{
+			name:   "desired size changed by autoscaler",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) { seedNodegroup(cloud, "default_wg", 1, 3, 3) },
+		},
+		{
+			name: "cluster version changed",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				seedCluster(cloud, "1.19")
+				seedNodegroup(cloud, "default_wg", 1, 2, 3)
+				seedAddon(cloud, "coredns", "v1.7.0-eksbuild.1")
+				seedAddon(cloud, "vpc-cni", "v1.9.1-eksbuild.1")
+			},
+			wantDrift: []Check{
+				{Resource: "eks cluster/ks", Property: "version", Expected: "1.18", Actual: "1.19", Drift: true},
+			},
+		},
+		{
+			name:    "after upgrade",
+			upgrade: upgradeTo119(true),
+			modify:  upgradeEnvironment,
+		},
+		{
+			name:    "during upgrade",
+			upgrade: upgradeTo119(false),
+			modify:  upgradeEnvironment,
+			wantDrift: []Check{
+				{Resource: "eks cluster/ks", Property: "version", Expected: "1.18", Actual: "1.19", Drift: true},
+				{Resource: "helm release/kube-system/cluster-autoscaler", Property: "image.tag", Expected: "v1.18.3", Actual: "v1.19.1", Drift: true},
+			},
+		},
+		{
+			name:    "after upgrade and apply",
+			upgrade: upgradeTo119(true),
+			tfstate: strings.NewReplacer(`"version": "1.18"`, `"version": "1.19"`, `"value": "v1.18.3"`, `"value": "v1.19.2"`),
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				upgradeEnvironment(cloud, helm)
+				helm.releases["kube-system/cluster-autoscaler"].Values["image"] = map[string]interface{}{"tag": "v1.19.2"}
+			},
+		},
+		{
+			name:   "node group scaled outside of terraform",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) { seedNodegroup(cloud, "default_wg", 1, 5, 5) },
+			wantDrift: []Check{
+				{Resource: "eks nodegroup/default_wg", Property: "max_size", Expected: "3", Actual: "5", Drift: true},
+			},
+		},
+		{
+			name: "desired size outside of limits",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				// AWS does not allow it, but the check must not rely on it.
+				seedNodegroup(cloud, "default_wg", 1, 4, 3)
+			},
+			wantDrift: []Check{
+				{Resource: "eks nodegroup/default_wg", Property: "desired_size", Expected: "1..3", Actual: "4", Drift: true},
+			},
+		},
+		{
+			name: "node group removed and another one added",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				cloud.DeleteNodegroup(&eks.DeleteNodegroupInput{ClusterName: aws.String("ks"), NodegroupName: aws.String("default_wg")})
+				seedNodegroup(cloud, "manual", 1, 1, 1)
+			},
+			wantDrift: []Check{
+				{Resource: "eks nodegroup/default_wg", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+				{Resource: "eks nodegroup/manual", Property: "exists", Expected: "missing", Actual: "present", Drift: true},
+			},
+		},
+		{
+			name: "add-on updated outside of terraform",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				cloud.AddAddon("ks", &awsapi.Addon{
+					AddonName:    aws.String("coredns"),
+					AddonVersion: aws.String("v1.8.0-eksbuild.1"),
+					Status:       aws.String("DEGRADED"),
+				})
+			},
+			wantDrift: []Check{
+				{Resource: "eks addon/coredns", Property: "status", Expected: "ACTIVE", Actual: "DEGRADED", Drift: true},
+				{Resource: "eks addon/coredns", Property: "version", Expected: "v1.7.0-eksbuild.1", Actual: "v1.8.0-eksbuild.1", Drift: true},
+			},
+		},
+		{
+			name:    "add-on missing",
+			tfstate: strings.NewReplacer(`"addon_name": "vpc-cni"`, `"addon_name": "kube-proxy"`),
+			wantDrift: []Check{
+				{Resource: "eks addon/kube-proxy", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+			},
+		},
+		{
+			name:   "Fargate profile",
+			config: withFargateProfile,
+			modify: seedFargateProfile,
+		},
+		{
+			name:   "Fargate profile removed and another one added",
+			config: withFargateProfile,
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				seedFargateProfile(cloud, helm)
+				cloud.DeleteFargateProfile(&eks.DeleteFargateProfileInput{ClusterName: aws.String("ks"), FargateProfileName: aws.String("system")})
+				cloud.AddFargateProfile(&eks.FargateProfile{
+					ClusterName:        aws.String("ks"),
+					FargateProfileName: aws.String("manual"),
+					Selectors:          []*eks.FargateProfileSelector{{Namespace: aws.String("default")}},
+				})
+			},
+			wantDrift: []Check{
+				{Resource: "eks fargate profile/system", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+				{Resource: "eks fargate profile/manual", Property: "exists", Expected: "missing", Actual: "present", Drift: true},
+			},
+		},
+		{
+			name:   "Fargate profile selectors changed",
+			config: withFargateProfile,
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				seedFargateProfile(cloud, helm)
+				cloud.AddFargateProfile(&eks.FargateProfile{
+					ClusterName:        aws.String("ks"),
+					FargateProfileName: aws.String("system"),
+					Status:             aws.String(eks.FargateProfileStatusCreateFailed),
+					Selectors:          []*eks.FargateProfileSelector{{Namespace: aws.String("default")}},
+				})
+			},
+			wantDrift: []Check{
+				{Resource: "eks fargate profile/system", Property: "status", Expected: "ACTIVE", Actual: "CREATE_FAILED", Drift: true},
+				{Resource: "eks fargate profile/system", Property: "namespaces", Expected: "kube-system", Actual: "default", Drift: true},
+			},
+		},
+		{
+			name: "Fargate only cluster without autoscaler",
+			config: func(cfg *config.AWSKS) {
+				withFargateProfile(cfg)
+				cfg.WorkerGroups = nil
+			},
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				seedFargateProfile(cloud, helm)
+				cloud.DeleteNodegroup(&eks.DeleteNodegroupInput{ClusterName: aws.String("ks"), NodegroupName: aws.String("default_wg")})
+				delete(helm.releases, "kube-system/cluster-autoscaler")
+			},
+			tfstate: strings.NewReplacer(`"type": "helm_release"`, `"type": "removed"`),
+		},
+		{
+			name: "role policy detached",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				cloud.DetachRolePolicy(&iam.DetachRolePolicyInput{
+					RoleName:  aws.String("ks-eks-cluster-iam-role"),
+					PolicyArn: aws.String("arn:aws:iam::aws:policy/AmazonEKSVPCResourceController"),
+				})
+			},
+			wantDrift: []Check{
+				{
+					Resource: "iam role/ks-eks-cluster-iam-role", Property: "attached_policies",
+					Expected: "AmazonEKSClusterPolicy,AmazonEKSVPCResourceController", Actual: "AmazonEKSClusterPolicy", Drift: true,
+				},
+			},
+		},
+		{
+			name: "role removed",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				cloud.DetachRolePolicy(&iam.DetachRolePolicyInput{
+					RoleName:  aws.String("ks-cluster-autoscaler"),
+					PolicyArn: aws.String("arn:aws:iam::123456789012:policy/ks-cluster-autoscaler"),
+				})
+				cloud.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String("ks-cluster-autoscaler")})
+			},
+			wantDrift: []Check{
+				{Resource: "iam role/ks-cluster-autoscaler", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+			},
+		},
+		{
+			name:    "OIDC provider missing",
+			tfstate: strings.NewReplacer("id/ABC", "id/DEF"),
+			wantDrift: []Check{
+				{Resource: "iam oidc provider/DEF", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+			},
+		},
+		{
+			name:   "log retention changed",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) { cloud.AddLogGroup("ks-log-group", 7) },
+			wantDrift: []Check{
+				{Resource: "log group/ks-log-group", Property: "retention_in_days", Expected: "30", Actual: "7", Drift: true},
+			},
+		},
+		{
+			name: "autoscaler release failed",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) {
+				helm.releases["kube-system/cluster-autoscaler"].Status = "failed"
+				helm.releases["kube-system/cluster-autoscaler"].Values = nil
+			},
+			wantDrift: []Check{
+				{Resource: "helm release/kube-system/cluster-autoscaler", Property: "status", Expected: "deployed", Actual: "failed", Drift: true},
+				{Resource: "helm release/kube-system/cluster-autoscaler", Property: "image.tag", Expected: "v1.18.3", Actual: "", Drift: true},
+			},
+		},
+		{
+			name:   "autoscaler release missing",
+			modify: func(cloud *fake.Cloud, helm *fakeHelm) { delete(helm.releases, "kube-system/cluster-autoscaler") },
+			wantDrift: []Check{
+				{Resource: "helm release/kube-system/cluster-autoscaler", Property: "exists", Expected: "present", Actual: "missing", Drift: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := fake.New()
+			helm := &fakeHelm{releases: make(map[string]*Release)}
+			seedEnvironment(cloud, helm)
+			if tt.modify != nil {
+				tt.modify(cloud, helm)
+			}
+			st := awsksState()
+			st.Upgrade = tt.upgrade
+			if tt.config != nil {
+				tt.config(&st.AWSKS)
+			}
+			content := terraformState
+			if tt.tfstate != nil {
+				content = tt.tfstate.Replace(content)
+			}
+			tf, err := tfstate.Parse([]byte(content))
+			if err != nil {
+				t.Fatalf("tfstate.Parse() failed with: %v", err)
+			}
+
+			report, err := New(cloud.Clients(), helm).Audit(st, tf)
+			if err != nil {
+				t.Fatalf("Audit() failed with: %v", err)
+			}
+			if diff := deep.Equal(report.Drifted(), tt.wantDrift); diff != nil {
+				t.Error(diff)
+			}
+			var driftErr *DriftError
+			if got := errors.As(report.Err(), &driftErr); got != (tt.wantDrift != nil) {
+				t.Errorf("expected DriftError %v, got: %v", tt.wantDrift != nil, report.Err())
+			}
+		})
+	}
+}
+
+func TestAuditMissingCluster(t *testing.T) {
+	cloud := fake.New()
+	helm := &fakeHelm{releases: make(map[string]*Release)}
+	seedEnvironment(cloud, helm)
+	cloud.DeleteNodegroup(&eks.DeleteNodegroupInput{ClusterName: aws.String("ks"), NodegroupName: aws.String("default_wg")})
+	cloud.DeleteCluster(&eks.DeleteClusterInput{Name: aws.String("ks")})
+	tf, err := tfstate.Parse([]byte(terraformState))
+	if err != nil {
+		t.Fatalf("tfstate.Parse() failed with: %v", err)
+	}
+
+	report, err := New(cloud.Clients(), helm).Audit(awsksState(), tf)
+	if err != nil {
+		t.Fatalf("Audit() failed with: %v", err)
+	}
+	want := []Check{{Resource: "eks cluster/ks", Property: "exists", Expected: "present", Actual: "missing", Drift: true}}
+	if diff := deep.Equal(report.Drifted(), want); diff != nil {
+		t.Error(diff)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteTable(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "eks cluster/ks") || !strings.Contains(b.String(), "YES") {
+		t.Errorf("unexpected table:\n%s", b.String())
+	}
+}
+
+func TestAuditErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tfstate string
+		fail    string
+		wantErr string
+	}{
+		{
+			name:    "resource missing in terraform state",
+			tfstate: strings.Replace(terraformState, `"helm_release"`, `"helm_chart"`, 1),
+			wantErr: "terraform state has no helm_release resource, run apply first",
+		},
+		{
+			name:    "add-on failure",
+			tfstate: terraformState,
+			fail:    "DescribeAddon",
+			wantErr: "cannot describe add-on coredns: AccessDenied",
+		},
+		{
+			name:    "Fargate profiles failure",
+			tfstate: terraformState,
+			fail:    "ListFargateProfiles",
+			wantErr: "cannot list Fargate profiles of cluster ks: AccessDenied",
+		},
+		{
+			name:    "AWS failure",
+			tfstate: terraformState,
+			fail:    "GetRole",
+			wantErr: "cannot get role ks-eks-cluster-iam-role: AccessDenied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := fake.New()
+			helm := &fakeHelm{releases: make(map[string]*Release)}
+			seedEnvironment(cloud, helm)
+			if tt.fail != "" {
+				cloud.FailNext(tt.fail, "AccessDenied", 1)
+			}
+			tf, err := tfstate.Parse([]byte(tt.tfstate))
+			if err != nil {
+				t.Fatalf("tfstate.Parse() failed with: %v", err)
+			}
+
+			_, err = New(cloud.Clients(), helm).Audit(awsksState(), tf)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	release, err := parseStatus([]byte(`{
+  "name": "cluster-autoscaler",
+  "info": {"status": "deployed"},
+  "chart": {"metadata": {"name": "cluster-autoscaler", "version": "7.3.4"}},
+  "config": {"image": {"repository": "k8s.gcr.io/autoscaling/cluster-autoscaler", "tag": "v1.18.3"}}
+}`))
+	if err != nil {
+		t.Fatalf("parseStatus() failed with: %v", err)
+	}
+	if release.Status != "deployed" || release.ChartVersion != "7.3.4" || release.Value("image.tag") != "v1.18.3" {
+		t.Errorf("unexpected release: %+v", release)
+	}
+}
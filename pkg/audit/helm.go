@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/helm"
+)
+
+// Helm reads releases installed in the cluster.
+type Helm interface {
+	// Release returns release or nil when it is not installed.
+	Release(kubeconfig, name, namespace string) (*Release, error)
+}
+
+// Release is a deployed helm release.
+type Release struct {
+	Status       string
+	ChartVersion string
+	// Values are values provided during installation.
+	Values map[string]interface{}
+}
+
+// Value returns value found under dot separated path, e.g. "image.tag", or
+// empty string.
+func (r *Release) Value(path string) string {
+	var v interface{} = r.Values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// ExecHelm reads releases using helm binary.
+type ExecHelm struct{}
+
+func (ExecHelm) Release(kubeconfig, name, namespace string) (*Release, error) {
+	out, err := helm.Run(kubeconfig, "status", name, "--namespace", namespace, "--output", "json")
+	if err != nil {
+		if strings.Contains(err.Error(), "release: not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseStatus(out)
+}
+
+// parseStatus decodes output of helm status --output json.
+func parseStatus(data []byte) (*Release, error) {
+	var status struct {
+		Info struct {
+			Status string `json:"status"`
+		} `json:"info"`
+		Chart struct {
+			Metadata struct {
+				Version string `json:"version"`
+			} `json:"metadata"`
+		} `json:"chart"`
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("cannot parse helm status: %w", err)
+	}
+	return &Release{
+		Status:       status.Info.Status,
+		ChartVersion: status.Chart.Metadata.Version,
+		Values:       status.Config,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package awsapi
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eks"
+)
+
+// EKSAddonsAPI describes EKS managed add-ons. The aws-sdk-go version used in
+// this repository predates add-ons, so the operation and its shapes are
+// defined here and sent with the EKS client.
+type EKSAddonsAPI interface {
+	DescribeAddon(*DescribeAddonInput) (*DescribeAddonOutput, error)
+}
+
+// DescribeAddonInput identifies add-on of a cluster.
+type DescribeAddonInput struct {
+	_ struct{} `type:"structure"`
+
+	ClusterName *string `location:"uri" locationName:"name" type:"string" required:"true"`
+	AddonName   *string `location:"uri" locationName:"addonName" type:"string" required:"true"`
+}
+
+// DescribeAddonOutput holds the described add-on.
+type DescribeAddonOutput struct {
+	_ struct{} `type:"structure"`
+
+	Addon *Addon `locationName:"addon" type:"structure"`
+}
+
+// Addon is the subset of EKS add-on attributes used in this repository.
+type Addon struct {
+	_ struct{} `type:"structure"`
+
+	AddonName    *string `locationName:"addonName" type:"string"`
+	AddonVersion *string `locationName:"addonVersion" type:"string"`
+	Status       *string `locationName:"status" type:"string"`
+}
+
+// AddonStatusActive is the status of installed and healthy add-on.
+const AddonStatusActive = "ACTIVE"
+
+type eksAddons struct {
+	client *eks.EKS
+}
+
+// NewEKSAddons returns EKSAddonsAPI sending requests with EKS client.
+func NewEKSAddons(client *eks.EKS) EKSAddonsAPI {
+	return eksAddons{client: client}
+}
+
+func (c eksAddons) DescribeAddon(input *DescribeAddonInput) (*DescribeAddonOutput, error) {
+	op := &request.Operation{
+		Name:       "DescribeAddon",
+		HTTPMethod: "GET",
+		HTTPPath:   "/clusters/{name}/addons/{addonName}",
+	}
+	output := &DescribeAddonOutput{}
+	req := c.client.NewRequest(op, input, output)
+	return output, req.Send()
+}
@@ -0,0 +1,55 @@
+package awsapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/go-test/deep"
+)
+
+func TestDescribeAddon(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path != "/clusters/ks/addons/vpc-cni" {
+			w.Header().Set("x-amzn-ErrorType", eks.ErrCodeResourceNotFoundException)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No addon found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"addon": {"addonName": "vpc-cni", "addonVersion": "v1.9.1-eksbuild.1", "status": "ACTIVE"}}`)
+	}))
+	defer server.Close()
+	s, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewEKSAddons(eks.New(s))
+
+	out, err := client.DescribeAddon(&DescribeAddonInput{ClusterName: aws.String("ks"), AddonName: aws.String("vpc-cni")})
+	if err != nil {
+		t.Fatalf("DescribeAddon() failed with: %v", err)
+	}
+	want := &Addon{AddonName: aws.String("vpc-cni"), AddonVersion: aws.String("v1.9.1-eksbuild.1"), Status: aws.String(AddonStatusActive)}
+	if diff := deep.Equal(out.Addon, want); diff != nil {
+		t.Error(diff)
+	}
+
+	_, err = client.DescribeAddon(&DescribeAddonInput{ClusterName: aws.String("ks"), AddonName: aws.String("coredns")})
+	if !IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+		t.Errorf("expected %s, got: %v", eks.ErrCodeResourceNotFoundException, err)
+	}
+	if diff := deep.Equal(paths, []string{"GET /clusters/ks/addons/vpc-cni", "GET /clusters/ks/addons/coredns"}); diff != nil {
+		t.Error(diff)
+	}
+}
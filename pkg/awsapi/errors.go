@@ -0,0 +1,21 @@
+package awsapi
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// IsErrorCode checks if err is an AWS error with one of provided codes.
+func IsErrorCode(err error, codes ...string) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	for _, code := range codes {
+		if aerr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,726 @@
+package fake
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type vpc struct {
+	id   string
+	cidr string
+}
+
+type subnet struct {
+	id    string
+	vpcID string
+	az    string
+	cidr  string
+}
+
+type securityGroup struct {
+	id    string
+	vpcID string
+}
+
+type routeTable struct {
+	id        string
+	vpcID     string
+	subnetIDs []string
+}
+
+type internetGateway struct {
+	id    string
+	vpcID string
+}
+
+type natGateway struct {
+	id            string
+	subnetID      string
+	allocationID  string
+	state         string
+	deletingPolls int
+}
+
+type address struct {
+	allocationID string
+	tags         map[string]string
+}
+
+type networkInterface struct {
+	id           string
+	subnetID     string
+	attachmentID string
+}
+
+type instance struct {
+	id       string
+	subnetID string
+	state    string
+}
+
+// AddVpc seeds VPC.
+func (c *Cloud) AddVpc(id, cidr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vpcs[id] = &vpc{id: id, cidr: cidr}
+}
+
+// AddSubnet seeds subnet in VPC and availability zone.
+func (c *Cloud) AddSubnet(id, vpcID, az, cidr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subnets[id] = &subnet{id: id, vpcID: vpcID, az: az, cidr: cidr}
+}
+
+// AddSecurityGroup seeds security group in VPC.
+func (c *Cloud) AddSecurityGroup(id, vpcID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.securityGroups[id] = &securityGroup{id: id, vpcID: vpcID}
+}
+
+// AddRouteTable seeds route table associated with subnets.
+func (c *Cloud) AddRouteTable(id, vpcID string, subnetIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routeTables[id] = &routeTable{id: id, vpcID: vpcID, subnetIDs: subnetIDs}
+}
+
+// AddInternetGateway seeds internet gateway attached to VPC. Empty vpcID
+// means detached gateway.
+func (c *Cloud) AddInternetGateway(id, vpcID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.internetGateways[id] = &internetGateway{id: id, vpcID: vpcID}
+}
+
+// AddNatGateway seeds available NAT gateway in subnet using EIP allocation.
+func (c *Cloud) AddNatGateway(id, subnetID, allocationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.natGateways[id] = &natGateway{id: id, subnetID: subnetID, allocationID: allocationID, state: ec2.NatGatewayStateAvailable}
+}
+
+// AddAddress seeds EIP allocation with tags.
+func (c *Cloud) AddAddress(allocationID string, tags map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addresses[allocationID] = &address{allocationID: allocationID, tags: tags}
+}
+
+// AddNetworkInterface seeds ENI in subnet, optionally attached.
+func (c *Cloud) AddNetworkInterface(id, subnetID string, attached bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	eni := &networkInterface{id: id, subnetID: subnetID}
+	if attached {
+		eni.attachmentID = "eni-attach-" + strings.TrimPrefix(id, "eni-")
+	}
+	c.networkInterfaces[id] = eni
+}
+
+// AddInstance seeds running EC2 instance in subnet.
+func (c *Cloud) AddInstance(id, subnetID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.instances[id] = &instance{id: id, subnetID: subnetID, state: ec2.InstanceStateNameRunning}
+}
+
+// AddInstanceTypeOffering seeds availability zones offering instance type.
+func (c *Cloud) AddInstanceTypeOffering(instanceType string, zones ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.instanceTypeOfferings[instanceType] = append(c.instanceTypeOfferings[instanceType], zones...)
+}
+
+// AddKeyPair seeds EC2 key pair.
+func (c *Cloud) AddKeyPair(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keyPairs[name] = true
+}
+
+// AddLaunchTemplate seeds EC2 launch template.
+func (c *Cloud) AddLaunchTemplate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.launchTemplates[id] = true
+}
+
+func (c *Cloud) DescribeAvailabilityZones(in *ec2.DescribeAvailabilityZonesInput) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	leave, err := c.enter("DescribeAvailabilityZones")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ec2.DescribeAvailabilityZonesOutput{}
+	for _, zone := range c.AvailabilityZones {
+		out.AvailabilityZones = append(out.AvailabilityZones, &ec2.AvailabilityZone{
+			ZoneName:   aws.String(zone),
+			RegionName: aws.String(c.Region),
+			State:      aws.String(ec2.AvailabilityZoneStateAvailable),
+		})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DescribeInstanceTypeOfferings(in *ec2.DescribeInstanceTypeOfferingsInput) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+	leave, err := c.enter("DescribeInstanceTypeOfferings")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(in.LocationType) != ec2.LocationTypeAvailabilityZone {
+		return nil, newError("InvalidParameterValue", "unsupported location type %s", aws.StringValue(in.LocationType))
+	}
+
+	var types []string
+	for t := range c.instanceTypeOfferings {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	out := &ec2.DescribeInstanceTypeOfferingsOutput{}
+	for _, t := range types {
+		for _, zone := range c.instanceTypeOfferings[t] {
+			if !filtersMatch(in.Filters, func(name string, values []*string) bool {
+				return name == "instance-type" && containsValue(values, t) || name == "location" && containsValue(values, zone)
+			}) {
+				continue
+			}
+			out.InstanceTypeOfferings = append(out.InstanceTypeOfferings, &ec2.InstanceTypeOffering{
+				InstanceType: aws.String(t),
+				LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+				Location:     aws.String(zone),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (c *Cloud) DescribeKeyPairs(in *ec2.DescribeKeyPairsInput) (*ec2.DescribeKeyPairsOutput, error) {
+	leave, err := c.enter("DescribeKeyPairs")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ec2.DescribeKeyPairsOutput{}
+	for _, name := range aws.StringValueSlice(in.KeyNames) {
+		if !c.keyPairs[name] {
+			return nil, newError("InvalidKeyPair.NotFound", "The key pair '%s' does not exist", name)
+		}
+		out.KeyPairs = append(out.KeyPairs, &ec2.KeyPairInfo{KeyName: aws.String(name)})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DescribeAddresses(in *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	leave, err := c.enter("DescribeAddresses")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range c.addresses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := &ec2.DescribeAddressesOutput{}
+	for _, id := range ids {
+		a := c.addresses[id]
+		if !filtersMatch(in.Filters, func(name string, values []*string) bool {
+			return strings.HasPrefix(name, "tag:") && tagsMatch(a.tags, name, values)
+		}) {
+			continue
+		}
+		out.Addresses = append(out.Addresses, &ec2.Address{AllocationId: aws.String(a.allocationID)})
+	}
+	return out, nil
+}
+
+func (c *Cloud) ReleaseAddress(in *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	leave, err := c.enter("ReleaseAddress")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.AllocationId)
+	if _, ok := c.addresses[id]; !ok {
+		return nil, newError("InvalidAllocationID.NotFound", "allocation %s not found", id)
+	}
+	for _, ng := range c.natGateways {
+		if ng.allocationID == id && ng.state != ec2.NatGatewayStateDeleted {
+			return nil, newError("AuthFailure", "address %s is in use by %s", id, ng.id)
+		}
+	}
+	delete(c.addresses, id)
+	c.record("ReleaseAddress", id)
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+func (c *Cloud) DescribeInstances(in *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	leave, err := c.enter("DescribeInstances")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := &ec2.Reservation{}
+	for _, id := range aws.StringValueSlice(in.InstanceIds) {
+		i, ok := c.instances[id]
+		if !ok {
+			return nil, newError("InvalidInstanceID.NotFound", "instance %s not found", id)
+		}
+		reservation.Instances = append(reservation.Instances, &ec2.Instance{
+			InstanceId: aws.String(i.id),
+			SubnetId:   aws.String(i.subnetID),
+			State:      &ec2.InstanceState{Name: aws.String(i.state)},
+		})
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{reservation}}, nil
+}
+
+func (c *Cloud) TerminateInstances(in *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
+	leave, err := c.enter("TerminateInstances")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range aws.StringValueSlice(in.InstanceIds) {
+		i, ok := c.instances[id]
+		if !ok {
+			return nil, newError("InvalidInstanceID.NotFound", "instance %s not found", id)
+		}
+		i.state = ec2.InstanceStateNameTerminated
+		c.record("TerminateInstances", id)
+	}
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+func (c *Cloud) WaitUntilInstanceTerminated(*ec2.DescribeInstancesInput) error {
+	leave, err := c.enter("WaitUntilInstanceTerminated")
+	defer leave()
+	return err
+}
+
+func (c *Cloud) DescribeInternetGateways(in *ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error) {
+	leave, err := c.enter("DescribeInternetGateways")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ec2.DescribeInternetGatewaysOutput{}
+	for _, id := range aws.StringValueSlice(in.InternetGatewayIds) {
+		igw, ok := c.internetGateways[id]
+		if !ok {
+			return nil, newError("InvalidInternetGatewayID.NotFound", "internet gateway %s not found", id)
+		}
+		g := &ec2.InternetGateway{InternetGatewayId: aws.String(igw.id)}
+		if igw.vpcID != "" {
+			g.Attachments = []*ec2.InternetGatewayAttachment{{VpcId: aws.String(igw.vpcID), State: aws.String("available")}}
+		}
+		out.InternetGateways = append(out.InternetGateways, g)
+	}
+	return out, nil
+}
+
+func (c *Cloud) DetachInternetGateway(in *ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error) {
+	leave, err := c.enter("DetachInternetGateway")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.InternetGatewayId)
+	igw, ok := c.internetGateways[id]
+	if !ok {
+		return nil, newError("InvalidInternetGatewayID.NotFound", "internet gateway %s not found", id)
+	}
+	if igw.vpcID != aws.StringValue(in.VpcId) {
+		return nil, newError("Gateway.NotAttached", "internet gateway %s is not attached to %s", id, aws.StringValue(in.VpcId))
+	}
+	igw.vpcID = ""
+	c.record("DetachInternetGateway", id)
+	return &ec2.DetachInternetGatewayOutput{}, nil
+}
+
+func (c *Cloud) DeleteInternetGateway(in *ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error) {
+	leave, err := c.enter("DeleteInternetGateway")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.InternetGatewayId)
+	igw, ok := c.internetGateways[id]
+	if !ok {
+		return nil, newError("InvalidInternetGatewayID.NotFound", "internet gateway %s not found", id)
+	}
+	if igw.vpcID != "" {
+		return nil, newError("DependencyViolation", "internet gateway %s is attached to %s", id, igw.vpcID)
+	}
+	delete(c.internetGateways, id)
+	c.record("DeleteInternetGateway", id)
+	return &ec2.DeleteInternetGatewayOutput{}, nil
+}
+
+func (c *Cloud) DescribeNatGateways(in *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	leave, err := c.enter("DescribeNatGateways")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ec2.DescribeNatGatewaysOutput{}
+	for _, id := range aws.StringValueSlice(in.NatGatewayIds) {
+		ng, ok := c.natGateways[id]
+		if !ok {
+			return nil, newError("NatGatewayNotFound", "NAT gateway %s not found", id)
+		}
+		if ng.state == ec2.NatGatewayStateDeleting {
+			if ng.deletingPolls <= 0 {
+				ng.state = ec2.NatGatewayStateDeleted
+			}
+			ng.deletingPolls--
+		}
+		out.NatGateways = append(out.NatGateways, &ec2.NatGateway{
+			NatGatewayId: aws.String(ng.id),
+			SubnetId:     aws.String(ng.subnetID),
+			State:        aws.String(ng.state),
+		})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DeleteNatGateway(in *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	leave, err := c.enter("DeleteNatGateway")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.NatGatewayId)
+	ng, ok := c.natGateways[id]
+	if !ok {
+		return nil, newError("NatGatewayNotFound", "NAT gateway %s not found", id)
+	}
+	if ng.state == ec2.NatGatewayStateAvailable {
+		ng.state = ec2.NatGatewayStateDeleting
+		ng.deletingPolls = c.NatGatewayDeletingPolls
+	}
+	c.record("DeleteNatGateway", id)
+	return &ec2.DeleteNatGatewayOutput{NatGatewayId: aws.String(id)}, nil
+}
+
+func (c *Cloud) DescribeNetworkInterfaces(in *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	leave, err := c.enter("DescribeNetworkInterfaces")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range c.networkInterfaces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := &ec2.DescribeNetworkInterfacesOutput{}
+	for _, id := range ids {
+		eni := c.networkInterfaces[id]
+		if !filtersMatch(in.Filters, func(name string, values []*string) bool {
+			return name == "subnet-id" && containsValue(values, eni.subnetID)
+		}) {
+			continue
+		}
+		ni := &ec2.NetworkInterface{
+			NetworkInterfaceId: aws.String(eni.id),
+			SubnetId:           aws.String(eni.subnetID),
+		}
+		if eni.attachmentID != "" {
+			ni.Attachment = &ec2.NetworkInterfaceAttachment{AttachmentId: aws.String(eni.attachmentID)}
+		}
+		out.NetworkInterfaces = append(out.NetworkInterfaces, ni)
+	}
+	return out, nil
+}
+
+func (c *Cloud) DetachNetworkInterface(in *ec2.DetachNetworkInterfaceInput) (*ec2.DetachNetworkInterfaceOutput, error) {
+	leave, err := c.enter("DetachNetworkInterface")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	attachmentID := aws.StringValue(in.AttachmentId)
+	for _, eni := range c.networkInterfaces {
+		if eni.attachmentID != "" && eni.attachmentID == attachmentID {
+			eni.attachmentID = ""
+			c.record("DetachNetworkInterface", eni.id)
+			return &ec2.DetachNetworkInterfaceOutput{}, nil
+		}
+	}
+	return nil, newError("InvalidAttachmentID.NotFound", "attachment %s not found", attachmentID)
+}
+
+func (c *Cloud) DeleteNetworkInterface(in *ec2.DeleteNetworkInterfaceInput) (*ec2.DeleteNetworkInterfaceOutput, error) {
+	leave, err := c.enter("DeleteNetworkInterface")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.NetworkInterfaceId)
+	eni, ok := c.networkInterfaces[id]
+	if !ok {
+		return nil, newError("InvalidNetworkInterfaceID.NotFound", "network interface %s not found", id)
+	}
+	if eni.attachmentID != "" {
+		return nil, newError("InvalidNetworkInterface.InUse", "network interface %s is in use", id)
+	}
+	delete(c.networkInterfaces, id)
+	c.record("DeleteNetworkInterface", id)
+	return &ec2.DeleteNetworkInterfaceOutput{}, nil
+}
+
+func (c *Cloud) DeleteRouteTable(in *ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error) {
+	leave, err := c.enter("DeleteRouteTable")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.RouteTableId)
+	rt, ok := c.routeTables[id]
+	if !ok {
+		return nil, newError("InvalidRouteTableID.NotFound", "route table %s not found", id)
+	}
+	for _, subnetID := range rt.subnetIDs {
+		if _, ok := c.subnets[subnetID]; ok {
+			return nil, newError("DependencyViolation", "route table %s is associated with %s", id, subnetID)
+		}
+	}
+	delete(c.routeTables, id)
+	c.record("DeleteRouteTable", id)
+	return &ec2.DeleteRouteTableOutput{}, nil
+}
+
+func (c *Cloud) DeleteSecurityGroup(in *ec2.DeleteSecurityGroupInput) (*ec2.DeleteSecurityGroupOutput, error) {
+	leave, err := c.enter("DeleteSecurityGroup")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.GroupId)
+	if _, ok := c.securityGroups[id]; !ok {
+		return nil, newError("InvalidGroup.NotFound", "security group %s not found", id)
+	}
+	delete(c.securityGroups, id)
+	c.record("DeleteSecurityGroup", id)
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+func (c *Cloud) DescribeSubnets(in *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	leave, err := c.enter("DescribeSubnets")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := aws.StringValueSlice(in.SubnetIds)
+	if len(ids) == 0 {
+		for id := range c.subnets {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	out := &ec2.DescribeSubnetsOutput{}
+	for _, id := range ids {
+		s, ok := c.subnets[id]
+		if !ok {
+			return nil, newError("InvalidSubnetID.NotFound", "subnet %s not found", id)
+		}
+		if !filtersMatch(in.Filters, func(name string, values []*string) bool {
+			return name == "vpc-id" && containsValue(values, s.vpcID)
+		}) {
+			continue
+		}
+		out.Subnets = append(out.Subnets, &ec2.Subnet{
+			SubnetId:                aws.String(s.id),
+			VpcId:                   aws.String(s.vpcID),
+			AvailabilityZone:        aws.String(s.az),
+			CidrBlock:               aws.String(s.cidr),
+			AvailableIpAddressCount: aws.Int64(c.availableIPAddresses(s)),
+		})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DeleteSubnet(in *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	leave, err := c.enter("DeleteSubnet")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.SubnetId)
+	if _, ok := c.subnets[id]; !ok {
+		return nil, newError("InvalidSubnetID.NotFound", "subnet %s not found", id)
+	}
+	for _, eni := range c.networkInterfaces {
+		if eni.subnetID == id {
+			return nil, newError("DependencyViolation", "subnet %s has network interface %s", id, eni.id)
+		}
+	}
+	for _, i := range c.instances {
+		if i.subnetID == id && i.state != ec2.InstanceStateNameTerminated {
+			return nil, newError("DependencyViolation", "subnet %s has instance %s", id, i.id)
+		}
+	}
+	for _, ng := range c.natGateways {
+		if ng.subnetID == id && ng.state != ec2.NatGatewayStateDeleted {
+			return nil, newError("DependencyViolation", "subnet %s has NAT gateway %s", id, ng.id)
+		}
+	}
+	delete(c.subnets, id)
+	c.record("DeleteSubnet", id)
+	return &ec2.DeleteSubnetOutput{}, nil
+}
+
+func (c *Cloud) DescribeVpcs(in *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	leave, err := c.enter("DescribeVpcs")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ec2.DescribeVpcsOutput{}
+	for _, id := range aws.StringValueSlice(in.VpcIds) {
+		v, ok := c.vpcs[id]
+		if !ok {
+			return nil, newError("InvalidVpcID.NotFound", "VPC %s not found", id)
+		}
+		out.Vpcs = append(out.Vpcs, &ec2.Vpc{
+			VpcId:     aws.String(v.id),
+			CidrBlock: aws.String(v.cidr),
+			CidrBlockAssociationSet: []*ec2.VpcCidrBlockAssociation{
+				{CidrBlock: aws.String(v.cidr)},
+			},
+		})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DeleteVpc(in *ec2.DeleteVpcInput) (*ec2.DeleteVpcOutput, error) {
+	leave, err := c.enter("DeleteVpc")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.VpcId)
+	if _, ok := c.vpcs[id]; !ok {
+		return nil, newError("InvalidVpcID.NotFound", "VPC %s not found", id)
+	}
+	var dependencies []string
+	for _, s := range c.subnets {
+		if s.vpcID == id {
+			dependencies = append(dependencies, s.id)
+		}
+	}
+	for _, sg := range c.securityGroups {
+		if sg.vpcID == id {
+			dependencies = append(dependencies, sg.id)
+		}
+	}
+	for _, rt := range c.routeTables {
+		if rt.vpcID == id {
+			dependencies = append(dependencies, rt.id)
+		}
+	}
+	for _, igw := range c.internetGateways {
+		if igw.vpcID == id {
+			dependencies = append(dependencies, igw.id)
+		}
+	}
+	if len(dependencies) > 0 {
+		sort.Strings(dependencies)
+		return nil, newError("DependencyViolation", "VPC %s has dependencies: %s", id, strings.Join(dependencies, ", "))
+	}
+	delete(c.vpcs, id)
+	c.record("DeleteVpc", id)
+	return &ec2.DeleteVpcOutput{}, nil
+}
+
+func (c *Cloud) DeleteKeyPair(in *ec2.DeleteKeyPairInput) (*ec2.DeleteKeyPairOutput, error) {
+	leave, err := c.enter("DeleteKeyPair")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	// AWS does not report missing key pairs on deletion.
+	name := aws.StringValue(in.KeyName)
+	if c.keyPairs[name] {
+		delete(c.keyPairs, name)
+		c.record("DeleteKeyPair", name)
+	}
+	return &ec2.DeleteKeyPairOutput{}, nil
+}
+
+func (c *Cloud) DeleteLaunchTemplate(in *ec2.DeleteLaunchTemplateInput) (*ec2.DeleteLaunchTemplateOutput, error) {
+	leave, err := c.enter("DeleteLaunchTemplate")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(in.LaunchTemplateId)
+	if !c.launchTemplates[id] {
+		return nil, newError("InvalidLaunchTemplateId.NotFound", "The specified launch template, with template ID %s, does not exist.", id)
+	}
+	delete(c.launchTemplates, id)
+	c.record("DeleteLaunchTemplate", id)
+	return &ec2.DeleteLaunchTemplateOutput{}, nil
+}
+
+// availableIPAddresses counts addresses of subnet not used by network
+// interfaces, AWS reserves 5 addresses of every subnet.
+func (c *Cloud) availableIPAddresses(s *subnet) int64 {
+	_, block, err := net.ParseCIDR(s.cidr)
+	if err != nil {
+		return 0
+	}
+	ones, bits := block.Mask.Size()
+	available := int64(1)<<(bits-ones) - 5
+	for _, eni := range c.networkInterfaces {
+		if eni.subnetID == s.id {
+			available--
+		}
+	}
+	return available
+}
+
+// filtersMatch checks if all filters are matched. match is called for every
+// filter and should return false for unsupported filter names.
+func filtersMatch(filters []*ec2.Filter, match func(name string, values []*string) bool) bool {
+	for _, f := range filters {
+		if !match(aws.StringValue(f.Name), f.Values) {
+			return false
+		}
+	}
+	return true
+}
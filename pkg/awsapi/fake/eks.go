@@ -0,0 +1,487 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+type cluster struct {
+	cluster    *eks.Cluster
+	nodegroups map[string]*eks.Nodegroup
+	addons     map[string]*awsapi.Addon
+	// fargateProfiles in DELETING state are removed when described, EKS
+	// deletes only one profile of a cluster at a time.
+	fargateProfiles map[string]*eks.FargateProfile
+	// pending are version updates in progress by node group name, update of
+	// the cluster itself is stored under empty name.
+	pending map[string]*pendingUpdate
+	// updates are all version updates of the cluster and its node groups by
+	// id.
+	updates map[string]*eks.Update
+}
+
+type pendingUpdate struct {
+	version string
+	active  int
+	polls   int
+	update  *eks.Update
+	// failure makes the update fail, resource is left ACTIVE in the old
+	// version.
+	failure *eks.ErrorDetail
+}
+
+// advance moves pending update of the cluster (empty name) or node group
+// forward and applies it when it is finished.
+func (cl *cluster) advance(name string) {
+	p, ok := cl.pending[name]
+	if !ok {
+		return
+	}
+	if p.active > 0 {
+		p.active--
+		return
+	}
+	if p.polls > 0 {
+		p.polls--
+		if name == "" {
+			cl.cluster.Status = aws.String(eks.ClusterStatusUpdating)
+		} else {
+			cl.nodegroups[name].Status = aws.String(eks.NodegroupStatusUpdating)
+		}
+		return
+	}
+	delete(cl.pending, name)
+	if p.failure != nil {
+		p.update.Status = aws.String(eks.UpdateStatusFailed)
+		p.update.Errors = []*eks.ErrorDetail{p.failure}
+		if name == "" {
+			cl.cluster.Status = aws.String(eks.ClusterStatusActive)
+		} else {
+			cl.nodegroups[name].Status = aws.String(eks.NodegroupStatusActive)
+		}
+		return
+	}
+	p.update.Status = aws.String(eks.UpdateStatusSuccessful)
+	if name == "" {
+		cl.cluster.Version = aws.String(p.version)
+		cl.cluster.Status = aws.String(eks.ClusterStatusActive)
+		return
+	}
+	cl.nodegroups[name].Version = aws.String(p.version)
+	cl.nodegroups[name].Status = aws.String(eks.NodegroupStatusActive)
+}
+
+// AddCluster seeds EKS cluster. Status defaults to ACTIVE.
+func (c *Cloud) AddCluster(in *eks.Cluster) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *in
+	if copied.Status == nil {
+		copied.Status = aws.String(eks.ClusterStatusActive)
+	}
+	if copied.Arn == nil {
+		copied.Arn = aws.String(c.arn("eks", "cluster/"+aws.StringValue(in.Name)))
+	}
+	c.clusters[aws.StringValue(in.Name)] = &cluster{
+		cluster:         &copied,
+		nodegroups:      make(map[string]*eks.Nodegroup),
+		addons:          make(map[string]*awsapi.Addon),
+		fargateProfiles: make(map[string]*eks.FargateProfile),
+		pending:         make(map[string]*pendingUpdate),
+		updates:         make(map[string]*eks.Update),
+	}
+}
+
+// AddNodegroup seeds EKS node group in already seeded cluster. Status
+// defaults to ACTIVE and version to the version of the cluster.
+func (c *Cloud) AddNodegroup(in *eks.Nodegroup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *in
+	cl := c.clusters[aws.StringValue(in.ClusterName)]
+	if copied.Status == nil {
+		copied.Status = aws.String(eks.NodegroupStatusActive)
+	}
+	if copied.Version == nil {
+		copied.Version = cl.cluster.Version
+	}
+	cl.nodegroups[aws.StringValue(in.NodegroupName)] = &copied
+}
+
+func (c *Cloud) DescribeCluster(in *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	leave, err := c.enter("DescribeCluster")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	cl, ok := c.clusters[aws.StringValue(in.Name)]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", aws.StringValue(in.Name))
+	}
+	cl.advance("")
+	copied := *cl.cluster
+	return &eks.DescribeClusterOutput{Cluster: &copied}, nil
+}
+
+// AddAddon seeds managed add-on in already seeded cluster. Status defaults
+// to ACTIVE.
+func (c *Cloud) AddAddon(clusterName string, in *awsapi.Addon) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *in
+	if copied.Status == nil {
+		copied.Status = aws.String(awsapi.AddonStatusActive)
+	}
+	c.clusters[clusterName].addons[aws.StringValue(in.AddonName)] = &copied
+}
+
+func (c *Cloud) DescribeAddon(in *awsapi.DescribeAddonInput) (*awsapi.DescribeAddonOutput, error) {
+	leave, err := c.enter("DescribeAddon")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.AddonName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	addon, ok := cl.addons[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No addon: %s found in cluster: %s", name, clusterName)
+	}
+	copied := *addon
+	return &awsapi.DescribeAddonOutput{Addon: &copied}, nil
+}
+
+// AddFargateProfile seeds Fargate profile in already seeded cluster. Status
+// defaults to ACTIVE.
+func (c *Cloud) AddFargateProfile(in *eks.FargateProfile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *in
+	if copied.Status == nil {
+		copied.Status = aws.String(eks.FargateProfileStatusActive)
+	}
+	c.clusters[aws.StringValue(in.ClusterName)].fargateProfiles[aws.StringValue(in.FargateProfileName)] = &copied
+}
+
+func (c *Cloud) DescribeFargateProfile(in *eks.DescribeFargateProfileInput) (*eks.DescribeFargateProfileOutput, error) {
+	leave, err := c.enter("DescribeFargateProfile")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.FargateProfileName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	profile, ok := cl.fargateProfiles[name]
+	if ok && aws.StringValue(profile.Status) == eks.FargateProfileStatusDeleting {
+		delete(cl.fargateProfiles, name)
+		ok = false
+	}
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No Fargate Profile found with name: %s.", name)
+	}
+	copied := *profile
+	return &eks.DescribeFargateProfileOutput{FargateProfile: &copied}, nil
+}
+
+func (c *Cloud) ListFargateProfilesPages(in *eks.ListFargateProfilesInput, fn func(*eks.ListFargateProfilesOutput, bool) bool) error {
+	leave, err := c.enter("ListFargateProfiles")
+	defer leave()
+	if err != nil {
+		return err
+	}
+
+	cl, ok := c.clusters[aws.StringValue(in.ClusterName)]
+	if !ok {
+		return newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", aws.StringValue(in.ClusterName))
+	}
+	var names []string
+	for name := range cl.fargateProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListFargateProfilesOutput{FargateProfileNames: aws.StringSlice(names)}, true)
+	return nil
+}
+
+// DeleteFargateProfile moves profile to DELETING state. Like in AWS, it fails
+// while another profile of the cluster is being deleted.
+func (c *Cloud) DeleteFargateProfile(in *eks.DeleteFargateProfileInput) (*eks.DeleteFargateProfileOutput, error) {
+	leave, err := c.enter("DeleteFargateProfile")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.FargateProfileName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	profile, ok := cl.fargateProfiles[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No Fargate Profile found with name: %s.", name)
+	}
+	for other, p := range cl.fargateProfiles {
+		if aws.StringValue(p.Status) == eks.FargateProfileStatusDeleting {
+			return nil, newError(eks.ErrCodeResourceInUseException, "Cannot delete Fargate Profile %s because Fargate Profile %s is deleting", name, other)
+		}
+	}
+	profile.Status = aws.String(eks.FargateProfileStatusDeleting)
+	c.record("DeleteFargateProfile", name)
+	return &eks.DeleteFargateProfileOutput{FargateProfile: profile}, nil
+}
+
+func (c *Cloud) DescribeNodegroup(in *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+	leave, err := c.enter("DescribeNodegroup")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.NodegroupName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	ng, ok := cl.nodegroups[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No node group found for name: %s.", name)
+	}
+	cl.advance(name)
+	copied := *ng
+	return &eks.DescribeNodegroupOutput{Nodegroup: &copied}, nil
+}
+
+func (c *Cloud) ListClustersPages(in *eks.ListClustersInput, fn func(*eks.ListClustersOutput, bool) bool) error {
+	leave, err := c.enter("ListClusters")
+	defer leave()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range c.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListClustersOutput{Clusters: aws.StringSlice(names)}, true)
+	return nil
+}
+
+func (c *Cloud) ListNodegroupsPages(in *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+	leave, err := c.enter("ListNodegroups")
+	defer leave()
+	if err != nil {
+		return err
+	}
+
+	cl, ok := c.clusters[aws.StringValue(in.ClusterName)]
+	if !ok {
+		return newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", aws.StringValue(in.ClusterName))
+	}
+	var names []string
+	for name := range cl.nodegroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListNodegroupsOutput{Nodegroups: aws.StringSlice(names)}, true)
+	return nil
+}
+
+// UpdateClusterVersion starts update of the control plane, which like in AWS
+// has to be ACTIVE and can be upgraded only to the next minor version.
+func (c *Cloud) UpdateClusterVersion(in *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error) {
+	leave, err := c.enter("UpdateClusterVersion")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name, version := aws.StringValue(in.Name), aws.StringValue(in.Version)
+	cl, ok := c.clusters[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", name)
+	}
+	if status := aws.StringValue(cl.cluster.Status); status != eks.ClusterStatusActive {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Cluster is in %s state and cannot be updated.", status)
+	}
+	if _, ok := cl.pending[""]; ok {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Cluster already has update in progress.")
+	}
+	current := aws.StringValue(cl.cluster.Version)
+	if version != nextMinor(current) {
+		return nil, newError(eks.ErrCodeInvalidParameterException, "Unsupported Kubernetes minor version update from %s to %s", current, version)
+	}
+	if c.ActivePolls == 0 {
+		cl.cluster.Status = aws.String(eks.ClusterStatusUpdating)
+	}
+	p := c.newPendingUpdate(cl, version)
+	cl.pending[""] = p
+	c.record("UpdateClusterVersion", name+" "+version)
+	copied := *p.update
+	return &eks.UpdateClusterVersionOutput{Update: &copied}, nil
+}
+
+// UpdateNodegroupVersion starts update of node group to the version of the
+// control plane, which is the only version allowed by AWS.
+func (c *Cloud) UpdateNodegroupVersion(in *eks.UpdateNodegroupVersionInput) (*eks.UpdateNodegroupVersionOutput, error) {
+	leave, err := c.enter("UpdateNodegroupVersion")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.NodegroupName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	ng, ok := cl.nodegroups[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No node group found for name: %s.", name)
+	}
+	if status := aws.StringValue(ng.Status); status != eks.NodegroupStatusActive {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Nodegroup is in %s state and cannot be updated.", status)
+	}
+	if _, ok := cl.pending[name]; ok {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Nodegroup already has update in progress.")
+	}
+	version := aws.StringValue(cl.cluster.Version)
+	if in.Version != nil && aws.StringValue(in.Version) != version {
+		return nil, newError(eks.ErrCodeInvalidParameterException, "Requested Nodegroup version %s is invalid. Allowed version is %s", aws.StringValue(in.Version), version)
+	}
+	if c.ActivePolls == 0 {
+		ng.Status = aws.String(eks.NodegroupStatusUpdating)
+	}
+	p := c.newPendingUpdate(cl, version)
+	cl.pending[name] = p
+	c.record("UpdateNodegroupVersion", name+" "+version)
+	copied := *p.update
+	return &eks.UpdateNodegroupVersionOutput{Update: &copied}, nil
+}
+
+// FailNextUpdate makes the next version update fail with error code and
+// message once it is finished.
+func (c *Cloud) FailNextUpdate(code, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updateFailure = &eks.ErrorDetail{ErrorCode: aws.String(code), ErrorMessage: aws.String(message)}
+}
+
+// newPendingUpdate has to be called with the lock held.
+func (c *Cloud) newPendingUpdate(cl *cluster, version string) *pendingUpdate {
+	c.updates++
+	update := &eks.Update{
+		Id:     aws.String(fmt.Sprintf("update-%d", c.updates)),
+		Status: aws.String(eks.UpdateStatusInProgress),
+		Type:   aws.String(eks.UpdateTypeVersionUpdate),
+	}
+	cl.updates[aws.StringValue(update.Id)] = update
+	p := &pendingUpdate{version: version, active: c.ActivePolls, polls: c.UpdatingPolls, update: update, failure: c.updateFailure}
+	c.updateFailure = nil
+	return p
+}
+
+func (c *Cloud) DescribeUpdate(in *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error) {
+	leave, err := c.enter("DescribeUpdate")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name, id := aws.StringValue(in.Name), aws.StringValue(in.UpdateId)
+	cl, ok := c.clusters[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", name)
+	}
+	update, ok := cl.updates[id]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No update found for ID: %s.", id)
+	}
+	copied := *update
+	return &eks.DescribeUpdateOutput{Update: &copied}, nil
+}
+
+// nextMinor returns version with minor part incremented, e.g. "1.19" for
+// "1.18".
+func nextMinor(version string) string {
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s.%d", parts[0], minor+1)
+}
+
+func (c *Cloud) DeleteNodegroup(in *eks.DeleteNodegroupInput) (*eks.DeleteNodegroupOutput, error) {
+	leave, err := c.enter("DeleteNodegroup")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, name := aws.StringValue(in.ClusterName), aws.StringValue(in.NodegroupName)
+	cl, ok := c.clusters[clusterName]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", clusterName)
+	}
+	if _, ok := cl.nodegroups[name]; !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No node group found for name: %s.", name)
+	}
+	delete(cl.nodegroups, name)
+	c.record("DeleteNodegroup", name)
+	return &eks.DeleteNodegroupOutput{}, nil
+}
+
+func (c *Cloud) WaitUntilNodegroupDeleted(*eks.DescribeNodegroupInput) error {
+	leave, err := c.enter("WaitUntilNodegroupDeleted")
+	defer leave()
+	return err
+}
+
+func (c *Cloud) DeleteCluster(in *eks.DeleteClusterInput) (*eks.DeleteClusterOutput, error) {
+	leave, err := c.enter("DeleteCluster")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.Name)
+	cl, ok := c.clusters[name]
+	if !ok {
+		return nil, newError(eks.ErrCodeResourceNotFoundException, "No cluster found for name: %s.", name)
+	}
+	if len(cl.nodegroups) > 0 {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Cluster has nodegroups attached")
+	}
+	if len(cl.fargateProfiles) > 0 {
+		return nil, newError(eks.ErrCodeResourceInUseException, "Cluster has fargate profiles attached")
+	}
+	delete(c.clusters, name)
+	c.record("DeleteCluster", name)
+	return &eks.DeleteClusterOutput{}, nil
+}
+
+func (c *Cloud) WaitUntilClusterDeleted(*eks.DescribeClusterInput) error {
+	leave, err := c.enter("WaitUntilClusterDeleted")
+	defer leave()
+	return err
+}
@@ -0,0 +1,222 @@
+// Package fake provides an in-memory implementation of awsapi interfaces.
+//
+// Cloud is seeded with resources using Add* methods and then behaves like a
+// tiny AWS account: it returns the same error codes as AWS for missing
+// resources and for dependency violations, deletes NAT gateways
+// asynchronously and allows to inject failures of selected operations. It is
+// safe for concurrent use.
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+var (
+	_ awsapi.EC2API            = (*Cloud)(nil)
+	_ awsapi.EKSAPI            = (*Cloud)(nil)
+	_ awsapi.EKSAddonsAPI      = (*Cloud)(nil)
+	_ awsapi.IAMAPI            = (*Cloud)(nil)
+	_ awsapi.KMSAPI            = (*Cloud)(nil)
+	_ awsapi.CloudWatchLogsAPI = (*Cloud)(nil)
+	_ awsapi.ResourceGroupsAPI = (*Cloud)(nil)
+	_ awsapi.ServiceQuotasAPI  = (*Cloud)(nil)
+)
+
+// Cloud is an in-memory AWS account in a single region.
+type Cloud struct {
+	// Region is used to build ARNs of seeded resources.
+	Region string
+	// AccountID is used to build ARNs of seeded resources.
+	AccountID string
+	// Delay is applied to every call outside of the internal lock, so
+	// concurrent callers really overlap.
+	Delay time.Duration
+	// NatGatewayDeletingPolls is the number of DescribeNatGateways calls for
+	// which deleted NAT gateway stays in deleting state.
+	NatGatewayDeletingPolls int
+	// AvailabilityZones are zones of Region reported as available.
+	AvailabilityZones []string
+	// UpdatingPolls is the number of DescribeCluster or DescribeNodegroup
+	// calls for which cluster or node group stays in UPDATING state after
+	// version update.
+	UpdatingPolls int
+	// ActivePolls is the number of DescribeCluster or DescribeNodegroup
+	// calls right after version update for which cluster or node group is
+	// still reported ACTIVE in the old version. Another update is rejected
+	// until the pending one is finished.
+	ActivePolls int
+
+	mu        sync.Mutex
+	calls     []string
+	failures  map[string][]string
+	active    int
+	maxActive int
+	updates   int
+	// updateFailure is set by FailNextUpdate.
+	updateFailure *eks.ErrorDetail
+
+	vpcs                  map[string]*vpc
+	subnets               map[string]*subnet
+	securityGroups        map[string]*securityGroup
+	routeTables           map[string]*routeTable
+	internetGateways      map[string]*internetGateway
+	natGateways           map[string]*natGateway
+	addresses             map[string]*address
+	networkInterfaces     map[string]*networkInterface
+	instances             map[string]*instance
+	keyPairs              map[string]bool
+	launchTemplates       map[string]bool
+	instanceTypeOfferings map[string][]string
+	serviceQuotas         map[string]float64
+	clusters              map[string]*cluster
+	roles                 map[string]*role
+	oidcProviders         map[string]string
+	policies              map[string]*policy
+	kmsKeys               map[string]*kmsKey
+	kmsAliases            map[string]string
+	logGroups             map[string]*logGroup
+	resourceGroups        map[string][]groupResource
+}
+
+// New creates empty Cloud.
+func New() *Cloud {
+	return &Cloud{
+		Region:                "eu-central-1",
+		AccountID:             "123456789012",
+		AvailabilityZones:     []string{"eu-central-1a", "eu-central-1b", "eu-central-1c"},
+		failures:              make(map[string][]string),
+		vpcs:                  make(map[string]*vpc),
+		subnets:               make(map[string]*subnet),
+		securityGroups:        make(map[string]*securityGroup),
+		routeTables:           make(map[string]*routeTable),
+		internetGateways:      make(map[string]*internetGateway),
+		natGateways:           make(map[string]*natGateway),
+		addresses:             make(map[string]*address),
+		networkInterfaces:     make(map[string]*networkInterface),
+		instances:             make(map[string]*instance),
+		keyPairs:              make(map[string]bool),
+		launchTemplates:       make(map[string]bool),
+		instanceTypeOfferings: make(map[string][]string),
+		serviceQuotas:         make(map[string]float64),
+		clusters:              make(map[string]*cluster),
+		roles:                 make(map[string]*role),
+		oidcProviders:         make(map[string]string),
+		policies:              make(map[string]*policy),
+		kmsKeys:               make(map[string]*kmsKey),
+		kmsAliases:            make(map[string]string),
+		logGroups:             make(map[string]*logGroup),
+		resourceGroups:        make(map[string][]groupResource),
+	}
+}
+
+// Clients returns awsapi.Clients backed by this Cloud.
+func (c *Cloud) Clients() awsapi.Clients {
+	return awsapi.Clients{
+		EC2:            c,
+		EKS:            c,
+		EKSAddons:      c,
+		IAM:            c,
+		KMS:            c,
+		CloudWatchLogs: c,
+		ResourceGroups: c,
+		ServiceQuotas:  c,
+	}
+}
+
+// FailNext makes the next times calls of operation (e.g. "DeleteSubnet")
+// fail with AWS error of provided code.
+func (c *Cloud) FailNext(operation, code string, times int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < times; i++ {
+		c.failures[operation] = append(c.failures[operation], code)
+	}
+}
+
+// Calls returns successful mutating calls in order they were made, formatted
+// as "Operation resource-id".
+func (c *Cloud) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// CallIndex returns position of call in Calls or -1 when it was not made.
+func (c *Cloud) CallIndex(call string) int {
+	for i, made := range c.Calls() {
+		if made == call {
+			return i
+		}
+	}
+	return -1
+}
+
+// MaxConcurrentCalls returns the highest number of calls observed in
+// progress at the same time.
+func (c *Cloud) MaxConcurrentCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxActive
+}
+
+// enter marks beginning of an operation, waits Delay and acquires the lock.
+// Returned function has to be deferred. Error is returned when a failure was
+// injected for the operation.
+func (c *Cloud) enter(operation string) (func(), error) {
+	c.mu.Lock()
+	c.active++
+	if c.active > c.maxActive {
+		c.maxActive = c.active
+	}
+	c.mu.Unlock()
+
+	time.Sleep(c.Delay)
+
+	c.mu.Lock()
+	leave := func() {
+		c.active--
+		c.mu.Unlock()
+	}
+	if codes := c.failures[operation]; len(codes) > 0 {
+		c.failures[operation] = codes[1:]
+		return leave, newError(codes[0], "injected failure of %s", operation)
+	}
+	return leave, nil
+}
+
+// record has to be called with the lock held.
+func (c *Cloud) record(operation, id string) {
+	c.calls = append(c.calls, operation+" "+id)
+}
+
+func (c *Cloud) arn(service, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, c.Region, c.AccountID, resource)
+}
+
+func newError(code, format string, args ...interface{}) error {
+	return awserr.New(code, fmt.Sprintf(format, args...), nil)
+}
+
+func tagsMatch(tags map[string]string, key string, values []*string) bool {
+	v, ok := tags[strings.TrimPrefix(key, "tag:")]
+	if !ok {
+		return false
+	}
+	return containsValue(values, v)
+}
+
+func containsValue(values []*string, v string) bool {
+	for _, value := range values {
+		if value != nil && *value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+type role struct {
+	attachedPolicies []string
+	inlinePolicies   []string
+}
+
+// AddRole seeds IAM role with attached managed policies and inline policies.
+func (c *Cloud) AddRole(name string, attachedPolicyArns, inlinePolicyNames []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roles[name] = &role{attachedPolicies: attachedPolicyArns, inlinePolicies: inlinePolicyNames}
+}
+
+type policy struct {
+	name string
+	// versions are ids of non-default versions, default version is v1.
+	versions []string
+}
+
+// AddPolicy seeds customer managed IAM policy with additional non-default
+// versions and returns its ARN, which can be attached to roles with AddRole.
+func (c *Cloud) AddPolicy(name string, versions ...string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	arn := fmt.Sprintf("arn:aws:iam::%s:policy/%s", c.AccountID, name)
+	c.policies[arn] = &policy{name: name, versions: versions}
+	return arn
+}
+
+// AddOpenIDConnectProvider seeds IAM OpenID Connect provider for issuer url
+// and returns its ARN.
+func (c *Cloud) AddOpenIDConnectProvider(url string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// AWS stores provider url without scheme.
+	url = strings.TrimPrefix(url, "https://")
+	arn := fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", c.AccountID, url)
+	c.oidcProviders[arn] = url
+	return arn
+}
+
+func (c *Cloud) getRole(name string) (*role, error) {
+	r, ok := c.roles[name]
+	if !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "The role with name %s cannot be found.", name)
+	}
+	return r, nil
+}
+
+func (c *Cloud) GetRole(in *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	leave, err := c.enter("GetRole")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.RoleName)
+	if _, err := c.getRole(name); err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: &iam.Role{
+		RoleName: aws.String(name),
+		Arn:      aws.String(fmt.Sprintf("arn:aws:iam::%s:role/%s", c.AccountID, name)),
+	}}, nil
+}
+
+func (c *Cloud) GetOpenIDConnectProvider(in *iam.GetOpenIDConnectProviderInput) (*iam.GetOpenIDConnectProviderOutput, error) {
+	leave, err := c.enter("GetOpenIDConnectProvider")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	arn := aws.StringValue(in.OpenIDConnectProviderArn)
+	url, ok := c.oidcProviders[arn]
+	if !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "OpenIDConnect Provider not found for arn %s", arn)
+	}
+	return &iam.GetOpenIDConnectProviderOutput{
+		Url:          aws.String(url),
+		ClientIDList: aws.StringSlice([]string{"sts.amazonaws.com"}),
+	}, nil
+}
+
+func (c *Cloud) ListAttachedRolePolicies(in *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	leave, err := c.enter("ListAttachedRolePolicies")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.getRole(aws.StringValue(in.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListAttachedRolePoliciesOutput{}
+	for _, arn := range r.attachedPolicies {
+		out.AttachedPolicies = append(out.AttachedPolicies, &iam.AttachedPolicy{PolicyArn: aws.String(arn)})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DetachRolePolicy(in *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	leave, err := c.enter("DetachRolePolicy")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.getRole(aws.StringValue(in.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	r.attachedPolicies = without(r.attachedPolicies, aws.StringValue(in.PolicyArn))
+	c.record("DetachRolePolicy", aws.StringValue(in.PolicyArn))
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (c *Cloud) ListRolePolicies(in *iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error) {
+	leave, err := c.enter("ListRolePolicies")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.getRole(aws.StringValue(in.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRolePoliciesOutput{PolicyNames: aws.StringSlice(r.inlinePolicies)}, nil
+}
+
+func (c *Cloud) DeleteRolePolicy(in *iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error) {
+	leave, err := c.enter("DeleteRolePolicy")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.getRole(aws.StringValue(in.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	r.inlinePolicies = without(r.inlinePolicies, aws.StringValue(in.PolicyName))
+	c.record("DeleteRolePolicy", aws.StringValue(in.PolicyName))
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func (c *Cloud) DeleteRole(in *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	leave, err := c.enter("DeleteRole")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.RoleName)
+	r, err := c.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.attachedPolicies) > 0 || len(r.inlinePolicies) > 0 {
+		return nil, newError(iam.ErrCodeDeleteConflictException, "Cannot delete entity, must detach all policies first.")
+	}
+	delete(c.roles, name)
+	c.record("DeleteRole", name)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func (c *Cloud) getPolicy(arn string) (*policy, error) {
+	p, ok := c.policies[arn]
+	if !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "Policy %s does not exist or is not attachable.", arn)
+	}
+	return p, nil
+}
+
+// ListPoliciesPages returns customer managed policies sorted by name in a
+// single page.
+func (c *Cloud) ListPoliciesPages(in *iam.ListPoliciesInput, fn func(*iam.ListPoliciesOutput, bool) bool) error {
+	leave, err := c.enter("ListPolicies")
+	defer leave()
+	if err != nil {
+		return err
+	}
+
+	out := &iam.ListPoliciesOutput{}
+	for arn, p := range c.policies {
+		out.Policies = append(out.Policies, &iam.Policy{Arn: aws.String(arn), PolicyName: aws.String(p.name)})
+	}
+	sort.Slice(out.Policies, func(i, j int) bool {
+		return aws.StringValue(out.Policies[i].PolicyName) < aws.StringValue(out.Policies[j].PolicyName)
+	})
+	fn(out, true)
+	return nil
+}
+
+func (c *Cloud) ListPolicyVersions(in *iam.ListPolicyVersionsInput) (*iam.ListPolicyVersionsOutput, error) {
+	leave, err := c.enter("ListPolicyVersions")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := c.getPolicy(aws.StringValue(in.PolicyArn))
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListPolicyVersionsOutput{Versions: []*iam.PolicyVersion{{VersionId: aws.String("v1"), IsDefaultVersion: aws.Bool(true)}}}
+	for _, id := range p.versions {
+		out.Versions = append(out.Versions, &iam.PolicyVersion{VersionId: aws.String(id), IsDefaultVersion: aws.Bool(false)})
+	}
+	return out, nil
+}
+
+func (c *Cloud) DeletePolicyVersion(in *iam.DeletePolicyVersionInput) (*iam.DeletePolicyVersionOutput, error) {
+	leave, err := c.enter("DeletePolicyVersion")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := c.getPolicy(aws.StringValue(in.PolicyArn))
+	if err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(in.VersionId)
+	if id == "v1" {
+		return nil, newError(iam.ErrCodeDeleteConflictException, "Cannot delete the default version of a policy.")
+	}
+	p.versions = without(p.versions, id)
+	c.record("DeletePolicyVersion", p.name+" "+id)
+	return &iam.DeletePolicyVersionOutput{}, nil
+}
+
+func (c *Cloud) DeletePolicy(in *iam.DeletePolicyInput) (*iam.DeletePolicyOutput, error) {
+	leave, err := c.enter("DeletePolicy")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	arn := aws.StringValue(in.PolicyArn)
+	p, err := c.getPolicy(arn)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.roles {
+		for _, attached := range r.attachedPolicies {
+			if attached == arn {
+				return nil, newError(iam.ErrCodeDeleteConflictException, "Cannot delete a policy attached to entities.")
+			}
+		}
+	}
+	if len(p.versions) > 0 {
+		return nil, newError(iam.ErrCodeDeleteConflictException, "This policy has more than one version. Before you delete a policy, you must delete the policy's versions. The default version is deleted with the policy.")
+	}
+	delete(c.policies, arn)
+	c.record("DeletePolicy", p.name)
+	return &iam.DeletePolicyOutput{}, nil
+}
+
+func (c *Cloud) DeleteOpenIDConnectProvider(in *iam.DeleteOpenIDConnectProviderInput) (*iam.DeleteOpenIDConnectProviderOutput, error) {
+	leave, err := c.enter("DeleteOpenIDConnectProvider")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	arn := aws.StringValue(in.OpenIDConnectProviderArn)
+	if _, ok := c.oidcProviders[arn]; !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "OpenIDConnect Provider not found for arn %s", arn)
+	}
+	delete(c.oidcProviders, arn)
+	c.record("DeleteOpenIDConnectProvider", arn)
+	return &iam.DeleteOpenIDConnectProviderOutput{}, nil
+}
+
+func without(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
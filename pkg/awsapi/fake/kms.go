@@ -0,0 +1,93 @@
+package fake
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+type kmsKey struct {
+	state string
+}
+
+// AddKMSKey seeds enabled KMS key with aliases (e.g. "alias/ks-eks-secrets").
+func (c *Cloud) AddKMSKey(id string, aliases ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kmsKeys[id] = &kmsKey{state: kms.KeyStateEnabled}
+	for _, alias := range aliases {
+		c.kmsAliases[alias] = id
+	}
+}
+
+// resolveKey returns id of key identified by id or alias name.
+func (c *Cloud) resolveKey(keyID string) (string, error) {
+	if strings.HasPrefix(keyID, "alias/") {
+		id, ok := c.kmsAliases[keyID]
+		if !ok {
+			return "", newError(kms.ErrCodeNotFoundException, "Alias %s is not found.", c.arn("kms", keyID))
+		}
+		return id, nil
+	}
+	if _, ok := c.kmsKeys[keyID]; !ok {
+		return "", newError(kms.ErrCodeNotFoundException, "Key '%s' does not exist", c.arn("kms", "key/"+keyID))
+	}
+	return keyID, nil
+}
+
+func (c *Cloud) DescribeKey(in *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+	leave, err := c.enter("DescribeKey")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.resolveKey(aws.StringValue(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: &kms.KeyMetadata{
+		KeyId:    aws.String(id),
+		Arn:      aws.String(c.arn("kms", "key/"+id)),
+		KeyState: aws.String(c.kmsKeys[id].state),
+	}}, nil
+}
+
+func (c *Cloud) DeleteAlias(in *kms.DeleteAliasInput) (*kms.DeleteAliasOutput, error) {
+	leave, err := c.enter("DeleteAlias")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	alias := aws.StringValue(in.AliasName)
+	if _, ok := c.kmsAliases[alias]; !ok {
+		return nil, newError(kms.ErrCodeNotFoundException, "Alias %s is not found.", c.arn("kms", alias))
+	}
+	delete(c.kmsAliases, alias)
+	c.record("DeleteAlias", alias)
+	return &kms.DeleteAliasOutput{}, nil
+}
+
+// ScheduleKeyDeletion moves key to PendingDeletion state, like in AWS it
+// cannot be scheduled again.
+func (c *Cloud) ScheduleKeyDeletion(in *kms.ScheduleKeyDeletionInput) (*kms.ScheduleKeyDeletionOutput, error) {
+	leave, err := c.enter("ScheduleKeyDeletion")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.resolveKey(aws.StringValue(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	key := c.kmsKeys[id]
+	if key.state == kms.KeyStatePendingDeletion {
+		return nil, newError(kms.ErrCodeInvalidStateException, "%s is pending deletion.", c.arn("kms", "key/"+id))
+	}
+	key.state = kms.KeyStatePendingDeletion
+	c.record("ScheduleKeyDeletion", id)
+	return &kms.ScheduleKeyDeletionOutput{KeyId: aws.String(id)}, nil
+}
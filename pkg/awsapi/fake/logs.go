@@ -0,0 +1,61 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+type logGroup struct {
+	retentionInDays int64
+}
+
+// AddLogGroup seeds CloudWatch log group.
+func (c *Cloud) AddLogGroup(name string, retentionInDays int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logGroups[name] = &logGroup{retentionInDays: retentionInDays}
+}
+
+func (c *Cloud) DescribeLogGroups(in *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	leave, err := c.enter("DescribeLogGroups")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range c.logGroups {
+		if strings.HasPrefix(name, aws.StringValue(in.LogGroupNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for _, name := range names {
+		lg := &cloudwatchlogs.LogGroup{LogGroupName: aws.String(name)}
+		if retention := c.logGroups[name].retentionInDays; retention > 0 {
+			lg.RetentionInDays = aws.Int64(retention)
+		}
+		out.LogGroups = append(out.LogGroups, lg)
+	}
+	return out, nil
+}
+
+func (c *Cloud) DeleteLogGroup(in *cloudwatchlogs.DeleteLogGroupInput) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	leave, err := c.enter("DeleteLogGroup")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.LogGroupName)
+	if _, ok := c.logGroups[name]; !ok {
+		return nil, newError(cloudwatchlogs.ErrCodeResourceNotFoundException, "The specified log group does not exist.")
+	}
+	delete(c.logGroups, name)
+	c.record("DeleteLogGroup", name)
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
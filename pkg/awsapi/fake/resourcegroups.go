@@ -0,0 +1,61 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/resourcegroups"
+)
+
+type groupResource struct {
+	resourceType string
+	id           string
+}
+
+// AddToResourceGroup registers EC2 resource of type (e.g. "Subnet") in
+// resource group, creating the group when needed.
+func (c *Cloud) AddToResourceGroup(group, resourceType, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resourceGroups[group] = append(c.resourceGroups[group], groupResource{resourceType: resourceType, id: id})
+}
+
+func (c *Cloud) ListGroupResourcesPages(in *resourcegroups.ListGroupResourcesInput, fn func(*resourcegroups.ListGroupResourcesOutput, bool) bool) error {
+	leave, err := c.enter("ListGroupResources")
+	defer leave()
+	if err != nil {
+		return err
+	}
+
+	name := aws.StringValue(in.GroupName)
+	resources, ok := c.resourceGroups[name]
+	if !ok {
+		return newError(resourcegroups.ErrCodeNotFoundException, "Cannot find group %s.", name)
+	}
+	out := &resourcegroups.ListGroupResourcesOutput{}
+	for _, r := range resources {
+		out.ResourceIdentifiers = append(out.ResourceIdentifiers, &resourcegroups.ResourceIdentifier{
+			ResourceType: aws.String("AWS::EC2::" + r.resourceType),
+			ResourceArn:  aws.String(c.arn("ec2", fmt.Sprintf("%s/%s", strings.ToLower(r.resourceType), r.id))),
+		})
+	}
+	fn(out, true)
+	return nil
+}
+
+func (c *Cloud) DeleteGroup(in *resourcegroups.DeleteGroupInput) (*resourcegroups.DeleteGroupOutput, error) {
+	leave, err := c.enter("DeleteGroup")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.GroupName)
+	if _, ok := c.resourceGroups[name]; !ok {
+		return nil, newError(resourcegroups.ErrCodeNotFoundException, "Cannot find group %s.", name)
+	}
+	delete(c.resourceGroups, name)
+	c.record("DeleteGroup", name)
+	return &resourcegroups.DeleteGroupOutput{}, nil
+}
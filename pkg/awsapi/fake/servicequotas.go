@@ -0,0 +1,33 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+)
+
+// SetServiceQuota seeds applied value of quota. Quotas which were not set
+// are reported as missing, like quotas never adjusted in AWS.
+func (c *Cloud) SetServiceQuota(serviceCode, quotaCode string, value float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serviceQuotas[serviceCode+"/"+quotaCode] = value
+}
+
+func (c *Cloud) GetServiceQuota(in *servicequotas.GetServiceQuotaInput) (*servicequotas.GetServiceQuotaOutput, error) {
+	leave, err := c.enter("GetServiceQuota")
+	defer leave()
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.StringValue(in.ServiceCode) + "/" + aws.StringValue(in.QuotaCode)
+	value, ok := c.serviceQuotas[key]
+	if !ok {
+		return nil, newError(servicequotas.ErrCodeNoSuchResourceException, "quota %s not found", key)
+	}
+	return &servicequotas.GetServiceQuotaOutput{Quota: &servicequotas.ServiceQuota{
+		ServiceCode: in.ServiceCode,
+		QuotaCode:   in.QuotaCode,
+		Value:       aws.Float64(value),
+	}}, nil
+}
@@ -0,0 +1,309 @@
+// Package awsks implements commands of the AWS Kubernetes Service module.
+//
+// Every command is a sequence of steps operating on module configuration
+// file ($M_SHARED/awsks/awsks-config.yml), shared state file
+// ($M_SHARED/state.yml) and terraform files in $M_RESOURCES/terraform. Each
+// step prints a line "#AWSKS | <step> | <description>" before it runs.
+package awsks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/audit"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/upgrade"
+)
+
+const (
+	moduleShort   = "awsks"
+	configName    = "awsks-config.yml"
+	stateFileName = "state.yml"
+)
+
+// DefaultCommand is run when no command is provided.
+const DefaultCommand = "metadata"
+
+// Module runs module commands.
+type Module struct {
+	Vars       Vars
+	Terraform  Terraform
+	Helm       audit.Helm
+	Autoscaler upgrade.Autoscaler
+	// NewClients creates AWS clients used by preflight, audit and upgrade.
+	NewClients func(region string) (awsapi.Clients, error)
+	Stdout     io.Writer
+	Stderr     io.Writer
+}
+
+// New creates Module using terraform and helm binaries, AWS API and standard
+// output.
+func New(vars Vars) *Module {
+	m := &Module{
+		Vars:       vars,
+		Terraform:  ExecTerraform{},
+		Helm:       audit.ExecHelm{},
+		Autoscaler: upgrade.ExecAutoscaler{},
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}
+	m.NewClients = m.awsClients
+	return m
+}
+
+type command struct {
+	description string
+	// required are parameters which have to be set.
+	required []string
+	steps    []func(m *Module) error
+}
+
+var commands = map[string]command{
+	"metadata": {
+		description: "print module metadata",
+		required:    []string{"M_RESOURCES"},
+		steps:       []func(m *Module) error{(*Module).metadata},
+	},
+	"init": {
+		description: "initialize module configuration and state",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).setup,
+			(*Module).validateVersions,
+			(*Module).ensureStateFile,
+			(*Module).templateConfigFile,
+			(*Module).initializeStateFile,
+			(*Module).displayConfigFile,
+		},
+	},
+	"plan": {
+		description: "compare configuration with state and plan changes",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).setup,
+			(*Module).validateConfig,
+			validateState("plan"),
+			(*Module).templateTfvars,
+			(*Module).modulePlan,
+			(*Module).preflight,
+			migrateTerraformState("plan"),
+			(*Module).terraformPlan,
+			(*Module).terraformPlanSummary,
+			(*Module).checkPlannedScaling,
+			(*Module).checkRequiredTags,
+			// Recorded last, so a plan rejected by a check cannot be applied.
+			(*Module).recordPlanFingerprint,
+		},
+	},
+	"apply": {
+		description: "apply planned changes",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).setup,
+			validateState("apply"),
+			(*Module).verifyPlanFingerprint,
+			(*Module).modulePlan,
+			(*Module).guardDestructiveChanges,
+			(*Module).checkPlannedScaling,
+			(*Module).checkRequiredTags,
+			migrateTerraformState("apply"),
+			(*Module).terraformApply,
+			(*Module).updateStateAfterApply,
+			(*Module).terraformOutput,
+		},
+	},
+	"preflight": {
+		description: "check AWS account with read-only calls, run by plan",
+		required:    []string{"M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).validateConfig,
+			(*Module).preflight,
+		},
+	},
+	"validate-config": {
+		description: "validate configuration file",
+		required:    []string{"M_SHARED"},
+		steps:       []func(m *Module) error{(*Module).validateConfig},
+	},
+	"validate-state": {
+		description: "validate state file",
+		required:    []string{"M_SHARED"},
+		steps:       []func(m *Module) error{validateState("validate-state")},
+	},
+	"audit": {
+		description: "compare state with remote components and report drift",
+		required:    []string{"M_SHARED"},
+		steps: []func(m *Module) error{
+			validateState("audit"),
+			(*Module).audit,
+		},
+	},
+	"upgrade": {
+		description: "upgrade cluster to k8s_version one minor version at a time",
+		required:    []string{"M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).validateConfig,
+			validateState("upgrade"),
+			(*Module).upgrade,
+		},
+	},
+	"destroy": {
+		description: "destroy module resources using destroy plan",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).templateTfvars,
+			(*Module).terraformDestroy,
+			(*Module).updateStateAfterDestroy,
+		},
+	},
+	"plan-destroy": {
+		description: "plan destruction of module resources",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps: []func(m *Module) error{
+			(*Module).templateTfvars,
+			(*Module).terraformPlanDestroy,
+		},
+	},
+	"output": {
+		description: "store terraform outputs in state file",
+		required:    []string{"M_RESOURCES", "M_SHARED"},
+		steps:       []func(m *Module) error{(*Module).terraformOutput},
+	},
+	"kubeconfig": {
+		description: "store kubeconfig in $M_SHARED/kubeconfig",
+		required:    []string{"M_SHARED"},
+		steps:       []func(m *Module) error{(*Module).kubeconfig},
+	},
+}
+
+// IsCommand reports whether name is a known command.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Usage returns description of available commands.
+func Usage() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage: awsks [M_NAME=value | --M_NAME=value ...] command [command ...]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-14s %s\n", name, commands[name].description)
+	}
+	return b.String()
+}
+
+// Run runs commands in order and stops at the first failure.
+func (m *Module) Run(names ...string) error {
+	for _, name := range names {
+		if !IsCommand(name) {
+			return fmt.Errorf("unknown command: %s", name)
+		}
+	}
+	for _, name := range names {
+		cmd := commands[name]
+		for _, v := range cmd.required {
+			if m.Vars.Get(v) == "" {
+				return fmt.Errorf("%s: environment variable %s not set", name, v)
+			}
+		}
+		for _, step := range cmd.steps {
+			if err := step(m); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Module) logStep(step, description string) {
+	fmt.Fprintf(m.Stdout, "#AWSKS | %s | %s\n", step, description)
+}
+
+func (m *Module) moduleDir() string {
+	return filepath.Join(m.Vars.Get("M_SHARED"), moduleShort)
+}
+
+func (m *Module) configPath() string {
+	return filepath.Join(m.moduleDir(), configName)
+}
+
+func (m *Module) statePath() string {
+	return filepath.Join(m.Vars.Get("M_SHARED"), stateFileName)
+}
+
+func (m *Module) terraformDir() string {
+	return filepath.Join(m.Vars.Get("M_RESOURCES"), "terraform")
+}
+
+func (m *Module) tfvarsPath() string {
+	return filepath.Join(m.terraformDir(), "vars.tfvars.json")
+}
+
+func (m *Module) tfstatePath() string {
+	return filepath.Join(m.moduleDir(), "terraform.tfstate")
+}
+
+func (m *Module) migratedTfstatePath() string {
+	return filepath.Join(m.moduleDir(), "terraform-migrated.tfstate")
+}
+
+func (m *Module) applyPlanPath() string {
+	return filepath.Join(m.moduleDir(), "terraform-apply.tfplan")
+}
+
+func (m *Module) planFingerprintPath() string {
+	return filepath.Join(m.moduleDir(), "terraform-apply.fingerprint.json")
+}
+
+func (m *Module) planSummaryPath() string {
+	return filepath.Join(m.moduleDir(), "plan-summary.json")
+}
+
+func (m *Module) destroyPlanPath() string {
+	return filepath.Join(m.moduleDir(), "terraform-destroy.tfplan")
+}
+
+func (m *Module) auditReportPath() string {
+	return filepath.Join(m.moduleDir(), "audit-report.json")
+}
+
+func (m *Module) kubeconfigPath() string {
+	return filepath.Join(m.Vars.Get("M_SHARED"), "kubeconfig")
+}
+
+// awsEnv returns environment for terraform commands accessing AWS.
+func (m *Module) awsEnv() []string {
+	return []string{
+		"TF_IN_AUTOMATION=true",
+		"AWS_ACCESS_KEY_ID=" + m.Vars.Get("M_AWS_ACCESS_KEY"),
+		"AWS_SECRET_ACCESS_KEY=" + m.Vars.Get("M_AWS_SECRET_KEY"),
+	}
+}
+
+// awsClients creates AWS clients using M_AWS_ACCESS_KEY and M_AWS_SECRET_KEY
+// when set, or default credentials chain otherwise.
+func (m *Module) awsClients(region string) (awsapi.Clients, error) {
+	config := &aws.Config{Region: aws.String(region)}
+	accessKey, secretKey := m.Vars.Get("M_AWS_ACCESS_KEY"), m.Vars.Get("M_AWS_SECRET_KEY")
+	if accessKey != "unset" && secretKey != "unset" {
+		config.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	s, err := session.NewSession(config)
+	if err != nil {
+		return awsapi.Clients{}, fmt.Errorf("cannot get session: %w", err)
+	}
+	return awsapi.NewClients(s), nil
+}
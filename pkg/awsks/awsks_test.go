@@ -0,0 +1,1190 @@
+package awsks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/audit"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi/fake"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfplan"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/upgrade"
+	"github.com/go-test/deep"
+)
+
+const defaultConfigContent = `kind: awsks-config
+awsks:
+  name: epiphany
+  vpc_id: unset
+  region: eu-central-1
+  k8s_version: "1.18"
+  autoscaler_version: null
+  subnet_ids: null
+  private_route_table_id: unset
+  public_route_table_id: null
+  subnets:
+    count: 2
+    availability_zones: null
+    newbits: 4
+    netnums: null
+    cidrs: null
+    role: private
+  endpoint_private_access: false
+  endpoint_public_access: true
+  public_access_cidrs: null
+  disk_size: 32
+  autoscaler_scale_down_utilization_threshold: 0.65
+  ami_type: AL2_x86_64
+  ssh_access:
+    enabled: false
+    key_name: null
+    public_key_path: null
+    source_security_group_ids: null
+  encryption:
+    enabled: false
+    kms_key_arn: null
+  log_types:
+    - api
+    - audit
+  log_retention_days: 30
+  log_kms_key_id: null
+  tags: {}
+  required_tag_keys: []
+  addons: []
+  fargate_profiles: []
+  worker_groups:
+    - name: default_wg
+      instance_type: t2.small
+      asg_desired_capacity: 1
+      asg_min_size: 1
+      asg_max_size: 1
+`
+
+// validParams are init parameters resulting in valid configuration.
+var validParams = []string{"M_VPC_ID=vpc-1", "M_PRIVATE_ROUTE_TABLE_ID=rtb-1"}
+
+// fakeTerraform records calls and writes prepared output of "terraform
+// output" and "terraform show" commands.
+type fakeTerraform struct {
+	calls  []string
+	output string
+	plan   string
+	err    error
+}
+
+func (f *fakeTerraform) Run(dir string, env []string, stdout, stderr io.Writer, args ...string) error {
+	f.calls = append(f.calls, strings.Join(args, " "))
+	if f.err != nil {
+		return f.err
+	}
+	var output string
+	switch args[0] {
+	case "output":
+		output = f.output
+	case "show":
+		output = f.plan
+	default:
+		return nil
+	}
+	if output == "" {
+		output = "{}"
+	}
+	_, err := io.WriteString(stdout, output)
+	return err
+}
+
+// newTestModule returns module using fake terraform and fake AWS clients
+// passing preflight of validParams.
+func newTestModule(t *testing.T, args ...string) (*Module, *bytes.Buffer, *fakeTerraform) {
+	dir, err := ioutil.TempDir("", "awsks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	resources := filepath.Join(dir, "resources")
+	if err := os.MkdirAll(filepath.Join(resources, "terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	environ := []string{"M_RESOURCES=" + resources, "M_SHARED=" + filepath.Join(dir, "shared")}
+	vars, _, err := ParseArgs(args, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	tf := &fakeTerraform{}
+	cloud := fake.New()
+	cloud.AddVpc("vpc-1", "10.0.0.0/16")
+	for _, instanceType := range []string{"t2.small", "t3.small"} {
+		cloud.AddInstanceTypeOffering(instanceType, cloud.AvailabilityZones...)
+	}
+	m := &Module{Vars: vars, Terraform: tf, Stdout: &stdout, Stderr: ioutil.Discard}
+	m.NewClients = func(string) (awsapi.Clients, error) { return cloud.Clients(), nil }
+	return m, &stdout, tf
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name              string
+		initParams        []string
+		stateContent      string
+		wantConfigContent string
+		wantStateContent  string
+	}{
+		{
+			name:              "init with defaults",
+			wantConfigContent: defaultConfigContent,
+			wantStateContent: `kind: state
+awsks:
+  status: initialized
+`,
+		},
+		{
+			name:       "init with variables",
+			initParams: []string{"M_NAME=value1", "--M_VPC_ID=value2", "--M_REGION", "value3", "M_SUBNET_IDS=[subnet-1, subnet-2]", "M_K8S_VERSION=1.19", "M_AUTOSCALER_VERSION=v1.19.0", "M_SSH_ACCESS=true", "M_SSH_KEY_NAME=nodes"},
+			wantConfigContent: strings.NewReplacer(
+				"name: epiphany", "name: value1",
+				"vpc_id: unset", "vpc_id: value2",
+				"region: eu-central-1", "region: value3",
+				`k8s_version: "1.18"`, `k8s_version: "1.19"`,
+				"autoscaler_version: null", "autoscaler_version: v1.19.0",
+				"subnet_ids: null", "subnet_ids:\n    - subnet-1\n    - subnet-2",
+				"ssh_access:\n    enabled: false", "ssh_access:\n    enabled: true",
+				"key_name: null", "key_name: nodes",
+			).Replace(defaultConfigContent),
+			wantStateContent: `kind: state
+awsks:
+  status: initialized
+`,
+		},
+		{
+			name: "init with state",
+			stateContent: `kind: state
+awsbi:
+  status: applied
+  name: epiphany
+  rsa_pub_path: "/shared/vms_rsa.pub"
+  output:
+    private_ip.value: []
+    private_route_table_id.value: rtb-0ffd4cbe3a8dc8c7b
+    vpc_id.value: vpc-0baa2c4e9e48e608c
+awsks:
+  status: applied
+  name: epiphany
+`,
+			wantConfigContent: strings.NewReplacer(
+				"vpc_id: unset", "vpc_id: vpc-0baa2c4e9e48e608c",
+				"private_route_table_id: unset", "private_route_table_id: rtb-0ffd4cbe3a8dc8c7b",
+			).Replace(defaultConfigContent),
+			wantStateContent: `kind: state
+awsbi:
+  status: applied
+  name: epiphany
+  rsa_pub_path: "/shared/vms_rsa.pub"
+  output:
+    private_ip.value: []
+    private_route_table_id.value: rtb-0ffd4cbe3a8dc8c7b
+    vpc_id.value: vpc-0baa2c4e9e48e608c
+awsks:
+  status: initialized
+  name: epiphany
+`,
+		},
+		{
+			name:       "init with state and ssh access",
+			initParams: []string{"M_SSH_ACCESS=true"},
+			stateContent: `kind: state
+awsbi:
+  status: applied
+  name: epiphany
+  rsa_pub_path: "/shared/vms_rsa.pub"
+  output:
+    private_ip.value: []
+    private_route_table_id.value: rtb-0ffd4cbe3a8dc8c7b
+    vpc_id.value: vpc-0baa2c4e9e48e608c
+`,
+			wantConfigContent: strings.NewReplacer(
+				"vpc_id: unset", "vpc_id: vpc-0baa2c4e9e48e608c",
+				"private_route_table_id: unset", "private_route_table_id: rtb-0ffd4cbe3a8dc8c7b",
+				"ssh_access:\n    enabled: false", "ssh_access:\n    enabled: true",
+				"public_key_path: null", "public_key_path: /shared/vms_rsa.pub",
+			).Replace(defaultConfigContent),
+			wantStateContent: `kind: state
+awsbi:
+  status: applied
+  name: epiphany
+  rsa_pub_path: "/shared/vms_rsa.pub"
+  output:
+    private_ip.value: []
+    private_route_table_id.value: rtb-0ffd4cbe3a8dc8c7b
+    vpc_id.value: vpc-0baa2c4e9e48e608c
+awsks:
+  status: initialized
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, stdout, _ := newTestModule(t, tt.initParams...)
+			writeFile(t, m.statePath(), tt.stateContent)
+
+			if err := m.Run("init"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+
+			wantOutput := `#AWSKS | setup | ensure required directories
+#AWSKS | validate-versions | will check Kubernetes and autoscaler versions
+#AWSKS | ensure-state-file | checks if state file exists
+#AWSKS | template-config-file | will template config file (and backup previous if exists)
+#AWSKS | template-config-file | will replace arguments with values from state file
+#AWSKS | initialize-state-file | will initialize state file
+#AWSKS | display-config-file | config file content is:
+` + tt.wantConfigContent
+			if diff := deep.Equal(stdout.String(), wantOutput); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(readFile(t, m.configPath()), tt.wantConfigContent); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(readFile(t, m.statePath()), tt.wantStateContent); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestInitBacksUpConfig(t *testing.T) {
+	m, _, _ := newTestModule(t)
+	writeFile(t, m.configPath(), "previous")
+
+	if err := m.Run("init"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	if got := readFile(t, m.configPath()+".backup"); got != "previous" {
+		t.Errorf("expected previous config to be backed up, got: %q", got)
+	}
+}
+
+func TestApplyAndDestroy(t *testing.T) {
+	m, _, tf := newTestModule(t, validParams...)
+	if err := m.Run("init", "plan"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	tf.output = `{
+  "cluster_name": {"sensitive": false, "type": "string", "value": "epiphany"},
+  "kubeconfig": {"sensitive": false, "type": "string", "value": "apiVersion: v1\nkind: Config\n"}
+}`
+
+	if err := m.Run("apply", "kubeconfig"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+
+	wantState := "kind: state\nawsks:\n  status: applied\n" +
+		strings.NewReplacer(
+			"kind: awsks-config\nawsks:\n", "",
+			"vpc_id: unset", "vpc_id: vpc-1",
+			"private_route_table_id: unset", "private_route_table_id: rtb-1",
+		).Replace(defaultConfigContent) +
+		`  output:
+    cluster_name.value: epiphany
+    kubeconfig.value: |
+      apiVersion: v1
+      kind: Config
+`
+	if diff := deep.Equal(readFile(t, m.statePath()), wantState); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(readFile(t, m.kubeconfigPath()), "apiVersion: v1\nkind: Config\n"); diff != nil {
+		t.Error(diff)
+	}
+	tfvars := readFile(t, m.tfvarsPath())
+	if !strings.Contains(tfvars, `"name": "epiphany"`) || !strings.Contains(tfvars, `"asg_max_size": 1`) {
+		t.Errorf("unexpected tfvars content: %s", tfvars)
+	}
+
+	if err := m.Run("plan-destroy", "destroy"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	if diff := deep.Equal(readFile(t, m.statePath()), "kind: state\nawsks:\n  status: destroyed\n"); diff != nil {
+		t.Error(diff)
+	}
+
+	wantCalls := []string{
+		fmt.Sprintf("plan -no-color -input=false -var-file=%s -state=%s -out=%s %s", m.tfvarsPath(), m.tfstatePath(), m.applyPlanPath(), m.terraformDir()),
+		fmt.Sprintf("show -no-color -json %s", m.applyPlanPath()),
+		fmt.Sprintf("show -no-color -json %s", m.applyPlanPath()),
+		fmt.Sprintf("show -no-color -json %s", m.applyPlanPath()),
+		fmt.Sprintf("show -no-color -json %s", m.applyPlanPath()),
+		fmt.Sprintf("apply -no-color -input=false -auto-approve -state=%s %s", m.tfstatePath(), m.applyPlanPath()),
+		fmt.Sprintf("output -no-color -json -state=%s", m.tfstatePath()),
+		fmt.Sprintf("plan -destroy -no-color -input=false -var-file=%s -state=%s -out=%s %s", m.tfvarsPath(), m.tfstatePath(), m.destroyPlanPath(), m.terraformDir()),
+		fmt.Sprintf("apply -no-color -input=false -auto-approve -state=%s %s", m.tfstatePath(), m.destroyPlanPath()),
+	}
+	if diff := deep.Equal(tf.calls, wantCalls); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestKubeconfigPrivateOnly(t *testing.T) {
+	m, stdout, tf := newTestModule(t, append(validParams, "M_ENDPOINT_PRIVATE_ACCESS=true", "M_ENDPOINT_PUBLIC_ACCESS=false")...)
+	tf.output = `{
+  "kubeconfig": {"sensitive": false, "type": "string", "value": "apiVersion: v1\nkind: Config\n"},
+  "kubeconfig_private_only": {"sensitive": false, "type": "bool", "value": true}
+}`
+	if err := m.Run("init", "plan", "apply", "kubeconfig"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+
+	tfvars := readFile(t, m.tfvarsPath())
+	for _, field := range []string{`"endpoint_private_access": true`, `"endpoint_public_access": false`, `"public_access_cidrs": null`} {
+		if !strings.Contains(tfvars, field) {
+			t.Errorf("expected tfvars to contain %s, got: %s", field, tfvars)
+		}
+	}
+	want := "#AWSKS | kubeconfig | will store kubeconfig in a file\nPublic API endpoint is disabled, kubeconfig works only from inside VPC vpc-1\n"
+	if !strings.HasSuffix(stdout.String(), want) {
+		t.Errorf("expected output to end with %q, got:\n%s", want, stdout.String())
+	}
+}
+
+func TestPlanSummary(t *testing.T) {
+	m, stdout, tf := newTestModule(t, validParams...)
+	tf.plan = `{"resource_changes": [
+  {"address": "module.control_plane.aws_eks_cluster.eks_cluster", "module_address": "module.control_plane", "mode": "managed", "type": "aws_eks_cluster", "change": {"actions": ["delete", "create"]}},
+  {"address": "aws_subnet.eks_subnet[0]", "mode": "managed", "type": "aws_subnet", "change": {"actions": ["create"]}}
+]}`
+	if err := m.Run("init", "plan"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+
+	var summary tfplan.Summary
+	if err := json.Unmarshal([]byte(readFile(t, m.planSummaryPath())), &summary); err != nil {
+		t.Fatalf("cannot parse plan summary: %v", err)
+	}
+	if diff := deep.Equal(summary.Counts, tfplan.Counts{Create: 1, Replace: 1}); diff != nil {
+		t.Error(diff)
+	}
+	if len(summary.Destructive) != 1 || summary.Destructive[0].Type != "aws_eks_cluster" {
+		t.Errorf("expected cluster replacement to be destructive, got: %+v", summary.Destructive)
+	}
+	for _, line := range []string{
+		"Plan summary: 1 to create, 0 to update, 1 to replace, 0 to delete.",
+		"WARNING: module.control_plane.aws_eks_cluster.eks_cluster will be replaced",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, stdout.String())
+		}
+	}
+}
+
+func TestMigrateTerraformState(t *testing.T) {
+	tests := []struct {
+		name      string
+		module    string
+		wantMoved bool
+	}{
+		{name: "autoscaler without count", module: "module.autoscaler", wantMoved: true},
+		{name: "autoscaler with count", module: "module.autoscaler[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, validParams...)
+			if err := m.Run("init"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+			content := `{"version": 4, "resources": [
+  {"module": "` + tt.module + `", "mode": "managed", "type": "helm_release", "name": "cluster-autoscaler", "instances": [{"attributes": {"name": "cluster-autoscaler"}}]}
+]}`
+			writeFile(t, m.tfstatePath(), content)
+			if err := m.Run("plan"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+
+			// Plan moves resources only in a copy of terraform state.
+			planned := m.tfstatePath()
+			var wantPlanCalls []string
+			if tt.wantMoved {
+				planned = m.migratedTfstatePath()
+				wantPlanCalls = append(wantPlanCalls, "state mv -state="+planned+" module.autoscaler module.autoscaler[0]")
+			}
+			wantPlanCalls = append(wantPlanCalls, fmt.Sprintf("plan -no-color -input=false -var-file=%s -state=%s -out=%s %s", m.tfvarsPath(), planned, m.applyPlanPath(), m.terraformDir()))
+			if diff := deep.Equal(tf.calls[:len(wantPlanCalls)], wantPlanCalls); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(readFile(t, m.tfstatePath()), content); diff != nil {
+				t.Errorf("plan changed terraform state: %v", diff)
+			}
+
+			tf.calls = nil
+			if err := m.Run("apply"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+			var wantApplyCalls []string
+			if tt.wantMoved {
+				wantApplyCalls = append(wantApplyCalls, "state mv -state="+m.tfstatePath()+" module.autoscaler module.autoscaler[0]")
+			}
+			wantApplyCalls = append(wantApplyCalls, fmt.Sprintf("apply -no-color -input=false -auto-approve -state=%s %s", m.tfstatePath(), m.applyPlanPath()))
+			var gotApplyCalls []string
+			for _, call := range tf.calls {
+				if strings.HasPrefix(call, "state ") || strings.HasPrefix(call, "apply ") {
+					gotApplyCalls = append(gotApplyCalls, call)
+				}
+			}
+			if diff := deep.Equal(gotApplyCalls, wantApplyCalls); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPlanSSHPublicKey(t *testing.T) {
+	m, _, _ := newTestModule(t, append(validParams, "M_SSH_ACCESS=true", "M_SSH_PUBLIC_KEY_PATH=vms_rsa.pub")...)
+	writeFile(t, filepath.Join(m.Vars.Get("M_SHARED"), "vms_rsa.pub"), "ssh-rsa AAAAB3NzaC1yc2E test\n")
+	if err := m.Run("init", "plan"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+
+	var tfvars struct {
+		SSHAccess    map[string]interface{} `json:"ssh_access"`
+		SSHPublicKey *string                `json:"ssh_public_key"`
+	}
+	if err := json.Unmarshal([]byte(readFile(t, m.tfvarsPath())), &tfvars); err != nil {
+		t.Fatalf("cannot parse tfvars: %v", err)
+	}
+	wantAccess := map[string]interface{}{
+		"enabled":                   true,
+		"key_name":                  nil,
+		"public_key_path":           "vms_rsa.pub",
+		"source_security_group_ids": nil,
+	}
+	if diff := deep.Equal(tfvars.SSHAccess, wantAccess); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(tfvars.SSHPublicKey, aws.String("ssh-rsa AAAAB3NzaC1yc2E test")); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPlanScaling(t *testing.T) {
+	const workerGroups = "M_WORKER_GROUPS=[{name: wg, instance_type: t3.small, asg_desired_capacity: 2, asg_min_size: 1, asg_max_size: 3}]"
+	nodegroup := func(actions, scaling string) string {
+		return `{"resource_changes": [{"address": "module.nodes.aws_eks_node_group.eks_nodes[0]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group",
+  "change": {"actions": ` + actions + `, "after": {"node_group_name": "wg", "scaling_config": [` + scaling + `]}}}]}`
+	}
+
+	tests := []struct {
+		name    string
+		plan    string
+		wantErr string
+	}{
+		{
+			name: "created as configured",
+			plan: nodegroup(`["create"]`, `{"desired_size": 2, "max_size": 3, "min_size": 1}`),
+		},
+		{
+			name: "desired size of existing group changed by autoscaler",
+			plan: nodegroup(`["no-op"]`, `{"desired_size": 3, "max_size": 3, "min_size": 1}`),
+		},
+		{
+			name: "min and max swapped",
+			plan: nodegroup(`["create"]`, `{"desired_size": 2, "max_size": 1, "min_size": 3}`),
+			wantErr: "plan: planned node group scaling does not match config file:\n" +
+				"  module.nodes.aws_eks_node_group.eks_nodes[0]: min_size is 3, config has 1\n" +
+				"  module.nodes.aws_eks_node_group.eks_nodes[0]: max_size is 1, config has 3",
+		},
+		{
+			name:    "desired size of new group",
+			plan:    nodegroup(`["delete", "create"]`, `{"desired_size": 1, "max_size": 3, "min_size": 1}`),
+			wantErr: "desired_size is 1, config has 2",
+		},
+		{
+			name: "deleted group",
+			plan: `{"resource_changes": [{"address": "module.nodes.aws_eks_node_group.eks_nodes[1]", "mode": "managed", "type": "aws_eks_node_group", "change": {"actions": ["delete"], "after": null}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, append(validParams, workerGroups)...)
+			tf.plan = tt.plan
+			err := m.Run("init", "plan")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Run() failed with: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyRejectedPlan(t *testing.T) {
+	m, _, tf := newTestModule(t, validParams...)
+	if err := m.Run("init", "plan"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	tf.plan = `{"resource_changes": [{"address": "module.nodes.aws_eks_node_group.eks_nodes[0]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group",
+  "change": {"actions": ["create"], "after": {"node_group_name": "default_wg", "scaling_config": [{"desired_size": 1, "max_size": 1, "min_size": 2}]}}}]}`
+	if err := m.Run("plan"); err == nil || !strings.Contains(err.Error(), "planned node group scaling does not match config file") {
+		t.Fatalf("expected plan to be rejected by scaling check, got: %v", err)
+	}
+
+	err := m.Run("apply")
+	if err == nil || !strings.Contains(err.Error(), "missing plan fingerprint, run plan first") {
+		t.Fatalf("expected rejected plan not to be applied, got: %v", err)
+	}
+	for _, call := range tf.calls {
+		if strings.HasPrefix(call, "apply ") {
+			t.Errorf("rejected plan was applied: %s", call)
+		}
+	}
+}
+
+func TestPlanRequiredTags(t *testing.T) {
+	const plan = `{"resource_changes": [
+  {"address": "module.control_plane.aws_eks_cluster.eks_cluster", "mode": "managed", "type": "aws_eks_cluster", "change": {"actions": ["create"], "after": {"tags": {"owner": "data", "resource_group": "epiphany"}}}},
+  {"address": "aws_subnet.eks_subnet[0]", "mode": "managed", "type": "aws_subnet", "change": {"actions": ["create"], "after": {"tags": {"resource_group": "epiphany"}}}}
+]}`
+
+	tests := []struct {
+		name    string
+		params  []string
+		wantErr string
+	}{
+		{
+			name: "no required tag keys",
+		},
+		{
+			name:    "missing required tag key",
+			params:  []string{"M_TAGS={owner: data}", "M_REQUIRED_TAG_KEYS=[owner]"},
+			wantErr: "plan: planned resources lack required tag keys:\n  aws_subnet.eks_subnet[0]: owner",
+		},
+		{
+			name:    "required tag key missing in config",
+			params:  []string{"M_REQUIRED_TAG_KEYS=[owner]"},
+			wantErr: `awsks.tags: missing required tag key "owner"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, append(validParams, tt.params...)...)
+			tf.plan = plan
+			err := m.Run("init", "plan")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Run() failed with: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	m, stdout, tf := newTestModule(t, append(validParams, "M_SUBNET_NETNUMS=[0, 1]")...)
+	cloud := fake.New()
+	cloud.AddVpc("vpc-1", "10.0.0.0/16")
+	cloud.AddSubnet("subnet-a", "vpc-1", "eu-central-1a", "10.0.1.0/24")
+	cloud.AddInstanceTypeOffering("t2.small", "eu-central-1a")
+	m.NewClients = func(string) (awsapi.Clients, error) { return cloud.Clients(), nil }
+
+	err := m.Run("init", "plan")
+	if err == nil || !strings.Contains(err.Error(), "plan: 2 of 6 preflight checks failed: subnet layout, instance types") {
+		t.Errorf("expected failed preflight, got: %v", err)
+	}
+	for _, call := range tf.calls {
+		if strings.HasPrefix(call, "plan") {
+			t.Errorf("terraform plan was run after failed preflight: %s", call)
+		}
+	}
+	for _, want := range []string{
+		"subnet layout       FAIL    10.0.0.0/20 overlaps subnet-a (10.0.1.0/24)",
+		"instance types      FAIL    t2.small is not offered in eu-central-1b",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected output containing %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	// Subnet created by previous apply is replaced by terraform.
+	writeFile(t, m.tfstatePath(), `{"version": 4, "resources": [{"mode": "managed", "type": "aws_subnet", "name": "eks_subnet", "instances": [{"index_key": 0, "attributes": {"id": "subnet-a"}}]}]}`)
+	cloud.AddInstanceTypeOffering("t2.small", "eu-central-1b", "eu-central-1c")
+	if err := m.Run("preflight"); err != nil {
+		t.Errorf("Run() failed with: %v", err)
+	}
+}
+
+func TestApplyDestructiveChanges(t *testing.T) {
+	const plan = `{"resource_changes": [
+  {"address": "module.nodes.aws_eks_node_group.eks_nodes[0]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group", "change": {"actions": ["delete", "create"]}},
+  {"address": "module.nodes.aws_eks_node_group.eks_nodes[1]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group", "change": {"actions": ["delete"]}},
+  {"address": "module.control_plane.aws_cloudwatch_log_group.eks_log_group", "module_address": "module.control_plane", "mode": "managed", "type": "aws_cloudwatch_log_group", "change": {"actions": ["delete", "create"]}}
+]}`
+
+	tests := []struct {
+		name      string
+		params    []string
+		wantApply bool
+		wantErr   string
+	}{
+		{
+			name:    "refused by default",
+			wantErr: "plan contains destructive changes, set M_ALLOW_DESTRUCTIVE=true to apply them:\n  module.nodes.aws_eks_node_group.eks_nodes[0] (replace)\n  module.nodes.aws_eks_node_group.eks_nodes[1] (delete)",
+		},
+		{
+			name:      "allowed by override",
+			params:    []string{"M_ALLOW_DESTRUCTIVE=true"},
+			wantApply: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, append(validParams, tt.params...)...)
+			tf.plan = plan
+			if err := m.Run("init", "plan"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+
+			err := m.Run("apply")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			applied := false
+			for _, call := range tf.calls {
+				if strings.HasPrefix(call, "apply ") {
+					applied = true
+				}
+			}
+			if applied != tt.wantApply {
+				t.Errorf("expected terraform apply to be run: %v, got: %v", tt.wantApply, applied)
+			}
+		})
+	}
+}
+
+func TestApplyPlanChecks(t *testing.T) {
+	const goodPlan = `{"resource_changes": [{"address": "module.nodes.aws_eks_node_group.eks_nodes[0]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group",
+  "change": {"actions": ["create"], "after": {"node_group_name": "wg", "scaling_config": [{"desired_size": 2, "max_size": 3, "min_size": 1}], "tags": {"owner": "data"}}}}]}`
+
+	tests := []struct {
+		name    string
+		params  []string
+		plan    string
+		wantErr string
+	}{
+		{
+			name:   "node group scaling",
+			params: []string{"M_WORKER_GROUPS=[{name: wg, instance_type: t3.small, asg_desired_capacity: 2, asg_min_size: 1, asg_max_size: 3}]"},
+			plan: `{"resource_changes": [{"address": "module.nodes.aws_eks_node_group.eks_nodes[0]", "module_address": "module.nodes", "mode": "managed", "type": "aws_eks_node_group",
+  "change": {"actions": ["create"], "after": {"node_group_name": "wg", "scaling_config": [{"desired_size": 2, "max_size": 1, "min_size": 3}]}}}]}`,
+			wantErr: "apply: planned node group scaling does not match config file:",
+		},
+		{
+			name:   "required tags",
+			params: []string{"M_WORKER_GROUPS=[{name: wg, instance_type: t3.small, asg_desired_capacity: 2, asg_min_size: 1, asg_max_size: 3}]", "M_TAGS={owner: data}", "M_REQUIRED_TAG_KEYS=[owner]"},
+			plan: `{"resource_changes": [{"address": "aws_subnet.eks_subnet[0]", "mode": "managed", "type": "aws_subnet",
+  "change": {"actions": ["create"], "after": {"tags": {"Name": "epiphany-subnet-0"}}}}]}`,
+			wantErr: "apply: planned resources lack required tag keys:\n  aws_subnet.eks_subnet[0]: owner",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, append(validParams, tt.params...)...)
+			tf.plan = goodPlan
+			if err := m.Run("init", "plan"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+
+			// Saved plan no longer passes the checks made by plan.
+			tf.plan = tt.plan
+			err := m.Run("apply")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			for _, call := range tf.calls {
+				if strings.HasPrefix(call, "apply ") {
+					t.Errorf("plan failing checks was applied: %s", call)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyStalePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		edit    func(m *Module)
+		wantErr string
+	}{
+		{
+			name: "config edited",
+			edit: func(m *Module) {
+				writeFile(t, m.configPath(), strings.Replace(readFile(t, m.configPath()), "disk_size: 32", "disk_size: 64", 1))
+			},
+			wantErr: "plan is stale, awsks-config.yml, vars.tfvars.json changed since plan was created, run plan again",
+		},
+		{
+			name: "state edited",
+			edit: func(m *Module) {
+				writeFile(t, m.statePath(), readFile(t, m.statePath())+"  name: other\n")
+			},
+			wantErr: "plan is stale, state.yml (awsks section) changed since plan was created, run plan again",
+		},
+		{
+			name: "other module section of state edited",
+			edit: func(m *Module) {
+				writeFile(t, m.statePath(), readFile(t, m.statePath())+"awsbi:\n  status: applied\n")
+			},
+		},
+		{
+			name: "SSH public key replaced",
+			args: []string{"M_SSH_ACCESS=true", "M_SSH_PUBLIC_KEY_PATH=vms_rsa.pub"},
+			edit: func(m *Module) {
+				writeFile(t, filepath.Join(m.Vars.Get("M_SHARED"), "vms_rsa.pub"), "ssh-rsa AAAAB3NzaC1yc2E other\n")
+			},
+			wantErr: "plan is stale, vars.tfvars.json changed since plan was created, run plan again",
+		},
+		{
+			name: "apply in new container",
+			edit: func(m *Module) {
+				// Files templated in M_RESOURCES by plan do not outlive its
+				// container.
+				os.RemoveAll(m.Vars.Get("M_RESOURCES"))
+			},
+		},
+		{
+			name: "plan not recorded",
+			edit: func(m *Module) {
+				os.Remove(m.planFingerprintPath())
+			},
+			wantErr: "missing plan fingerprint, run plan first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, append(validParams, tt.args...)...)
+			writeFile(t, filepath.Join(m.Vars.Get("M_SHARED"), "vms_rsa.pub"), "ssh-rsa AAAAB3NzaC1yc2E test\n")
+			if err := m.Run("init", "plan"); err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+			tt.edit(m)
+
+			err := m.Run("apply")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Run() failed with: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			for _, call := range tf.calls {
+				if strings.HasPrefix(call, "apply ") {
+					t.Errorf("stale plan was applied: %s", call)
+				}
+			}
+		})
+	}
+}
+
+// missingHelm reports every release as not installed.
+type missingHelm struct{}
+
+func (missingHelm) Release(kubeconfig, name, namespace string) (*audit.Release, error) {
+	return nil, nil
+}
+
+func TestAudit(t *testing.T) {
+	m, stdout, tf := newTestModule(t, validParams...)
+	tf.output = `{"kubeconfig": {"sensitive": false, "type": "string", "value": "apiVersion: v1\n"}}`
+	if err := m.Run("init", "plan", "apply"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	writeFile(t, m.tfstatePath(), `{"version": 4, "resources": [
+  {"mode": "managed", "type": "aws_eks_cluster", "name": "eks_cluster", "instances": [{"attributes": {"version": "1.18"}}]},
+  {"mode": "managed", "type": "aws_iam_openid_connect_provider", "name": "eks_openid_connect_provider", "instances": [{"attributes": {"arn": "arn:aws:iam::123456789012:oidc-provider/oidc"}}]},
+  {"mode": "managed", "type": "aws_cloudwatch_log_group", "name": "eks_log_group", "instances": [{"attributes": {"name": "epiphany-log-group", "retention_in_days": 30}}]},
+  {"mode": "managed", "type": "helm_release", "name": "cluster-autoscaler", "instances": [{"attributes": {"name": "cluster-autoscaler", "namespace": "kube-system"}}]}
+]}`)
+	cloud := fake.New()
+	cloud.AddCluster(&eks.Cluster{Name: aws.String("epiphany"), Version: aws.String("1.18")})
+	var region string
+	m.NewClients = func(r string) (awsapi.Clients, error) {
+		region = r
+		return cloud.Clients(), nil
+	}
+	m.Helm = missingHelm{}
+
+	err := m.Run("audit")
+	var driftErr *audit.DriftError
+	if !errors.As(err, &driftErr) {
+		t.Fatalf("expected DriftError, got: %v", err)
+	}
+	if region != "eu-central-1" {
+		t.Errorf("expected clients for eu-central-1, got: %q", region)
+	}
+	if !strings.Contains(stdout.String(), "eks nodegroup/default_wg") || !strings.Contains(stdout.String(), "YES") {
+		t.Errorf("expected drift table in output, got:\n%s", stdout.String())
+	}
+
+	var report audit.Report
+	if err := json.Unmarshal([]byte(readFile(t, m.auditReportPath())), &report); err != nil {
+		t.Fatalf("cannot parse audit report: %v", err)
+	}
+	if got := len(report.Drifted()); got != driftErr.Drifted {
+		t.Errorf("expected %d drifted checks in report, got %d", driftErr.Drifted, got)
+	}
+}
+
+// recordingAutoscaler records image tags set by upgrade.
+type recordingAutoscaler struct {
+	tags []string
+}
+
+func (a *recordingAutoscaler) SetImageTag(kubeconfig string, release upgrade.Release, tag string) error {
+	a.tags = append(a.tags, release.Namespace+"/"+release.Name+":"+tag)
+	return nil
+}
+
+// newUpgradeModule returns module applied with Kubernetes 1.17 and config
+// changed to 1.19 and by edits.
+func newUpgradeModule(t *testing.T, edits ...string) (*Module, *bytes.Buffer, *fake.Cloud, *recordingAutoscaler) {
+	m, stdout, tf := newTestModule(t, append(validParams, "M_K8S_VERSION=1.17")...)
+	tf.output = `{"kubeconfig": {"sensitive": false, "type": "string", "value": "apiVersion: v1\n"}}`
+	if err := m.Run("init", "plan", "apply"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	writeFile(t, m.tfstatePath(), `{"version": 4, "resources": [
+  {"mode": "managed", "type": "aws_eks_cluster", "name": "eks_cluster", "instances": [{"attributes": {"name": "epiphany", "version": "1.17"}}]},
+  {"mode": "managed", "type": "aws_eks_node_group", "name": "eks_nodes", "instances": [{"index_key": 0, "attributes": {"node_group_name": "default_wg"}}]},
+  {"mode": "managed", "type": "helm_release", "name": "cluster-autoscaler", "instances": [{"attributes": {"name": "cluster-autoscaler", "namespace": "kube-system", "chart": "stable/cluster-autoscaler", "version": "7.3.4"}}]}
+]}`)
+	edits = append(edits, `k8s_version: "1.17"`, `k8s_version: "1.19"`)
+	writeFile(t, m.configPath(), strings.NewReplacer(edits...).Replace(readFile(t, m.configPath())))
+	cloud := fake.New()
+	cloud.AddCluster(&eks.Cluster{Name: aws.String("epiphany"), Version: aws.String("1.17")})
+	cloud.AddNodegroup(&eks.Nodegroup{ClusterName: aws.String("epiphany"), NodegroupName: aws.String("default_wg")})
+	m.NewClients = func(string) (awsapi.Clients, error) { return cloud.Clients(), nil }
+	autoscaler := &recordingAutoscaler{}
+	m.Autoscaler = autoscaler
+	return m, stdout, cloud, autoscaler
+}
+
+func TestUpgrade(t *testing.T) {
+	m, stdout, cloud, autoscaler := newUpgradeModule(t)
+
+	if err := m.Run("upgrade"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	wantCalls := []string{
+		"UpdateClusterVersion epiphany 1.18",
+		"UpdateNodegroupVersion default_wg 1.18",
+		"UpdateClusterVersion epiphany 1.19",
+		"UpdateNodegroupVersion default_wg 1.19",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+	wantTags := []string{"kube-system/cluster-autoscaler:v1.18.3", "kube-system/cluster-autoscaler:v1.19.1"}
+	if diff := deep.Equal(autoscaler.tags, wantTags); diff != nil {
+		t.Error(diff)
+	}
+
+	st, err := state.Load(m.statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.AWSKS.K8sVersion != "1.19" {
+		t.Errorf("expected k8s_version 1.19 in state, got %q", st.AWSKS.K8sVersion)
+	}
+	if st.AWSKS.Upgrade == nil || !st.AWSKS.Upgrade.Finished() || len(st.AWSKS.Upgrade.Steps) != 6 {
+		t.Errorf("expected finished upgrade with 6 steps in state, got %+v", st.AWSKS.Upgrade)
+	}
+
+	stdout.Reset()
+	if err := m.Run("upgrade"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Cluster is already in version 1.19") {
+		t.Errorf("expected no upgrade, got:\n%s", stdout.String())
+	}
+	if len(cloud.Calls()) != len(wantCalls) {
+		t.Errorf("expected no more calls, got: %v", cloud.Calls())
+	}
+}
+
+func TestUpgradeCustomAMI(t *testing.T) {
+	m, stdout, cloud, _ := newUpgradeModule(t, "asg_max_size: 1", "asg_max_size: 1\n      launch_template: {bootstrap_args: --use-max-pods false}")
+
+	if err := m.Run("upgrade"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	wantCalls := []string{
+		"UpdateClusterVersion epiphany 1.18",
+		"UpdateClusterVersion epiphany 1.19",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+	if !strings.Contains(stdout.String(), "Skipping node group default_wg with custom AMI") {
+		t.Errorf("expected skipped node group in output, got:\n%s", stdout.String())
+	}
+}
+
+func TestUpgradeUnfinished(t *testing.T) {
+	m, _, tf := newTestModule(t, validParams...)
+	tf.output = `{"kubeconfig": {"sensitive": false, "type": "string", "value": "apiVersion: v1\n"}}`
+	if err := m.Run("init", "plan", "apply"); err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+	writeFile(t, m.tfstatePath(), `{"version": 4, "resources": [
+  {"mode": "managed", "type": "aws_eks_cluster", "name": "eks_cluster", "instances": [{"attributes": {"name": "epiphany"}}]},
+  {"mode": "managed", "type": "helm_release", "name": "cluster-autoscaler", "instances": [{"attributes": {"name": "cluster-autoscaler"}}]}
+]}`)
+	writeFile(t, m.statePath(), readFile(t, m.statePath())+`  upgrade:
+    from: "1.17"
+    to: "1.19"
+    steps:
+      - action: control-plane
+        version: "1.18"
+        done: true
+      - action: control-plane
+        version: "1.19"
+        done: false
+`)
+	m.NewClients = func(string) (awsapi.Clients, error) { return fake.New().Clients(), nil }
+
+	err := m.Run("upgrade")
+	if err == nil || err.Error() != "upgrade: upgrade to 1.19 is not finished, set k8s_version to 1.19 to resume it" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   []string
+		commands []string
+		vars     map[string]string
+		tfErr    error
+		wantErr  string
+	}{
+		{
+			name:     "unknown command",
+			commands: []string{"init", "bogus"},
+			wantErr:  "unknown command: bogus",
+		},
+		{
+			name:     "missing shared directory",
+			commands: []string{"init"},
+			vars:     map[string]string{"M_SHARED": ""},
+			wantErr:  "environment variable M_SHARED not set",
+		},
+		{
+			name:     "plan without init",
+			commands: []string{"plan"},
+			wantErr:  "run init first",
+		},
+		{
+			name:     "kubeconfig before apply",
+			commands: []string{"init", "kubeconfig"},
+			wantErr:  "missing kubeconfig in state file",
+		},
+		{
+			name:     "plan after destroy",
+			params:   validParams,
+			commands: []string{"init", "plan", "apply", "plan-destroy", "destroy", "plan"},
+			wantErr:  "awsks.status: is destroyed, but plan requires one of initialized, applied (run init first)",
+		},
+		{
+			name:     "apply without init",
+			params:   validParams,
+			commands: []string{"apply"},
+			wantErr:  "awsks: section is missing, run init before apply",
+		},
+		{
+			name:     "audit before apply",
+			params:   validParams,
+			commands: []string{"init", "audit"},
+			wantErr:  "awsks.status: is initialized, but audit requires one of applied (run apply first)",
+		},
+		{
+			name:     "upgrade before apply",
+			params:   validParams,
+			commands: []string{"init", "upgrade"},
+			wantErr:  "awsks.status: is initialized, but upgrade requires one of applied (run apply first)",
+		},
+		{
+			name:     "init with unsupported k8s version",
+			params:   []string{"M_K8S_VERSION=1.20"},
+			commands: []string{"init"},
+			wantErr:  `init: M_K8S_VERSION: unsupported version "1.20", supported versions are 1.16, 1.17, 1.18, 1.19`,
+		},
+		{
+			name:     "init with mismatched autoscaler version",
+			params:   []string{"M_AUTOSCALER_VERSION=v1.19.1"},
+			commands: []string{"init"},
+			wantErr:  "init: M_AUTOSCALER_VERSION: v1.19.1 does not match k8s_version 1.18",
+		},
+		{
+			name:     "plan with invalid config",
+			commands: []string{"init", "plan"},
+			wantErr:  "awsks.vpc_id: does not match pattern",
+		},
+		{
+			name:     "plan with missing SSH public key",
+			params:   append(validParams, "M_SSH_ACCESS=true", "M_SSH_PUBLIC_KEY_PATH=missing.pub"),
+			commands: []string{"init", "plan"},
+			wantErr:  "cannot read SSH public key",
+		},
+		{
+			name:     "terraform failure",
+			params:   validParams,
+			commands: []string{"init", "plan"},
+			tfErr:    fmt.Errorf("exit status 1"),
+			wantErr:  "plan: exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, tf := newTestModule(t, tt.params...)
+			tf.err = tt.tfErr
+			for name, value := range tt.vars {
+				m.Vars[name] = value
+			}
+
+			err := m.Run(tt.commands...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		environ      []string
+		wantVars     map[string]string
+		wantCommands []string
+		wantErr      bool
+	}{
+		{
+			name:         "defaults",
+			args:         []string{"init"},
+			wantVars:     map[string]string{"M_NAME": "epiphany", "M_REGION": "eu-central-1"},
+			wantCommands: []string{"init"},
+		},
+		{
+			name:         "environment overrides defaults",
+			args:         []string{"plan"},
+			environ:      []string{"M_NAME=from-env", "HOME=/root", "M_REGION"},
+			wantVars:     map[string]string{"M_NAME": "from-env", "M_REGION": "eu-central-1"},
+			wantCommands: []string{"plan"},
+		},
+		{
+			name:         "arguments override environment",
+			args:         []string{"apply", "M_NAME=from-arg", "--M_REGION=us-east-1", "kubeconfig", "-M_VPC_ID", "vpc-1"},
+			environ:      []string{"M_NAME=from-env"},
+			wantVars:     map[string]string{"M_NAME": "from-arg", "M_REGION": "us-east-1", "M_VPC_ID": "vpc-1"},
+			wantCommands: []string{"apply", "kubeconfig"},
+		},
+		{
+			name:         "deprecated EC2 SSH key",
+			args:         []string{"init", "M_EC2_SSH_KEY=kp-1"},
+			wantVars:     map[string]string{"M_SSH_ACCESS": "true", "M_SSH_KEY_NAME": "kp-1", "M_EC2_SSH_KEY": ""},
+			wantCommands: []string{"init"},
+		},
+		{
+			name:         "deprecated EC2 SSH key left null",
+			args:         []string{"init"},
+			environ:      []string{"M_EC2_SSH_KEY=null"},
+			wantVars:     map[string]string{"M_SSH_ACCESS": "false", "M_SSH_KEY_NAME": "null"},
+			wantCommands: []string{"init"},
+		},
+		{
+			name:    "deprecated EC2 SSH key with SSH access",
+			args:    []string{"init", "M_EC2_SSH_KEY=kp-1", "M_SSH_ACCESS=true"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--verbose", "init"},
+			wantErr: true,
+		},
+		{
+			name:    "flag without value",
+			args:    []string{"init", "--M_NAME"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, commands, err := ParseArgs(tt.args, tt.environ)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseArgs() failed with: %v", err)
+			}
+			for name, want := range tt.wantVars {
+				if got := vars.Get(name); got != want {
+					t.Errorf("expected %s=%q, got %q", name, want, got)
+				}
+			}
+			if diff := deep.Equal(commands, tt.wantCommands); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
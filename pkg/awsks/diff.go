@@ -0,0 +1,49 @@
+package awsks
+
+import (
+	"strings"
+)
+
+// diffLines returns line diff of a and b. Lines present only in a are
+// prefixed with "-", lines present only in b with "+" and common lines with
+// a space.
+func diffLines(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out.WriteString(" " + x[i] + "\n")
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			out.WriteString("+" + y[j] + "\n")
+			j++
+		default:
+			out.WriteString("-" + x[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
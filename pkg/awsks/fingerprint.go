@@ -0,0 +1,121 @@
+package awsks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// fingerprint identifies inputs of a terraform plan. It is recorded by plan
+// and checked by apply, so a plan is not applied after its inputs changed.
+type fingerprint struct {
+	Config string `json:"config"`
+	State  string `json:"state"`
+	Tfvars string `json:"tfvars"`
+	Plan   string `json:"plan"`
+}
+
+// currentFingerprint hashes the config file, awsks section of the state
+// file, rendered variables and the plan file. Variables are rendered instead
+// of read from M_RESOURCES, as apply may run in another container than plan.
+func (m *Module) currentFingerprint() (*fingerprint, error) {
+	var f fingerprint
+	var err error
+	if f.Config, err = hashFile(m.configPath()); err != nil {
+		return nil, err
+	}
+	tfvars, err := m.renderTfvars()
+	if err != nil {
+		return nil, err
+	}
+	f.Tfvars = hash(tfvars)
+	if f.Plan, err = hashFile(m.applyPlanPath()); err != nil {
+		return nil, err
+	}
+
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return nil, err
+	}
+	var section []byte
+	if node := lookup(state, moduleShort); node != nil {
+		if section, err = encodeDocument(node); err != nil {
+			return nil, err
+		}
+	}
+	f.State = hash(section)
+	return &f, nil
+}
+
+// changed returns names of inputs which differ from other fingerprint.
+func (f *fingerprint) changed(other *fingerprint) []string {
+	var names []string
+	if f.Config != other.Config {
+		names = append(names, configName)
+	}
+	if f.State != other.State {
+		names = append(names, stateFileName+" ("+moduleShort+" section)")
+	}
+	if f.Tfvars != other.Tfvars {
+		names = append(names, "vars.tfvars.json")
+	}
+	if f.Plan != other.Plan {
+		names = append(names, "terraform-apply.tfplan")
+	}
+	return names
+}
+
+func (m *Module) recordPlanFingerprint() error {
+	m.logStep("record-plan-fingerprint", "will record fingerprint of plan inputs")
+	f, err := m.currentFingerprint()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.planFingerprintPath(), append(data, '\n'), 0644)
+}
+
+// verifyPlanFingerprint refuses to apply plan whose inputs changed since it
+// was created.
+func (m *Module) verifyPlanFingerprint() error {
+	m.logStep("verify-plan-fingerprint", "will check if plan is up to date")
+	data, err := ioutil.ReadFile(m.planFingerprintPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("missing plan fingerprint, run plan first")
+		}
+		return err
+	}
+	var recorded fingerprint
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return fmt.Errorf("cannot parse plan fingerprint: %w", err)
+	}
+	current, err := m.currentFingerprint()
+	if err != nil {
+		return err
+	}
+	if changed := recorded.changed(current); len(changed) > 0 {
+		return fmt.Errorf("plan is stale, %s changed since plan was created, run plan again", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return hash(data), nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
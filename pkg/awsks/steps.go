@@ -0,0 +1,681 @@
+package awsks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/audit"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/preflight"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfplan"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfstate"
+	"gopkg.in/yaml.v3"
+)
+
+func (m *Module) metadata() error {
+	m.logStep("metadata", "should print component metadata")
+	content, err := render(metadataTemplate, m.Vars)
+	if err != nil {
+		return fmt.Errorf("cannot render metadata: %w", err)
+	}
+	fmt.Fprint(m.Stdout, content)
+	return nil
+}
+
+func (m *Module) setup() error {
+	if err := os.MkdirAll(m.moduleDir(), 0755); err != nil {
+		return fmt.Errorf("cannot create module directory: %w", err)
+	}
+	m.logStep("setup", "ensure required directories")
+	return nil
+}
+
+func (m *Module) ensureStateFile() error {
+	f, err := os.OpenFile(m.statePath(), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create state file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	m.logStep("ensure-state-file", "checks if state file exists")
+	return nil
+}
+
+// validateVersions checks Kubernetes and cluster autoscaler versions before
+// they are written to config file.
+func (m *Module) validateVersions() error {
+	m.logStep("validate-versions", "will check Kubernetes and autoscaler versions")
+	k8sVersion := m.Vars.Get("M_K8S_VERSION")
+	if err := config.CheckK8sVersion(k8sVersion); err != nil {
+		return fmt.Errorf("M_K8S_VERSION: %w", err)
+	}
+	if v := m.Vars.Get("M_AUTOSCALER_VERSION"); v != "null" {
+		if err := config.CheckAutoscalerVersion(v, k8sVersion); err != nil {
+			return fmt.Errorf("M_AUTOSCALER_VERSION: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *Module) templateConfigFile() error {
+	m.logStep("template-config-file", "will template config file (and backup previous if exists)")
+	if _, err := os.Stat(m.configPath()); err == nil {
+		if err := os.Rename(m.configPath(), m.configPath()+".backup"); err != nil {
+			return fmt.Errorf("cannot backup config file: %w", err)
+		}
+	}
+	content, err := render(configTemplate, m.Vars)
+	if err != nil {
+		return fmt.Errorf("cannot render config file: %w", err)
+	}
+	config, err := parseDocument([]byte(content))
+	if err != nil {
+		return fmt.Errorf("cannot parse templated config file: %w", err)
+	}
+	resetStyle(config)
+
+	m.logStep("template-config-file", "will replace arguments with values from state file")
+	st, err := state.Load(m.statePath())
+	if err != nil {
+		return err
+	}
+	if st.AWSBI != nil {
+		if vpcID := st.AWSBI.Output.VpcID; vpcID != "" {
+			set(config, newString(vpcID), moduleShort, "vpc_id")
+		}
+		if rtID := st.AWSBI.Output.PrivateRouteTableID; rtID != "" {
+			set(config, newString(rtID), moduleShort, "private_route_table_id")
+		}
+		// Key of virtual machines is used for worker nodes when SSH access is
+		// enabled without another key.
+		noKey := m.Vars.Get("M_SSH_KEY_NAME") == "null" && m.Vars.Get("M_SSH_PUBLIC_KEY_PATH") == "null"
+		if path := st.AWSBI.RsaPubPath; path != "" && noKey && m.Vars.Get("M_SSH_ACCESS") == "true" {
+			set(config, newString(path), moduleShort, "ssh_access", "public_key_path")
+		}
+	}
+	return saveDocument(m.configPath(), config)
+}
+
+func (m *Module) initializeStateFile() error {
+	m.logStep("initialize-state-file", "will initialize state file")
+	content, err := render(stateInitialTemplate, m.Vars)
+	if err != nil {
+		return fmt.Errorf("cannot render initial state: %w", err)
+	}
+	initial, err := parseDocument([]byte(content))
+	if err != nil {
+		return fmt.Errorf("cannot parse initial state: %w", err)
+	}
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	merge(state, initial)
+	return saveDocument(m.statePath(), state)
+}
+
+func (m *Module) displayConfigFile() error {
+	m.logStep("display-config-file", "config file content is:")
+	content, err := ioutil.ReadFile(m.configPath())
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	_, err = m.Stdout.Write(content)
+	return err
+}
+
+func (m *Module) validateConfig() error {
+	m.logStep("validate-config", "will perform config validation")
+	_, err := m.loadValidConfig()
+	return err
+}
+
+// validateState returns step checking if state file is valid and command
+// can be run in its current state.
+func validateState(command string) func(m *Module) error {
+	return func(m *Module) error {
+		m.logStep("validate-state", "will perform state file validation")
+		st, err := state.Load(m.statePath())
+		if err != nil {
+			return err
+		}
+		return st.ValidateFor(command)
+	}
+}
+
+func (m *Module) audit() error {
+	m.logStep("audit", "will compare state with remote components")
+	st, err := state.Load(m.statePath())
+	if err != nil {
+		return err
+	}
+	tf, err := tfstate.Load(m.tfstatePath())
+	if err != nil {
+		return fmt.Errorf("cannot read terraform state: %w", err)
+	}
+	clients, err := m.NewClients(st.AWSKS.Region)
+	if err != nil {
+		return err
+	}
+	report, err := audit.New(clients, m.Helm).Audit(st.AWSKS, tf)
+	if err != nil {
+		return err
+	}
+
+	if err := report.WriteTable(m.Stdout); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(m.auditReportPath(), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write audit report: %w", err)
+	}
+	return report.Err()
+}
+
+func (m *Module) templateTfvars() error {
+	m.logStep("template-tfvars", "will template .tfvars.json file")
+	data, err := m.renderTfvars()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.tfvarsPath(), data, 0644)
+}
+
+// renderTfvars returns content of .tfvars.json file for config file. The
+// file is written inside M_RESOURCES, which does not outlive the container,
+// so apply renders it again to compare with the plan fingerprint.
+func (m *Module) renderTfvars() ([]byte, error) {
+	c, err := m.loadValidConfig()
+	if err != nil {
+		return nil, err
+	}
+	vars := struct {
+		config.AWSKS
+		SSHPublicKey *string `json:"ssh_public_key"`
+	}{AWSKS: c.AWSKS}
+	if ssh := c.AWSKS.SSHAccess; ssh.Enabled && ssh.PublicKeyPath != nil {
+		path := *ssh.PublicKeyPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(m.Vars.Get("M_SHARED"), path)
+		}
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read SSH public key: %w", err)
+		}
+		publicKey := strings.TrimSpace(string(key))
+		vars.SSHPublicKey = &publicKey
+	}
+	data, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode .tfvars.json file: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// loadConfig reads module config file, which has to exist.
+func (m *Module) loadConfig() (*yaml.Node, error) {
+	if _, err := os.Stat(m.configPath()); err != nil {
+		return nil, fmt.Errorf("cannot read config file, run init first: %w", err)
+	}
+	return loadDocument(m.configPath())
+}
+
+// loadValidConfig reads and validates module config file.
+func (m *Module) loadValidConfig() (*config.Config, error) {
+	if _, err := os.Stat(m.configPath()); err != nil {
+		return nil, fmt.Errorf("cannot read config file, run init first: %w", err)
+	}
+	return config.Load(m.configPath())
+}
+
+func (m *Module) modulePlan() error {
+	m.logStep("module-plan", "will perform module plan")
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	config, err := m.loadConfig()
+	if err != nil {
+		return err
+	}
+	future := clone(state)
+	merge(future, config)
+	set(future, newString("state"), "kind")
+
+	current, err := encodeDocument(state)
+	if err != nil {
+		return err
+	}
+	planned, err := encodeDocument(future)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, planned) {
+		fmt.Fprint(m.Stdout, diffLines(string(current), string(planned)))
+	}
+	return nil
+}
+
+// preflight checks the AWS account with read-only calls, so missing or
+// conflicting resources are reported before terraform runs.
+func (m *Module) preflight() error {
+	m.logStep("preflight", "will check AWS account before terraform runs")
+	c, err := m.loadValidConfig()
+	if err != nil {
+		return err
+	}
+	// Resources created by previous apply are replaced or kept by terraform,
+	// so they do not conflict.
+	owned := preflight.Owned{SubnetIDs: make(map[string]bool), KeyPairs: make(map[string]bool)}
+	tf, err := tfstate.Load(m.tfstatePath())
+	switch {
+	case err == nil:
+		for _, i := range tf.Instances("aws_subnet") {
+			owned.SubnetIDs[i.String("id")] = true
+		}
+		for _, i := range tf.Instances("aws_key_pair") {
+			owned.KeyPairs[i.String("key_name")] = true
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("cannot read terraform state: %w", err)
+	}
+	clients, err := m.NewClients(c.AWSKS.Region)
+	if err != nil {
+		return err
+	}
+	report, err := preflight.New(clients).Run(c.AWSKS, owned)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteTable(m.Stdout); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// stateMoves are modules whose address changed in terraform configuration.
+// Terraform 0.13 cannot declare moves, so without them resources of the old
+// address would be destroyed and created again.
+var stateMoves = []struct{ from, to string }{
+	// Autoscaler module got count to be skipped in Fargate-only clusters.
+	{from: "module.autoscaler", to: "module.autoscaler[0]"},
+}
+
+// migrateTerraformState returns step moving resources of previous module
+// versions to their current addresses. Plan makes the moves in a copy of
+// terraform state and plans against it, so it leaves the state untouched.
+// Apply makes the same moves in the state, after which its serial matches
+// the one recorded in the plan.
+func migrateTerraformState(command string) func(m *Module) error {
+	return func(m *Module) error {
+		m.logStep("migrate-terraform-state", "will move resources to current addresses in terraform state")
+		path := m.tfstatePath()
+		if command == "plan" {
+			path = m.migratedTfstatePath()
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		tf, err := tfstate.Load(m.tfstatePath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read terraform state: %w", err)
+		}
+		copied := false
+		for _, move := range stateMoves {
+			if !tf.HasModule(move.from) {
+				continue
+			}
+			if path != m.tfstatePath() && !copied {
+				if err := copyFile(m.tfstatePath(), path); err != nil {
+					return fmt.Errorf("cannot copy terraform state: %w", err)
+				}
+				copied = true
+			}
+			fmt.Fprintf(m.Stdout, "Moving %s to %s in terraform state\n", move.from, move.to)
+			err := m.Terraform.Run(m.terraformDir(), m.awsEnv(), m.Stdout, m.Stderr,
+				"state",
+				"mv",
+				"-state="+path,
+				move.from,
+				move.to,
+			)
+			if err != nil {
+				return fmt.Errorf("cannot move %s to %s in terraform state: %w", move.from, move.to, err)
+			}
+		}
+		return nil
+	}
+}
+
+// planTfstatePath returns terraform state to plan against, the copy migrated
+// by plan when there is one.
+func (m *Module) planTfstatePath() (string, error) {
+	_, err := os.Stat(m.migratedTfstatePath())
+	if os.IsNotExist(err) {
+		return m.tfstatePath(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.migratedTfstatePath(), nil
+}
+
+func copyFile(from, to string) error {
+	data, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, data, 0600)
+}
+
+func (m *Module) terraformPlan() error {
+	m.logStep("terraform-plan", "will run plan")
+	// Fingerprint of the previous plan must not validate the new one before
+	// its checks pass.
+	if err := os.Remove(m.planFingerprintPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tfstatePath, err := m.planTfstatePath()
+	if err != nil {
+		return err
+	}
+	return m.Terraform.Run(m.terraformDir(), m.awsEnv(), m.Stdout, m.Stderr,
+		"plan",
+		"-no-color",
+		"-input=false",
+		"-var-file="+m.tfvarsPath(),
+		"-state="+tfstatePath,
+		"-out="+m.applyPlanPath(),
+		m.terraformDir(),
+	)
+}
+
+// terraformPlanSummary writes machine readable summary of the apply plan and
+// prints counts of changes and destructive changes.
+func (m *Module) terraformPlanSummary() error {
+	m.logStep("terraform-plan-summary", "will summarize plan")
+	summary, err := m.summarizeApplyPlan()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(m.planSummaryPath(), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write plan summary: %w", err)
+	}
+	fmt.Fprintln(m.Stdout, summary)
+	for _, c := range summary.Destructive {
+		fmt.Fprintf(m.Stdout, "WARNING: %s will be %sd\n", c.Address, c.Action)
+	}
+	return nil
+}
+
+// guardDestructiveChanges refuses to apply plan replacing or deleting
+// protected resources unless M_ALLOW_DESTRUCTIVE is true.
+func (m *Module) guardDestructiveChanges() error {
+	m.logStep("guard-destructive-changes", "will check plan for destructive changes")
+	summary, err := m.summarizeApplyPlan()
+	if err != nil {
+		return err
+	}
+	if len(summary.Destructive) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(summary.Destructive))
+	for _, c := range summary.Destructive {
+		lines = append(lines, fmt.Sprintf("  %s (%s)", c.Address, c.Action))
+	}
+	if m.Vars.Get("M_ALLOW_DESTRUCTIVE") == "true" {
+		fmt.Fprintf(m.Stdout, "WARNING: applying destructive changes allowed by M_ALLOW_DESTRUCTIVE:\n%s\n", strings.Join(lines, "\n"))
+		return nil
+	}
+	return fmt.Errorf("plan contains destructive changes, set M_ALLOW_DESTRUCTIVE=true to apply them:\n%s", strings.Join(lines, "\n"))
+}
+
+// checkPlannedScaling compares scaling of node groups in the apply plan with
+// worker groups of config file, so a wrong mapping of variables in terraform
+// is reported by plan instead of by AWS. Apply runs it again before
+// terraform apply, like guardDestructiveChanges.
+func (m *Module) checkPlannedScaling() error {
+	m.logStep("check-planned-scaling", "will compare planned node group scaling with config file")
+	c, err := m.loadValidConfig()
+	if err != nil {
+		return err
+	}
+	plan, err := m.showApplyPlan()
+	if err != nil {
+		return err
+	}
+	groups := make(map[string]config.WorkerGroup)
+	for _, wg := range c.AWSKS.WorkerGroups {
+		groups[wg.Name] = wg
+	}
+
+	var problems []string
+	for _, rc := range plan.ResourceChanges {
+		if rc.Type != "aws_eks_node_group" || rc.Change.After == nil {
+			continue
+		}
+		planned := tfstate.Instance{Attributes: rc.Change.After}
+		wg, ok := groups[planned.String("node_group_name")]
+		if !ok {
+			continue
+		}
+		expected := map[string]int{"min_size": wg.AsgMinSize, "max_size": wg.AsgMaxSize}
+		// Desired size of existing node groups is managed by the autoscaler
+		// and ignored by terraform.
+		if action, _ := rc.Action(); action == tfplan.ActionCreate || action == tfplan.ActionReplace {
+			expected["desired_size"] = wg.AsgDesiredCapacity
+		}
+		for _, name := range []string{"min_size", "max_size", "desired_size"} {
+			want, ok := expected[name]
+			if !ok {
+				continue
+			}
+			if got := planned.String("scaling_config.0." + name); got != fmt.Sprint(want) {
+				problems = append(problems, fmt.Sprintf("  %s: %s is %s, config has %d", rc.Address, name, got, want))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("planned node group scaling does not match config file:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// checkRequiredTags lists resources of the apply plan lacking tag keys
+// required by config file. Like checkPlannedScaling it is run by plan and
+// again by apply.
+func (m *Module) checkRequiredTags() error {
+	m.logStep("check-required-tags", "will check tags of planned resources")
+	c, err := m.loadValidConfig()
+	if err != nil {
+		return err
+	}
+	if len(c.AWSKS.RequiredTagKeys) == 0 {
+		return nil
+	}
+	plan, err := m.showApplyPlan()
+	if err != nil {
+		return err
+	}
+	missing := plan.MissingTags(c.AWSKS.RequiredTagKeys)
+	if len(missing) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(missing))
+	for _, mt := range missing {
+		lines = append(lines, fmt.Sprintf("  %s: %s", mt.Address, strings.Join(mt.Keys, ", ")))
+	}
+	return fmt.Errorf("planned resources lack required tag keys:\n%s", strings.Join(lines, "\n"))
+}
+
+// summarizeApplyPlan summarizes saved apply plan.
+func (m *Module) summarizeApplyPlan() (*tfplan.Summary, error) {
+	plan, err := m.showApplyPlan()
+	if err != nil {
+		return nil, err
+	}
+	return plan.Summarize(), nil
+}
+
+// showApplyPlan reads saved apply plan using terraform show.
+func (m *Module) showApplyPlan() (*tfplan.Plan, error) {
+	var stdout bytes.Buffer
+	err := m.Terraform.Run(m.terraformDir(), []string{"TF_IN_AUTOMATION=true"}, &stdout, m.Stderr,
+		"show",
+		"-no-color",
+		"-json",
+		m.applyPlanPath(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tfplan.Parse(stdout.Bytes())
+}
+
+func (m *Module) terraformApply() error {
+	m.logStep("terraform-apply", "will run terraform apply")
+	return m.Terraform.Run(m.terraformDir(), m.awsEnv(), m.Stdout, m.Stderr,
+		"apply",
+		"-no-color",
+		"-input=false",
+		"-auto-approve",
+		"-state="+m.tfstatePath(),
+		m.applyPlanPath(),
+	)
+}
+
+func (m *Module) terraformPlanDestroy() error {
+	m.logStep("terraform-plan-destroy", "will prepare plan of destruction")
+	return m.Terraform.Run(m.terraformDir(), m.awsEnv(), m.Stdout, m.Stderr,
+		"plan",
+		"-destroy",
+		"-no-color",
+		"-input=false",
+		"-var-file="+m.tfvarsPath(),
+		"-state="+m.tfstatePath(),
+		"-out="+m.destroyPlanPath(),
+		m.terraformDir(),
+	)
+}
+
+func (m *Module) terraformDestroy() error {
+	m.logStep("terraform-destroy", "terraform-destroy is just about to begin ...")
+	env := append(m.awsEnv(), "TF_WARN_OUTPUT_ERRORS=1")
+	return m.Terraform.Run(m.terraformDir(), env, m.Stdout, m.Stderr,
+		"apply",
+		"-no-color",
+		"-input=false",
+		"-auto-approve",
+		"-state="+m.tfstatePath(),
+		m.destroyPlanPath(),
+	)
+}
+
+// terraformOutput stores values of terraform outputs in state file under
+// awsks.output as "<name>.value" keys.
+func (m *Module) terraformOutput() error {
+	m.logStep("terraform-output", "will prepare terraform output")
+	var stdout bytes.Buffer
+	err := m.Terraform.Run(m.terraformDir(), []string{"TF_IN_AUTOMATION=true"}, &stdout, m.Stderr,
+		"output",
+		"-no-color",
+		"-json",
+		"-state="+m.tfstatePath(),
+	)
+	if err != nil {
+		return err
+	}
+
+	var outputs map[string]struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
+		return fmt.Errorf("cannot parse terraform output: %w", err)
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	output := newMapping()
+	for _, name := range names {
+		var value yaml.Node
+		if err := value.Encode(outputs[name].Value); err != nil {
+			return fmt.Errorf("cannot encode output %s: %w", name, err)
+		}
+		set(output, &value, name+".value")
+	}
+
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	update := newMapping()
+	set(update, output, moduleShort, "output")
+	merge(state, update)
+	return saveDocument(m.statePath(), state)
+}
+
+func (m *Module) updateStateAfterApply() error {
+	m.logStep("update-state-after-apply", "will update state file after apply")
+	config, err := m.loadConfig()
+	if err != nil {
+		return err
+	}
+	remove(config, "kind")
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	merge(state, config)
+	set(state, newString("applied"), moduleShort, "status")
+	return saveDocument(m.statePath(), state)
+}
+
+func (m *Module) updateStateAfterDestroy() error {
+	m.logStep("update-state-after-destroy", "will clean state file after destroy")
+	state, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	remove(state, moduleShort)
+	set(state, newString("destroyed"), moduleShort, "status")
+	return saveDocument(m.statePath(), state)
+}
+
+func (m *Module) kubeconfig() error {
+	m.logStep("kubeconfig", "will store kubeconfig in a file")
+	st, err := state.Load(m.statePath())
+	if err != nil {
+		return err
+	}
+	if st.AWSKS == nil || st.AWSKS.Output.Kubeconfig == "" {
+		return fmt.Errorf("missing kubeconfig in state file, run apply first")
+	}
+	if st.AWSKS.Output.KubeconfigPrivateOnly {
+		fmt.Fprintf(m.Stdout, "Public API endpoint is disabled, kubeconfig works only from inside VPC %s\n", st.AWSKS.VpcID)
+	}
+	kubeconfig := strings.TrimSuffix(st.AWSKS.Output.Kubeconfig, "\n") + "\n"
+	return ioutil.WriteFile(m.kubeconfigPath(), []byte(kubeconfig), 0644)
+}
@@ -0,0 +1,74 @@
+package awsks
+
+import (
+	"bytes"
+	"text/template"
+)
+
+var metadataTemplate = template.Must(template.New("metadata").Parse(`labels:
+  version: {{ .M_VERSION }}
+  name: AWS Kubernetes Service
+  short: {{ .M_MODULE_SHORT }}
+  kind: infrastructure
+  provider: aws
+`))
+
+var configTemplate = template.Must(template.New("config").Parse(`kind: {{ .M_MODULE_SHORT }}-config
+{{ .M_MODULE_SHORT }}:
+  name: {{ .M_NAME }}
+  vpc_id: {{ .M_VPC_ID }}
+  region: {{ .M_REGION }}
+  k8s_version: "{{ .M_K8S_VERSION }}"
+  autoscaler_version: {{ .M_AUTOSCALER_VERSION }}
+  subnet_ids: {{ .M_SUBNET_IDS }}
+  private_route_table_id: {{ .M_PRIVATE_ROUTE_TABLE_ID }}
+  public_route_table_id: {{ .M_PUBLIC_ROUTE_TABLE_ID }}
+  subnets:
+    count: {{ .M_SUBNET_COUNT }}
+    availability_zones: {{ .M_SUBNET_AVAILABILITY_ZONES }}
+    newbits: {{ .M_SUBNET_NEWBITS }}
+    netnums: {{ .M_SUBNET_NETNUMS }}
+    cidrs: {{ .M_SUBNET_CIDRS }}
+    role: {{ .M_SUBNET_ROLE }}
+  endpoint_private_access: {{ .M_ENDPOINT_PRIVATE_ACCESS }}
+  endpoint_public_access: {{ .M_ENDPOINT_PUBLIC_ACCESS }}
+  public_access_cidrs: {{ .M_PUBLIC_ACCESS_CIDRS }}
+  disk_size: {{ .M_DISK_SIZE }}
+  autoscaler_scale_down_utilization_threshold: {{ .M_AUTOSCALER_SCALE_DOWN_UTILIZATION_THRESHOLD }}
+  ami_type: {{ .M_AMI_TYPE }}
+  ssh_access:
+    enabled: {{ .M_SSH_ACCESS }}
+    key_name: {{ .M_SSH_KEY_NAME }}
+    public_key_path: {{ .M_SSH_PUBLIC_KEY_PATH }}
+    source_security_group_ids: {{ .M_SSH_SOURCE_SECURITY_GROUP_IDS }}
+  encryption:
+    enabled: {{ .M_ENCRYPTION }}
+    kms_key_arn: {{ .M_ENCRYPTION_KMS_KEY_ARN }}
+  log_types: {{ .M_LOG_TYPES }}
+  log_retention_days: {{ .M_LOG_RETENTION_DAYS }}
+  log_kms_key_id: {{ .M_LOG_KMS_KEY_ID }}
+  tags: {{ .M_TAGS }}
+  required_tag_keys: {{ .M_REQUIRED_TAG_KEYS }}
+  addons: {{ .M_ADDONS }}
+  fargate_profiles: {{ .M_FARGATE_PROFILES }}
+  worker_groups: {{ .M_WORKER_GROUPS }}
+`))
+
+var stateInitialTemplate = template.Must(template.New("state").Parse(`kind: state
+{{ .M_MODULE_SHORT }}:
+  status: initialized
+`))
+
+// render substitutes module parameters in template. Values are inserted
+// verbatim, so they can contain YAML fragments like lists.
+func render(t *template.Template, vars Vars) (string, error) {
+	data := map[string]string{"M_MODULE_SHORT": moduleShort}
+	for name, value := range vars {
+		data[name] = value
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
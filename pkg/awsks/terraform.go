@@ -0,0 +1,27 @@
+package awsks
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Terraform runs terraform commands.
+type Terraform interface {
+	// Run executes terraform with args in dir. Variables from env are added
+	// to the environment of the process.
+	Run(dir string, env []string, stdout, stderr io.Writer, args ...string) error
+}
+
+// ExecTerraform runs terraform binary found in PATH.
+type ExecTerraform struct{}
+
+// Run implements Terraform.
+func (ExecTerraform) Run(dir string, env []string, stdout, stderr io.Writer, args ...string) error {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
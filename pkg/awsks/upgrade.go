@@ -0,0 +1,130 @@
+package awsks
+
+import (
+	"fmt"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/tfstate"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/upgrade"
+	"gopkg.in/yaml.v3"
+)
+
+// upgrade moves applied cluster to k8s_version from config file. Progress is
+// stored under awsks.upgrade in state file, so an interrupted upgrade is
+// resumed by running the command again.
+func (m *Module) upgrade() error {
+	m.logStep("upgrade", "will upgrade Kubernetes version of the cluster")
+	c, err := m.loadValidConfig()
+	if err != nil {
+		return err
+	}
+	st, err := state.Load(m.statePath())
+	if err != nil {
+		return err
+	}
+	tf, err := tfstate.Load(m.tfstatePath())
+	if err != nil {
+		return fmt.Errorf("cannot read terraform state: %w", err)
+	}
+	if tf.Instance("aws_eks_cluster") == nil {
+		return fmt.Errorf("terraform state has no aws_eks_cluster resource, run apply first")
+	}
+	clients, err := m.NewClients(st.AWSKS.Region)
+	if err != nil {
+		return err
+	}
+
+	// Autoscaler is not deployed in clusters running only on Fargate.
+	upgradeConfig := upgrade.Config{
+		ClusterName: tf.Instance("aws_eks_cluster").String("name"),
+		Kubeconfig:  st.AWSKS.Output.Kubeconfig,
+		Out:         m.Stdout,
+	}
+	release := tf.Instance("helm_release")
+	if release != nil {
+		upgradeConfig.Release = upgrade.Release{
+			Name:      release.String("name"),
+			Namespace: release.String("namespace"),
+			Chart:     release.String("chart"),
+			Version:   release.String("version"),
+		}
+	}
+	upgrader := upgrade.New(upgradeConfig, clients.EKS, m.Autoscaler)
+
+	target := c.AWSKS.K8sVersion
+	plan := st.AWSKS.Upgrade
+	switch {
+	case plan != nil && !plan.Finished() && plan.To != target:
+		return fmt.Errorf("upgrade to %s is not finished, set k8s_version to %s to resume it", plan.To, plan.To)
+	case plan != nil && !plan.Finished():
+		fmt.Fprintf(m.Stdout, "Resuming upgrade from %s to %s\n", plan.From, plan.To)
+	default:
+		current, err := upgrader.ClusterVersion()
+		if err != nil {
+			return err
+		}
+		if config.CompareVersions(current, target) == 0 {
+			fmt.Fprintf(m.Stdout, "Cluster is already in version %s\n", target)
+			return m.updateStateAfterUpgrade(c)
+		}
+		customAMI := make(map[string]bool)
+		for _, wg := range c.AWSKS.WorkerGroups {
+			customAMI[wg.Name] = wg.CustomAMI()
+		}
+		var nodegroups []string
+		for _, i := range tf.Instances("aws_eks_node_group") {
+			name := i.String("node_group_name")
+			if customAMI[name] {
+				fmt.Fprintf(m.Stdout, "Skipping node group %s with custom AMI, run plan and apply after upgrade to update it\n", name)
+				continue
+			}
+			nodegroups = append(nodegroups, name)
+		}
+		if plan, err = upgrade.NewPlan(current, target, nodegroups, release != nil, c.AWSKS.AutoscalerVersion); err != nil {
+			return err
+		}
+		fmt.Fprintf(m.Stdout, "Upgrading from %s to %s\n", plan.From, plan.To)
+	}
+
+	if err := upgrader.Run(plan, func() error { return m.saveUpgrade(plan) }); err != nil {
+		return err
+	}
+	if len(c.AWSKS.Addons) > 0 {
+		fmt.Fprintf(m.Stdout, "Managed add-ons are not upgraded, run plan and apply to update them for %s\n", target)
+	}
+	if len(c.AWSKS.FargateProfiles) > 0 {
+		fmt.Fprintf(m.Stdout, "Pods running on Fargate keep their version until they are restarted\n")
+	}
+	return m.updateStateAfterUpgrade(c)
+}
+
+// saveUpgrade stores upgrade progress in state file.
+func (m *Module) saveUpgrade(plan *state.Upgrade) error {
+	var node yaml.Node
+	if err := node.Encode(plan); err != nil {
+		return fmt.Errorf("cannot encode upgrade: %w", err)
+	}
+	doc, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	set(doc, &node, moduleShort, "upgrade")
+	return saveDocument(m.statePath(), doc)
+}
+
+// updateStateAfterUpgrade records versions from config in state file, so
+// later plans do not see them as changed.
+func (m *Module) updateStateAfterUpgrade(c *config.Config) error {
+	var autoscaler yaml.Node
+	if err := autoscaler.Encode(c.AWSKS.AutoscalerVersion); err != nil {
+		return err
+	}
+	doc, err := loadDocument(m.statePath())
+	if err != nil {
+		return err
+	}
+	set(doc, newString(c.AWSKS.K8sVersion), moduleShort, "k8s_version")
+	set(doc, &autoscaler, moduleShort, "autoscaler_version")
+	return saveDocument(m.statePath(), doc)
+}
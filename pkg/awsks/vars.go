@@ -0,0 +1,158 @@
+package awsks
+
+import (
+	"fmt"
+	"strings"
+)
+
+const varPrefix = "M_"
+
+// Vars are module parameters named M_*. Values are raw strings and are
+// interpreted as YAML when templated into configuration file, the same way
+// make variables used to be substituted.
+type Vars map[string]string
+
+const defaultWorkerGroups = `[{
+  name: default_wg,
+  instance_type: t2.small,
+  asg_desired_capacity: 1,
+  asg_min_size: 1,
+  asg_max_size: 1,
+}]`
+
+// DefaultVars returns default values of module parameters.
+func DefaultVars() Vars {
+	return Vars{
+		"M_NAME":                      "epiphany",
+		"M_VPC_ID":                    "unset",
+		"M_SUBNET_IDS":                "null",
+		"M_REGION":                    "eu-central-1",
+		"M_K8S_VERSION":               "1.18",
+		"M_AUTOSCALER_VERSION":        "null",
+		"M_PRIVATE_ROUTE_TABLE_ID":    "unset",
+		"M_PUBLIC_ROUTE_TABLE_ID":     "null",
+		"M_SUBNET_COUNT":              "2",
+		"M_SUBNET_AVAILABILITY_ZONES": "null",
+		"M_SUBNET_NEWBITS":            "4",
+		"M_SUBNET_NETNUMS":            "null",
+		"M_SUBNET_CIDRS":              "null",
+		"M_SUBNET_ROLE":               "private",
+		"M_ENDPOINT_PRIVATE_ACCESS":   "false",
+		"M_ENDPOINT_PUBLIC_ACCESS":    "true",
+		"M_PUBLIC_ACCESS_CIDRS":       "null",
+		"M_DISK_SIZE":                 "32",
+		"M_AUTOSCALER_SCALE_DOWN_UTILIZATION_THRESHOLD": "0.65",
+		"M_SSH_ACCESS":                    "false",
+		"M_SSH_KEY_NAME":                  "null",
+		"M_SSH_PUBLIC_KEY_PATH":           "null",
+		"M_SSH_SOURCE_SECURITY_GROUP_IDS": "null",
+		"M_ENCRYPTION":                    "false",
+		"M_ENCRYPTION_KMS_KEY_ARN":        "null",
+		"M_LOG_TYPES":                     "[api, audit]",
+		"M_LOG_RETENTION_DAYS":            "30",
+		"M_LOG_KMS_KEY_ID":                "null",
+		"M_TAGS":                          "{}",
+		"M_REQUIRED_TAG_KEYS":             "[]",
+		"M_ADDONS":                        "[]",
+		"M_FARGATE_PROFILES":              "[]",
+		"M_AMI_TYPE":                      "AL2_x86_64",
+		"M_WORKER_GROUPS":                 defaultWorkerGroups,
+		"M_AWS_ACCESS_KEY":                "unset",
+		"M_AWS_SECRET_KEY":                "unset",
+		"M_ALLOW_DESTRUCTIVE":             "false",
+		"M_RESOURCES":                     "",
+		"M_SHARED":                        "",
+		"M_WORKDIR":                       "",
+		"M_VERSION":                       "",
+	}
+}
+
+// Get returns value of parameter or empty string when it is not set.
+func (v Vars) Get(name string) string {
+	return v[name]
+}
+
+// ParseArgs builds module parameters and list of commands from command line
+// arguments and environment. Parameters are taken from defaults, then
+// overridden by M_* environment variables and finally by arguments. Arguments
+// can set parameters as NAME=value, --NAME=value or --NAME value; every
+// other argument is a command name.
+func ParseArgs(args, environ []string) (Vars, []string, error) {
+	vars := DefaultVars()
+	for _, kv := range environ {
+		if name, value, ok := splitAssignment(kv); ok {
+			vars[name] = value
+		}
+	}
+
+	var commands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			flag := strings.TrimLeft(arg, "-")
+			if name, value, ok := splitAssignment(flag); ok {
+				vars[name] = value
+				continue
+			}
+			if !isVarName(flag) {
+				return nil, nil, fmt.Errorf("unknown flag: %s", arg)
+			}
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("flag needs a value: %s", arg)
+			}
+			i++
+			vars[flag] = args[i]
+			continue
+		}
+		if name, value, ok := splitAssignment(arg); ok {
+			vars[name] = value
+			continue
+		}
+		commands = append(commands, arg)
+	}
+	if err := vars.moveEC2SSHKey(); err != nil {
+		return nil, nil, err
+	}
+	return vars, commands, nil
+}
+
+// moveEC2SSHKey replaces deprecated M_EC2_SSH_KEY with M_SSH_ACCESS and
+// M_SSH_KEY_NAME using the same key pair, as ec2_ssh_key is replaced in
+// configuration file.
+func (v Vars) moveEC2SSHKey() error {
+	key, ok := v["M_EC2_SSH_KEY"]
+	if !ok {
+		return nil
+	}
+	delete(v, "M_EC2_SSH_KEY")
+	if key == "" || key == "null" {
+		return nil
+	}
+	if v["M_SSH_ACCESS"] != "false" || v["M_SSH_KEY_NAME"] != "null" {
+		return fmt.Errorf("M_EC2_SSH_KEY cannot be set together with M_SSH_ACCESS or M_SSH_KEY_NAME, remove deprecated M_EC2_SSH_KEY")
+	}
+	v["M_SSH_ACCESS"] = "true"
+	v["M_SSH_KEY_NAME"] = key
+	return nil
+}
+
+// splitAssignment splits NAME=value when NAME is a module parameter name.
+func splitAssignment(s string) (string, string, bool) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || !isVarName(parts[0]) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func isVarName(s string) bool {
+	if !strings.HasPrefix(s, varPrefix) || len(s) == len(varPrefix) {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package awsks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseDocument parses YAML document and returns its root mapping. Empty
+// document results in empty mapping.
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return newMapping(), nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+		return newMapping(), nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected mapping at document root, got %s", root.Tag)
+	}
+	return root, nil
+}
+
+// loadDocument reads YAML file, missing or empty file results in empty
+// mapping.
+func loadDocument(path string) (*yaml.Node, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newMapping(), nil
+		}
+		return nil, err
+	}
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return root, nil
+}
+
+func encodeDocument(root *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func saveDocument(path string, root *yaml.Node) error {
+	data, err := encodeDocument(root)
+	if err != nil {
+		return fmt.Errorf("cannot encode %s: %w", path, err)
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func newMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func newString(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// lookup returns node found under path of mapping keys or nil.
+func lookup(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var found *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				found = node.Content[i+1]
+				break
+			}
+		}
+		node = found
+	}
+	return node
+}
+
+// set stores value under path of mapping keys creating missing mappings. New
+// keys are appended at the end, existing ones keep their position.
+func set(node *yaml.Node, value *yaml.Node, path ...string) {
+	for i, key := range path {
+		last := i == len(path)-1
+		index := -1
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				index = j + 1
+				break
+			}
+		}
+		if index < 0 {
+			node.Content = append(node.Content, newString(key), newMapping())
+			index = len(node.Content) - 1
+		}
+		if last {
+			node.Content[index] = value
+			return
+		}
+		if node.Content[index].Kind != yaml.MappingNode {
+			node.Content[index] = newMapping()
+		}
+		node = node.Content[index]
+	}
+}
+
+// remove deletes key from mapping.
+func remove(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// merge deeply merges src mapping into dst mapping. Values of src overwrite
+// values of dst, except mappings which are merged key by key. It behaves
+// like `yq merge --overwrite` used by the module before.
+func merge(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i].Value, src.Content[i+1]
+		existing := lookup(dst, key)
+		if existing != nil && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			merge(existing, value)
+			continue
+		}
+		set(dst, clone(value), key)
+	}
+}
+
+func clone(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = clone(child)
+	}
+	return &c
+}
+
+// resetStyle removes flow and quoting styles, so node is encoded in block
+// style like `yq --prettyPrint` does.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
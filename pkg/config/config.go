@@ -0,0 +1,493 @@
+// Package config provides model and validation of the module configuration
+// file awsks-config.yml.
+//
+// Configuration is validated in two passes: against the JSON Schema
+// published with the module (see Schema) and then with checks relating
+// several fields, which cannot be expressed in the schema.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the value of kind field of configuration document.
+const Kind = "awsks-config"
+
+// Config is the awsks-config.yml document.
+type Config struct {
+	Kind  string `yaml:"kind" json:"kind"`
+	AWSKS AWSKS  `yaml:"awsks" json:"awsks"`
+}
+
+// AWSKS is the awsks section of configuration. Its JSON encoding is used as
+// terraform variables file.
+type AWSKS struct {
+	Name                                    string            `yaml:"name" json:"name"`
+	VpcID                                   string            `yaml:"vpc_id" json:"vpc_id"`
+	Region                                  string            `yaml:"region" json:"region"`
+	K8sVersion                              string            `yaml:"k8s_version" json:"k8s_version"`
+	AutoscalerVersion                       *string           `yaml:"autoscaler_version" json:"autoscaler_version"`
+	SubnetIDs                               []string          `yaml:"subnet_ids" json:"subnet_ids"`
+	PrivateRouteTableID                     string            `yaml:"private_route_table_id" json:"private_route_table_id"`
+	PublicRouteTableID                      *string           `yaml:"public_route_table_id" json:"public_route_table_id"`
+	Subnets                                 Subnets           `yaml:"subnets" json:"subnets"`
+	EndpointPrivateAccess                   bool              `yaml:"endpoint_private_access" json:"endpoint_private_access"`
+	EndpointPublicAccess                    bool              `yaml:"endpoint_public_access" json:"endpoint_public_access"`
+	PublicAccessCIDRs                       []string          `yaml:"public_access_cidrs" json:"public_access_cidrs"`
+	DiskSize                                int               `yaml:"disk_size" json:"disk_size"`
+	AutoscalerScaleDownUtilizationThreshold float64           `yaml:"autoscaler_scale_down_utilization_threshold" json:"autoscaler_scale_down_utilization_threshold"`
+	AmiType                                 string            `yaml:"ami_type" json:"ami_type"`
+	SSHAccess                               SSHAccess         `yaml:"ssh_access" json:"ssh_access"`
+	Encryption                              Encryption        `yaml:"encryption" json:"encryption"`
+	LogTypes                                []string          `yaml:"log_types" json:"log_types"`
+	LogRetentionDays                        int               `yaml:"log_retention_days" json:"log_retention_days"`
+	LogKMSKeyID                             *string           `yaml:"log_kms_key_id" json:"log_kms_key_id"`
+	Tags                                    map[string]string `yaml:"tags" json:"tags"`
+	Addons                                  []Addon           `yaml:"addons" json:"addons"`
+	FargateProfiles                         []FargateProfile  `yaml:"fargate_profiles" json:"fargate_profiles"`
+	WorkerGroups                            []WorkerGroup     `yaml:"worker_groups" json:"worker_groups"`
+	// RequiredTagKeys are tag keys every taggable resource of the plan has
+	// to have. They are checked by plan only and not passed to terraform.
+	RequiredTagKeys []string `yaml:"required_tag_keys" json:"-"`
+	// EC2SSHKey is the key pair of configuration files written before
+	// ssh_access was added. Parse moves it to SSHAccess.
+	EC2SSHKey *string `yaml:"ec2_ssh_key" json:"-"`
+}
+
+// DefaultAWSKS returns values of fields which configuration files written by
+// earlier versions of the module do not have. They match the defaults of
+// init parameters and the schema.
+func DefaultAWSKS() AWSKS {
+	return AWSKS{
+		K8sVersion:           "1.18",
+		Subnets:              Subnets{Count: 2, Newbits: 4, Role: "private"},
+		EndpointPublicAccess: true,
+		LogTypes:             []string{"api", "audit"},
+		LogRetentionDays:     30,
+		Tags:                 map[string]string{},
+		RequiredTagKeys:      []string{},
+		Addons:               []Addon{},
+		FargateProfiles:      []FargateProfile{},
+	}
+}
+
+// Subnets is the layout of subnets created by the module when subnet_ids is
+// null. CIDR blocks are either listed in CIDRs or computed from the VPC CIDR
+// block like terraform cidrsubnet(vpc_cidr, newbits, netnum).
+type Subnets struct {
+	Count int `yaml:"count" json:"count"`
+	// AvailabilityZones are used round-robin, all available zones of the
+	// region when not set.
+	AvailabilityZones []string `yaml:"availability_zones" json:"availability_zones"`
+	Newbits           int      `yaml:"newbits" json:"newbits"`
+	// Netnums default to the last Count networks of the VPC counting down,
+	// which is the layout used before subnets were configurable.
+	Netnums []int    `yaml:"netnums" json:"netnums"`
+	CIDRs   []string `yaml:"cidrs" json:"cidrs"`
+	// Role selects load balancers placed in subnets, internal for private
+	// subnets and internet-facing for public ones.
+	Role string `yaml:"role" json:"role"`
+}
+
+// SubnetRolePublic is role of subnets routed to an internet gateway.
+const SubnetRolePublic = "public"
+
+// SSHAccess configures SSH access to worker nodes. Key pair is either an
+// existing one or imported by the module from a public key file.
+type SSHAccess struct {
+	Enabled bool    `yaml:"enabled" json:"enabled"`
+	KeyName *string `yaml:"key_name" json:"key_name"`
+	// PublicKeyPath is a public key file, relative to the shared directory
+	// when not absolute. Its content is passed to terraform separately.
+	PublicKeyPath          *string  `yaml:"public_key_path" json:"public_key_path"`
+	SourceSecurityGroupIDs []string `yaml:"source_security_group_ids" json:"source_security_group_ids"`
+}
+
+// Encryption configures envelope encryption of Kubernetes secrets. The module
+// creates a KMS key unless KMSKeyARN of an existing one is set.
+type Encryption struct {
+	Enabled   bool    `yaml:"enabled" json:"enabled"`
+	KMSKeyARN *string `yaml:"kms_key_arn" json:"kms_key_arn"`
+}
+
+// Addon is an EKS managed add-on installed on the cluster.
+type Addon struct {
+	Name string `yaml:"name" json:"name"`
+	// Version pins add-on version, the default version of k8s_version from
+	// AddonVersions is used when not set.
+	Version *string `yaml:"version" json:"version"`
+	// ResolveConflicts is either NONE, which fails when configuration of
+	// add-on in the cluster differs, or OVERWRITE.
+	ResolveConflicts string `yaml:"resolve_conflicts" json:"resolve_conflicts"`
+}
+
+// AddonKubeProxy is the add-on which has to match the cluster version.
+const AddonKubeProxy = "kube-proxy"
+
+// FargateProfile runs pods matching any of its selectors on Fargate instead
+// of worker group nodes.
+type FargateProfile struct {
+	Name      string            `yaml:"name" json:"name"`
+	Selectors []FargateSelector `yaml:"selectors" json:"selectors"`
+	// SubnetIDs default to subnets of the cluster. Fargate runs pods only in
+	// private subnets.
+	SubnetIDs []string `yaml:"subnet_ids" json:"subnet_ids"`
+}
+
+// FargateSelector matches pods in Namespace having all Labels.
+type FargateSelector struct {
+	Namespace string            `yaml:"namespace" json:"namespace"`
+	Labels    map[string]string `yaml:"labels" json:"labels"`
+}
+
+// WorkerGroup is a single EKS node group definition. Optional fields are
+// encoded as null when unset, as terraform requires every attribute of the
+// worker group object, and fall back to global values in terraform.
+type WorkerGroup struct {
+	Name               string            `yaml:"name" json:"name"`
+	InstanceType       string            `yaml:"instance_type" json:"instance_type"`
+	InstanceTypes      []string          `yaml:"instance_types" json:"instance_types"`
+	CapacityType       *string           `yaml:"capacity_type" json:"capacity_type"`
+	AsgDesiredCapacity int               `yaml:"asg_desired_capacity" json:"asg_desired_capacity"`
+	AsgMinSize         int               `yaml:"asg_min_size" json:"asg_min_size"`
+	AsgMaxSize         int               `yaml:"asg_max_size" json:"asg_max_size"`
+	DiskSize           *int              `yaml:"disk_size" json:"disk_size"`
+	AmiType            *string           `yaml:"ami_type" json:"ami_type"`
+	Labels             map[string]string `yaml:"labels" json:"labels"`
+	Taints             []Taint           `yaml:"taints" json:"taints"`
+	Tags               map[string]string `yaml:"tags" json:"tags"`
+	LaunchTemplate     *LaunchTemplate   `yaml:"launch_template" json:"launch_template"`
+	// AllowSingleSpotInstanceType permits SPOT capacity with one instance
+	// type. It is checked by Validate only and not passed to terraform.
+	AllowSingleSpotInstanceType bool `yaml:"allow_single_spot_instance_type" json:"-"`
+}
+
+// CapacitySpot is capacity_type of worker groups running on spot instances.
+const CapacitySpot = "SPOT"
+
+// AllInstanceTypes returns instance_types or instance_type when the list is
+// not set.
+func (wg WorkerGroup) AllInstanceTypes() []string {
+	if wg.InstanceTypes != nil {
+		return wg.InstanceTypes
+	}
+	return []string{wg.InstanceType}
+}
+
+// CustomAMI reports whether nodes run AMI selected by the module instead of
+// EKS. Such node groups are upgraded by terraform, not by EKS.
+func (wg WorkerGroup) CustomAMI() bool {
+	return wg.LaunchTemplate != nil && wg.LaunchTemplate.BootstrapArgs != nil
+}
+
+// HasAutoscaler reports whether cluster autoscaler is deployed. It is skipped
+// in clusters running all pods on Fargate, as there are no nodes to scale.
+func (c AWSKS) HasAutoscaler() bool {
+	return len(c.WorkerGroups) > 0
+}
+
+// LaunchTemplate are settings of EC2 launch template rendered by the module
+// for a worker group.
+type LaunchTemplate struct {
+	// UserData is a shell script run on nodes before they join the cluster.
+	UserData *string `yaml:"user_data" json:"user_data"`
+	// BootstrapArgs are arguments of EKS bootstrap script. When set, the
+	// module selects EKS optimized AMI itself, as EKS passes no arguments.
+	BootstrapArgs                   *string  `yaml:"bootstrap_args" json:"bootstrap_args"`
+	MetadataHTTPTokens              *string  `yaml:"metadata_http_tokens" json:"metadata_http_tokens"`
+	MetadataHTTPPutResponseHopLimit *int     `yaml:"metadata_http_put_response_hop_limit" json:"metadata_http_put_response_hop_limit"`
+	EBSEncrypted                    bool     `yaml:"ebs_encrypted" json:"ebs_encrypted"`
+	EBSKMSKeyID                     *string  `yaml:"ebs_kms_key_id" json:"ebs_kms_key_id"`
+	SecurityGroupIDs                []string `yaml:"security_group_ids" json:"security_group_ids"`
+}
+
+// Taint is a Kubernetes taint applied to nodes of a worker group.
+type Taint struct {
+	Key    string `yaml:"key" json:"key"`
+	Value  string `yaml:"value" json:"value"`
+	Effect string `yaml:"effect" json:"effect"`
+}
+
+var schema = jsonschema.MustCompileString(SchemaURL, Schema)
+
+// FieldError is a validation error of a single configuration field.
+type FieldError struct {
+	// Field is a path to the field, e.g. awsks.worker_groups[0].asg_min_size.
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors lists all problems found in configuration.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+// sorted orders errors by field, as schema validation reports them in no
+// particular order.
+func (e ValidationErrors) sorted() ValidationErrors {
+	sort.SliceStable(e, func(i, j int) bool { return e[i].Field < e[j].Field })
+	return e
+}
+
+// Load reads and validates configuration file.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse validates configuration document and decodes it. Returned error is
+// ValidationErrors when document is well-formed YAML but not a valid
+// configuration.
+func Parse(data []byte) (*Config, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse configuration: %w", err)
+	}
+	errs := validateSchema(doc)
+
+	// Fields missing in the document keep their defaults.
+	c := Config{AWSKS: DefaultAWSKS()}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		if len(errs) > 0 {
+			return nil, errs.sorted()
+		}
+		return nil, fmt.Errorf("cannot decode configuration: %w", err)
+	}
+	errs = append(errs, c.AWSKS.moveEC2SSHKey()...)
+	errs = append(errs, c.Validate()...)
+	if len(errs) > 0 {
+		return nil, errs.sorted()
+	}
+	return &c, nil
+}
+
+// moveEC2SSHKey replaces deprecated ec2_ssh_key with ssh_access using the
+// same key pair.
+func (c *AWSKS) moveEC2SSHKey() ValidationErrors {
+	if c.EC2SSHKey == nil {
+		return nil
+	}
+	if ssh := c.SSHAccess; ssh.Enabled || ssh.KeyName != nil || ssh.PublicKeyPath != nil || ssh.SourceSecurityGroupIDs != nil {
+		return ValidationErrors{{Field: "awsks.ec2_ssh_key", Message: "cannot be set together with ssh_access, remove deprecated ec2_ssh_key"}}
+	}
+	c.SSHAccess = SSHAccess{Enabled: true, KeyName: c.EC2SSHKey}
+	c.EC2SSHKey = nil
+	return nil
+}
+
+// Validate checks constraints relating several fields, which are not covered
+// by the schema.
+func (c *Config) Validate() ValidationErrors {
+	var errs ValidationErrors
+	if err := CheckK8sVersion(c.AWSKS.K8sVersion); err != nil {
+		errs = append(errs, FieldError{Field: "awsks.k8s_version", Message: err.Error()})
+	} else {
+		if v := c.AWSKS.AutoscalerVersion; v != nil {
+			if err := CheckAutoscalerVersion(*v, c.AWSKS.K8sVersion); err != nil {
+				errs = append(errs, FieldError{Field: "awsks.autoscaler_version", Message: err.Error()})
+			}
+		}
+		errs = append(errs, validateAddonVersions(c.AWSKS.Addons, c.AWSKS.K8sVersion)...)
+	}
+	switch {
+	case !c.AWSKS.EndpointPrivateAccess && !c.AWSKS.EndpointPublicAccess:
+		errs = append(errs, FieldError{Field: "awsks.endpoint_public_access", Message: "cannot be false when endpoint_private_access is false, API endpoint would not be reachable"})
+	case !c.AWSKS.EndpointPublicAccess && c.AWSKS.PublicAccessCIDRs != nil:
+		errs = append(errs, FieldError{Field: "awsks.public_access_cidrs", Message: "requires endpoint_public_access to be true"})
+	}
+	for i, cidr := range c.AWSKS.PublicAccessCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("awsks.public_access_cidrs[%d]", i), Message: fmt.Sprintf("%q is not a valid CIDR block", cidr)})
+		}
+	}
+	errs = append(errs, c.AWSKS.Subnets.validate(c.AWSKS.Region)...)
+	switch public := c.AWSKS.Subnets.Role == SubnetRolePublic; {
+	case c.AWSKS.SubnetIDs == nil && public && c.AWSKS.PublicRouteTableID == nil:
+		errs = append(errs, FieldError{Field: "awsks.public_route_table_id", Message: "is required when subnets.role is public, public subnets have to be routed to an internet gateway"})
+	case !public && c.AWSKS.PublicRouteTableID != nil:
+		errs = append(errs, FieldError{Field: "awsks.public_route_table_id", Message: "requires subnets.role to be public"})
+	}
+	if c.AWSKS.Encryption.KMSKeyARN != nil && !c.AWSKS.Encryption.Enabled {
+		errs = append(errs, FieldError{Field: "awsks.encryption.kms_key_arn", Message: "requires enabled to be true"})
+	}
+	for _, key := range c.AWSKS.RequiredTagKeys {
+		if _, ok := c.AWSKS.Tags[key]; !ok {
+			errs = append(errs, FieldError{Field: "awsks.tags", Message: fmt.Sprintf("missing required tag key %q", key)})
+		}
+	}
+	ssh := c.AWSKS.SSHAccess
+	switch {
+	case ssh.KeyName != nil && ssh.PublicKeyPath != nil:
+		errs = append(errs, FieldError{Field: "awsks.ssh_access.public_key_path", Message: "cannot be set together with key_name"})
+	case ssh.Enabled && ssh.KeyName == nil && ssh.PublicKeyPath == nil:
+		errs = append(errs, FieldError{Field: "awsks.ssh_access.key_name", Message: "is required when ssh access is enabled and public_key_path is not set"})
+	case !ssh.Enabled && ssh.SourceSecurityGroupIDs != nil:
+		errs = append(errs, FieldError{Field: "awsks.ssh_access.source_security_group_ids", Message: "requires enabled to be true"})
+	}
+	addons := make(map[string]int)
+	for i, addon := range c.AWSKS.Addons {
+		if j, ok := addons[addon.Name]; ok {
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("awsks.addons[%d].name", i),
+				Message: fmt.Sprintf("duplicates name of awsks.addons[%d]", j),
+			})
+		}
+		addons[addon.Name] = i
+	}
+	profiles := make(map[string]int)
+	for i, profile := range c.AWSKS.FargateProfiles {
+		field := fmt.Sprintf("awsks.fargate_profiles[%d]", i)
+		if profile.SubnetIDs == nil && c.AWSKS.SubnetIDs == nil && c.AWSKS.Subnets.Role == SubnetRolePublic {
+			errs = append(errs, FieldError{Field: field + ".subnet_ids", Message: "is required when subnets.role is public, Fargate runs pods only in private subnets"})
+		}
+		if j, ok := profiles[profile.Name]; ok {
+			errs = append(errs, FieldError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("duplicates name of awsks.fargate_profiles[%d]", j),
+			})
+		}
+		profiles[profile.Name] = i
+	}
+	if len(c.AWSKS.WorkerGroups) == 0 && len(c.AWSKS.FargateProfiles) == 0 {
+		errs = append(errs, FieldError{Field: "awsks.worker_groups", Message: "cannot be empty when fargate_profiles is empty, pods would have nowhere to run"})
+	}
+	names := make(map[string]int)
+	for i, wg := range c.AWSKS.WorkerGroups {
+		field := fmt.Sprintf("awsks.worker_groups[%d]", i)
+		if wg.AsgMinSize > wg.AsgMaxSize {
+			errs = append(errs, FieldError{
+				Field:   field + ".asg_min_size",
+				Message: fmt.Sprintf("must not be greater than asg_max_size (%d > %d)", wg.AsgMinSize, wg.AsgMaxSize),
+			})
+		} else if wg.AsgDesiredCapacity < wg.AsgMinSize || wg.AsgDesiredCapacity > wg.AsgMaxSize {
+			errs = append(errs, FieldError{
+				Field:   field + ".asg_desired_capacity",
+				Message: fmt.Sprintf("must be between asg_min_size and asg_max_size (%d not in %d..%d)", wg.AsgDesiredCapacity, wg.AsgMinSize, wg.AsgMaxSize),
+			})
+		}
+		switch {
+		case wg.InstanceType == "" && len(wg.InstanceTypes) == 0:
+			errs = append(errs, FieldError{Field: field + ".instance_type", Message: "is required when instance_types is not set"})
+		case wg.InstanceType != "" && len(wg.InstanceTypes) > 0:
+			errs = append(errs, FieldError{Field: field + ".instance_types", Message: "cannot be set together with instance_type"})
+		case wg.CapacityType != nil && *wg.CapacityType == CapacitySpot && len(wg.AllInstanceTypes()) < 2 && !wg.AllowSingleSpotInstanceType:
+			errs = append(errs, FieldError{
+				Field:   field + ".instance_types",
+				Message: "SPOT worker group needs at least 2 instance types to limit interruptions, set allow_single_spot_instance_type to use one",
+			})
+		}
+		if lt := wg.LaunchTemplate; lt != nil && lt.EBSKMSKeyID != nil && !lt.EBSEncrypted {
+			errs = append(errs, FieldError{Field: field + ".launch_template.ebs_kms_key_id", Message: "requires ebs_encrypted to be true"})
+		}
+		if wg.LaunchTemplate != nil && ssh.Enabled && ssh.SourceSecurityGroupIDs != nil {
+			// EKS restricts SSH to source security groups only in node groups without launch template.
+			errs = append(errs, FieldError{Field: field + ".launch_template", Message: "cannot be used together with ssh_access.source_security_group_ids"})
+		}
+		taints := make(map[Taint]int)
+		for j, taint := range wg.Taints {
+			key := Taint{Key: taint.Key, Effect: taint.Effect}
+			if k, ok := taints[key]; ok {
+				errs = append(errs, FieldError{
+					Field:   fmt.Sprintf("%s.taints[%d]", field, j),
+					Message: fmt.Sprintf("duplicates key and effect of %s.taints[%d]", field, k),
+				})
+			}
+			taints[key] = j
+		}
+		if j, ok := names[wg.Name]; ok {
+			errs = append(errs, FieldError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("duplicates name of awsks.worker_groups[%d]", j),
+			})
+		}
+		names[wg.Name] = i
+	}
+	return errs
+}
+
+func validateSchema(doc interface{}) ValidationErrors {
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return ValidationErrors{{Field: "(document)", Message: err.Error()}}
+	}
+
+	var errs ValidationErrors
+	var collect func(*jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			// Enums allowing null list it as Go nil.
+			message := strings.ReplaceAll(e.Message, "<nil>", "null")
+			errs = append(errs, FieldError{Field: fieldPath(e.InstanceLocation), Message: message})
+			return
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(ve)
+	return errs
+}
+
+// fieldPath converts JSON pointer like /awsks/worker_groups/0/name to
+// awsks.worker_groups[0].name.
+func fieldPath(pointer string) string {
+	if pointer == "" {
+		return "(document)"
+	}
+	var b strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if isIndex(token) {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+func isIndex(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
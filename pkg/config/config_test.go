@@ -0,0 +1,927 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+const validConfig = `kind: awsks-config
+awsks:
+  name: epiphany
+  vpc_id: vpc-0baa2c4e9e48e608c
+  region: eu-central-1
+  k8s_version: "1.18"
+  autoscaler_version: null
+  subnet_ids: null
+  private_route_table_id: rtb-0ffd4cbe3a8dc8c7b
+  public_route_table_id: null
+  subnets:
+    count: 2
+    availability_zones: null
+    newbits: 4
+    netnums: null
+    cidrs: null
+    role: private
+  endpoint_private_access: false
+  endpoint_public_access: true
+  public_access_cidrs: null
+  disk_size: 32
+  autoscaler_scale_down_utilization_threshold: 0.65
+  ami_type: AL2_x86_64
+  ssh_access:
+    enabled: false
+    key_name: null
+    public_key_path: null
+    source_security_group_ids: null
+  encryption:
+    enabled: false
+    kms_key_arn: null
+  log_types:
+    - api
+    - audit
+  log_retention_days: 30
+  log_kms_key_id: null
+  tags: {}
+  required_tag_keys: []
+  addons: []
+  fargate_profiles: []
+  worker_groups:
+    - name: default_wg
+      instance_type: t2.small
+      asg_desired_capacity: 1
+      asg_min_size: 1
+      asg_max_size: 1
+`
+
+// validWorkerGroups is the worker_groups section of validConfig.
+const validWorkerGroups = `worker_groups:
+    - name: default_wg
+      instance_type: t2.small
+      asg_desired_capacity: 1
+      asg_min_size: 1
+      asg_max_size: 1
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	want := &Config{
+		Kind: Kind,
+		AWSKS: AWSKS{
+			Name:                                    "epiphany",
+			VpcID:                                   "vpc-0baa2c4e9e48e608c",
+			Region:                                  "eu-central-1",
+			K8sVersion:                              "1.18",
+			PrivateRouteTableID:                     "rtb-0ffd4cbe3a8dc8c7b",
+			Subnets:                                 Subnets{Count: 2, Newbits: 4, Role: "private"},
+			EndpointPublicAccess:                    true,
+			DiskSize:                                32,
+			AutoscalerScaleDownUtilizationThreshold: 0.65,
+			AmiType:                                 "AL2_x86_64",
+			LogTypes:                                []string{"api", "audit"},
+			LogRetentionDays:                        30,
+			Tags:                                    map[string]string{},
+			RequiredTagKeys:                         []string{},
+			Addons:                                  []Addon{},
+			FargateProfiles:                         []FargateProfile{},
+			WorkerGroups: []WorkerGroup{
+				{Name: "default_wg", InstanceType: "t2.small", AsgDesiredCapacity: 1, AsgMinSize: 1, AsgMaxSize: 1},
+			},
+		},
+	}
+	if diff := deep.Equal(c, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// legacyConfig is a configuration file written by the first versions of the
+// module, with deprecated ec2_ssh_key and without later optional fields.
+const legacyConfig = `kind: awsks-config
+awsks:
+  name: epiphany
+  vpc_id: vpc-0baa2c4e9e48e608c
+  region: eu-central-1
+  subnet_ids: null
+  private_route_table_id: rtb-0ffd4cbe3a8dc8c7b
+  disk_size: 32
+  autoscaler_scale_down_utilization_threshold: 0.65
+  ami_type: AL2_x86_64
+  ec2_ssh_key: admin
+  worker_groups:
+    - name: default_wg
+      instance_type: t2.small
+      asg_desired_capacity: 1
+      asg_min_size: 1
+      asg_max_size: 1
+`
+
+func TestParseLegacy(t *testing.T) {
+	c, err := Parse([]byte(legacyConfig))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	want, err := Parse([]byte(strings.NewReplacer(
+		"enabled: false\n    key_name: null", "enabled: true\n    key_name: admin",
+	).Replace(validConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(c, want); diff != nil {
+		t.Error(diff)
+	}
+
+	_, err = Parse([]byte(strings.Replace(legacyConfig, "  ec2_ssh_key: admin", "  ec2_ssh_key: admin\n  ssh_access: {enabled: true, key_name: other}", 1)))
+	wantErr := ValidationErrors{{Field: "awsks.ec2_ssh_key", Message: "cannot be set together with ssh_access, remove deprecated ec2_ssh_key"}}
+	if diff := deep.Equal(err, wantErr); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// TestSchemaDefaults checks that defaults published in the schema are the
+// ones Parse uses for missing fields.
+func TestSchemaDefaults(t *testing.T) {
+	var schema struct {
+		Properties struct {
+			AWSKS struct {
+				Required   []string                   `json:"required"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"awsks"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(Schema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(DefaultAWSKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaults map[string]interface{}
+	if err := json.Unmarshal(encoded, &defaults); err != nil {
+		t.Fatal(err)
+	}
+	defaults["required_tag_keys"] = []interface{}{}
+
+	required := make(map[string]bool)
+	for _, name := range schema.Properties.AWSKS.Required {
+		required[name] = true
+	}
+	for name, raw := range schema.Properties.AWSKS.Properties {
+		var property struct {
+			Default    json.RawMessage `json:"default"`
+			Deprecated bool            `json:"deprecated"`
+		}
+		if err := json.Unmarshal(raw, &property); err != nil {
+			t.Fatal(err)
+		}
+		if required[name] || property.Deprecated {
+			continue
+		}
+		if property.Default == nil {
+			t.Errorf("optional awsks.%s has no default in schema", name)
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(property.Default, &value); err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(value, defaults[name]); diff != nil {
+			t.Errorf("default of awsks.%s differs from DefaultAWSKS: %v", name, diff)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		replacer *strings.Replacer
+		want     ValidationErrors
+	}{
+		{
+			name:     "vpc_id unset",
+			replacer: strings.NewReplacer("vpc_id: vpc-0baa2c4e9e48e608c", "vpc_id: unset"),
+			want:     ValidationErrors{{Field: "awsks.vpc_id", Message: "does not match pattern '^vpc-[0-9a-f]+$'"}},
+		},
+		{
+			name:     "single subnet",
+			replacer: strings.NewReplacer("subnet_ids: null", "subnet_ids: [subnet-0a1b]"),
+			want:     ValidationErrors{{Field: "awsks.subnet_ids", Message: "minimum 2 items required, but found 1 items"}},
+		},
+		{
+			name:     "existing subnets do not need route table",
+			replacer: strings.NewReplacer("subnet_ids: null", "subnet_ids: [subnet-0a1b, subnet-0a1c]", "rtb-0ffd4cbe3a8dc8c7b", "unset"),
+		},
+		{
+			name:     "created subnets without route table",
+			replacer: strings.NewReplacer("rtb-0ffd4cbe3a8dc8c7b", "unset"),
+			want:     ValidationErrors{{Field: "awsks.private_route_table_id", Message: "does not match pattern '^rtb-[0-9a-f]+$'"}},
+		},
+		{
+			name: "subnets with zones and netnums",
+			replacer: strings.NewReplacer(
+				"count: 2", "count: 3",
+				"availability_zones: null", "availability_zones: [eu-central-1a, eu-central-1b]",
+				"netnums: null", "netnums: [0, 1, 2]",
+				"role: private", "role: public",
+				"public_route_table_id: null", "public_route_table_id: rtb-0a1b2c3d",
+			),
+		},
+		{
+			name:     "public subnets without public route table",
+			replacer: strings.NewReplacer("role: private", "role: public"),
+			want: ValidationErrors{{
+				Field:   "awsks.public_route_table_id",
+				Message: "is required when subnets.role is public, public subnets have to be routed to an internet gateway",
+			}},
+		},
+		{
+			name: "public subnets without private route table",
+			replacer: strings.NewReplacer(
+				"rtb-0ffd4cbe3a8dc8c7b", "unset",
+				"role: private", "role: public",
+				"public_route_table_id: null", "public_route_table_id: rtb-0a1b2c3d",
+			),
+		},
+		{
+			name:     "existing public subnets without public route table",
+			replacer: strings.NewReplacer("subnet_ids: null", "subnet_ids: [subnet-0a1b, subnet-0a1c]", "role: private", "role: public"),
+		},
+		{
+			name:     "public route table of private subnets",
+			replacer: strings.NewReplacer("public_route_table_id: null", "public_route_table_id: rtb-0a1b2c3d"),
+			want:     ValidationErrors{{Field: "awsks.public_route_table_id", Message: "requires subnets.role to be public"}},
+		},
+		{
+			name:     "single created subnet",
+			replacer: strings.NewReplacer("count: 2", "count: 1"),
+			want:     ValidationErrors{{Field: "awsks.subnets.count", Message: "must be >= 2 but found 1"}},
+		},
+		{
+			name:     "subnet zone in other region",
+			replacer: strings.NewReplacer("availability_zones: null", "availability_zones: [eu-central-1a, eu-west-1a]"),
+			want:     ValidationErrors{{Field: "awsks.subnets.availability_zones[1]", Message: `"eu-west-1a" is not in region eu-central-1`}},
+		},
+		{
+			name:     "more subnets than networks",
+			replacer: strings.NewReplacer("count: 2", "count: 3", "newbits: 4", "newbits: 1"),
+			want:     ValidationErrors{{Field: "awsks.subnets.count", Message: "must not be greater than 2 networks available with newbits 1"}},
+		},
+		{
+			name:     "netnum out of range",
+			replacer: strings.NewReplacer("netnums: null", "netnums: [0, 16]"),
+			want:     ValidationErrors{{Field: "awsks.subnets.netnums[1]", Message: "must be less than 16 with newbits 4"}},
+		},
+		{
+			name:     "netnums not matching count",
+			replacer: strings.NewReplacer("netnums: null", "netnums: [0]"),
+			want:     ValidationErrors{{Field: "awsks.subnets.netnums", Message: "must have count items (2), got 1"}},
+		},
+		{
+			name:     "cidrs with netnums",
+			replacer: strings.NewReplacer("netnums: null", "netnums: [0, 1]", "cidrs: null", "cidrs: [10.0.0.0/24, 10.0.1.0/24]"),
+			want:     ValidationErrors{{Field: "awsks.subnets.cidrs", Message: "cannot be set together with netnums"}},
+		},
+		{
+			name:     "invalid cidrs",
+			replacer: strings.NewReplacer("count: 2", "count: 4", "cidrs: null", "cidrs: [10.0.0.0/24, 10.0.0.128/25, 10.0.2.1/24, fd00::/64]"),
+			want: ValidationErrors{
+				{Field: "awsks.subnets.cidrs[1]", Message: "overlaps awsks.subnets.cidrs[0]"},
+				{Field: "awsks.subnets.cidrs[2]", Message: `"10.0.2.1/24" has host bits set, network address is 10.0.2.0/24`},
+				{Field: "awsks.subnets.cidrs[3]", Message: `"fd00::/64" is not a valid IPv4 CIDR block`},
+			},
+		},
+		{
+			name:     "unknown subnet role",
+			replacer: strings.NewReplacer("role: private", "role: isolated"),
+			want:     ValidationErrors{{Field: "awsks.subnets.role", Message: `value must be one of "private", "public"`}},
+		},
+		{
+			name:     "private endpoint with restricted public endpoint",
+			replacer: strings.NewReplacer("endpoint_private_access: false", "endpoint_private_access: true", "public_access_cidrs: null", "public_access_cidrs: [203.0.113.0/24]"),
+		},
+		{
+			name:     "private endpoint only",
+			replacer: strings.NewReplacer("endpoint_private_access: false", "endpoint_private_access: true", "endpoint_public_access: true", "endpoint_public_access: false"),
+		},
+		{
+			name:     "closed endpoint",
+			replacer: strings.NewReplacer("endpoint_public_access: true", "endpoint_public_access: false"),
+			want: ValidationErrors{{
+				Field:   "awsks.endpoint_public_access",
+				Message: "cannot be false when endpoint_private_access is false, API endpoint would not be reachable",
+			}},
+		},
+		{
+			name: "public access cidrs without public endpoint",
+			replacer: strings.NewReplacer(
+				"endpoint_private_access: false", "endpoint_private_access: true",
+				"endpoint_public_access: true", "endpoint_public_access: false",
+				"public_access_cidrs: null", "public_access_cidrs: [203.0.113.0/24]",
+			),
+			want: ValidationErrors{{Field: "awsks.public_access_cidrs", Message: "requires endpoint_public_access to be true"}},
+		},
+		{
+			name:     "invalid public access cidr",
+			replacer: strings.NewReplacer("public_access_cidrs: null", "public_access_cidrs: [203.0.113.0/24, 203.0.113.300/32]"),
+			want:     ValidationErrors{{Field: "awsks.public_access_cidrs[1]", Message: `"203.0.113.300/32" is not a valid CIDR block`}},
+		},
+		{
+			name:     "min size greater than max size",
+			replacer: strings.NewReplacer("asg_min_size: 1", "asg_min_size: 3"),
+			want:     ValidationErrors{{Field: "awsks.worker_groups[0].asg_min_size", Message: "must not be greater than asg_max_size (3 > 1)"}},
+		},
+		{
+			name: "worker group overrides",
+			replacer: strings.NewReplacer("asg_max_size: 1", `asg_max_size: 1
+      disk_size: 100
+      ami_type: AL2_ARM_64
+      labels: {pool: memory}
+      taints: [{key: dedicated, value: memory, effect: NO_SCHEDULE}, {key: dedicated, effect: NO_EXECUTE}]
+      tags: {team: data}`),
+		},
+		{
+			name:     "unknown taint effect",
+			replacer: strings.NewReplacer("asg_max_size: 1", "asg_max_size: 1\n      taints: [{key: dedicated, effect: NoSchedule}]"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].taints[0].effect",
+				Message: `value must be one of "NO_SCHEDULE", "NO_EXECUTE", "PREFER_NO_SCHEDULE"`,
+			}},
+		},
+		{
+			name:     "duplicated taint",
+			replacer: strings.NewReplacer("asg_max_size: 1", "asg_max_size: 1\n      taints: [{key: a, value: x, effect: NO_SCHEDULE}, {key: a, value: y, effect: NO_SCHEDULE}]"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].taints[1]",
+				Message: "duplicates key and effect of awsks.worker_groups[0].taints[0]",
+			}},
+		},
+		{
+			name:     "label is not a string",
+			replacer: strings.NewReplacer("asg_max_size: 1", "asg_max_size: 1\n      labels: {gpu: true}"),
+			want:     ValidationErrors{{Field: "awsks.worker_groups[0].labels.gpu", Message: "expected string, but got boolean"}},
+		},
+		{
+			name:     "spot with several instance types",
+			replacer: strings.NewReplacer("instance_type: t2.small", "instance_types: [m5.large, m5a.large]\n      capacity_type: SPOT"),
+		},
+		{
+			name:     "spot with single instance type",
+			replacer: strings.NewReplacer("instance_type: t2.small", "instance_type: t2.small\n      capacity_type: SPOT"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].instance_types",
+				Message: "SPOT worker group needs at least 2 instance types to limit interruptions, set allow_single_spot_instance_type to use one",
+			}},
+		},
+		{
+			name:     "spot with allowed single instance type",
+			replacer: strings.NewReplacer("instance_type: t2.small", "instance_types: [t2.small]\n      capacity_type: SPOT\n      allow_single_spot_instance_type: true"),
+		},
+		{
+			name:     "instance type and instance types",
+			replacer: strings.NewReplacer("instance_type: t2.small", "instance_type: t2.small\n      instance_types: [t3.small]"),
+			want:     ValidationErrors{{Field: "awsks.worker_groups[0].instance_types", Message: "cannot be set together with instance_type"}},
+		},
+		{
+			name:     "no instance type",
+			replacer: strings.NewReplacer("instance_type: t2.small", "capacity_type: ON_DEMAND"),
+			want:     ValidationErrors{{Field: "awsks.worker_groups[0].instance_type", Message: "is required when instance_types is not set"}},
+		},
+		{
+			name: "launch template",
+			replacer: strings.NewReplacer("asg_max_size: 1", `asg_max_size: 1
+      launch_template:
+        bootstrap_args: --kubelet-extra-args '--max-pods=20'
+        metadata_http_tokens: required
+        ebs_encrypted: true
+        ebs_kms_key_id: arn:aws:kms:eu-central-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab
+        security_group_ids: [sg-0a1b2c3d]`),
+		},
+		{
+			name:     "kms key without encryption",
+			replacer: strings.NewReplacer("asg_max_size: 1", "asg_max_size: 1\n      launch_template: {ebs_kms_key_id: 'arn:aws:kms:eu-central-1:123456789012:key/1'}"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].launch_template.ebs_kms_key_id",
+				Message: "requires ebs_encrypted to be true",
+			}},
+		},
+		{
+			name:     "unknown metadata http tokens",
+			replacer: strings.NewReplacer("asg_max_size: 1", "asg_max_size: 1\n      launch_template: {metadata_http_tokens: v2}"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].launch_template.metadata_http_tokens",
+				Message: `value must be one of "optional", "required", null`,
+			}},
+		},
+		{
+			name:     "desired capacity above max size",
+			replacer: strings.NewReplacer("asg_desired_capacity: 1", "asg_desired_capacity: 2"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].asg_desired_capacity",
+				Message: "must be between asg_min_size and asg_max_size (2 not in 1..1)",
+			}},
+		},
+		{
+			name:     "desired capacity below min size",
+			replacer: strings.NewReplacer("asg_desired_capacity: 1", "asg_desired_capacity: 0"),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].asg_desired_capacity",
+				Message: "must be between asg_min_size and asg_max_size (0 not in 1..1)",
+			}},
+		},
+		{
+			name:     "ssh access with key name",
+			replacer: strings.NewReplacer("enabled: false\n    key_name: null", "enabled: true\n    key_name: nodes", "source_security_group_ids: null", "source_security_group_ids: [sg-0a1b]"),
+		},
+		{
+			name:     "ssh access with public key file",
+			replacer: strings.NewReplacer("ssh_access:\n    enabled: false", "ssh_access:\n    enabled: true", "public_key_path: null", "public_key_path: vms_rsa.pub"),
+		},
+		{
+			name:     "ssh access without key",
+			replacer: strings.NewReplacer("ssh_access:\n    enabled: false", "ssh_access:\n    enabled: true"),
+			want: ValidationErrors{{
+				Field:   "awsks.ssh_access.key_name",
+				Message: "is required when ssh access is enabled and public_key_path is not set",
+			}},
+		},
+		{
+			name:     "ssh access with key name and public key file",
+			replacer: strings.NewReplacer("enabled: false\n    key_name: null\n    public_key_path: null", "enabled: true\n    key_name: nodes\n    public_key_path: vms_rsa.pub"),
+			want:     ValidationErrors{{Field: "awsks.ssh_access.public_key_path", Message: "cannot be set together with key_name"}},
+		},
+		{
+			name:     "source security groups without ssh access",
+			replacer: strings.NewReplacer("source_security_group_ids: null", "source_security_group_ids: [sg-0a1b]"),
+			want:     ValidationErrors{{Field: "awsks.ssh_access.source_security_group_ids", Message: "requires enabled to be true"}},
+		},
+		{
+			name: "source security groups with launch template",
+			replacer: strings.NewReplacer(
+				"enabled: false\n    key_name: null", "enabled: true\n    key_name: nodes",
+				"source_security_group_ids: null", "source_security_group_ids: [sg-0a1b]",
+				"asg_max_size: 1", "asg_max_size: 1\n      launch_template: {metadata_http_tokens: required}",
+			),
+			want: ValidationErrors{{
+				Field:   "awsks.worker_groups[0].launch_template",
+				Message: "cannot be used together with ssh_access.source_security_group_ids",
+			}},
+		},
+		{
+			name:     "encryption with created key",
+			replacer: strings.NewReplacer("encryption:\n    enabled: false", "encryption:\n    enabled: true"),
+		},
+		{
+			name:     "encryption with existing key",
+			replacer: strings.NewReplacer("encryption:\n    enabled: false\n    kms_key_arn: null", "encryption:\n    enabled: true\n    kms_key_arn: arn:aws:kms:eu-central-1:123456789012:key/1"),
+		},
+		{
+			name:     "kms key arn without encryption",
+			replacer: strings.NewReplacer("kms_key_arn: null", "kms_key_arn: arn:aws:kms:eu-central-1:123456789012:key/1"),
+			want:     ValidationErrors{{Field: "awsks.encryption.kms_key_arn", Message: "requires enabled to be true"}},
+		},
+		{
+			name:     "kms key id instead of arn",
+			replacer: strings.NewReplacer("encryption:\n    enabled: false\n    kms_key_arn: null", "encryption:\n    enabled: true\n    kms_key_arn: 1234abcd-12ab-34cd-56ef-1234567890ab"),
+			want:     ValidationErrors{{Field: "awsks.encryption.kms_key_arn", Message: "does not match pattern '^arn:aws[a-z-]*:kms:'"}},
+		},
+		{
+			name: "all log types with week retention and kms key",
+			replacer: strings.NewReplacer(
+				"  log_types:\n    - api\n    - audit", "  log_types: [api, audit, authenticator, controllerManager, scheduler]",
+				"log_retention_days: 30", "log_retention_days: 7",
+				"log_kms_key_id: null", "log_kms_key_id: arn:aws:kms:eu-central-1:123456789012:key/1",
+			),
+		},
+		{
+			name:     "logging disabled",
+			replacer: strings.NewReplacer("  log_types:\n    - api\n    - audit", "  log_types: []"),
+		},
+		{
+			name:     "unknown log type",
+			replacer: strings.NewReplacer("    - audit\n", "    - Audit\n"),
+			want: ValidationErrors{{
+				Field:   "awsks.log_types[1]",
+				Message: `value must be one of "api", "audit", "authenticator", "controllerManager", "scheduler"`,
+			}},
+		},
+		{
+			name:     "unsupported log retention",
+			replacer: strings.NewReplacer("log_retention_days: 30", "log_retention_days: 10"),
+			want: ValidationErrors{{
+				Field:   "awsks.log_retention_days",
+				Message: `value must be one of "0", "1", "3", "5", "7", "14", "30", "60", "90", "120", "150", "180", "365", "400", "545", "731", "1827", "3653"`,
+			}},
+		},
+		{
+			name:     "required tag keys",
+			replacer: strings.NewReplacer("tags: {}", "tags: {owner: data, cost-center: '42'}", "required_tag_keys: []", "required_tag_keys: [owner, cost-center]"),
+		},
+		{
+			name:     "missing required tag key",
+			replacer: strings.NewReplacer("tags: {}", "tags: {owner: data}", "required_tag_keys: []", "required_tag_keys: [owner, cost-center]"),
+			want:     ValidationErrors{{Field: "awsks.tags", Message: `missing required tag key "cost-center"`}},
+		},
+		{
+			name: "addons",
+			replacer: strings.NewReplacer("addons: []", `addons:
+    - {name: vpc-cni, version: null, resolve_conflicts: OVERWRITE}
+    - {name: kube-proxy, version: v1.18.8-eksbuild.1, resolve_conflicts: NONE}`),
+		},
+		{
+			name:     "unknown addon",
+			replacer: strings.NewReplacer("addons: []", "addons: [{name: aws-ebs-csi-driver, version: null, resolve_conflicts: NONE}]"),
+			want:     ValidationErrors{{Field: "awsks.addons[0].name", Message: `value must be one of "vpc-cni", "coredns", "kube-proxy"`}},
+		},
+		{
+			name:     "duplicate addon",
+			replacer: strings.NewReplacer("addons: []", "addons: [{name: coredns, version: null, resolve_conflicts: NONE}, {name: coredns, version: v1.8.0-eksbuild.1, resolve_conflicts: NONE}]"),
+			want:     ValidationErrors{{Field: "awsks.addons[1].name", Message: "duplicates name of awsks.addons[0]"}},
+		},
+		{
+			name: "addons in k8s version without managed addons",
+			replacer: strings.NewReplacer(
+				`k8s_version: "1.18"`, `k8s_version: "1.17"`,
+				"addons: []", "addons: [{name: coredns, version: null, resolve_conflicts: NONE}]",
+			),
+			want: ValidationErrors{{Field: "awsks.addons", Message: "EKS manages add-ons only in k8s_version 1.18 and later"}},
+		},
+		{
+			name:     "kube-proxy version does not match k8s version",
+			replacer: strings.NewReplacer("addons: []", "addons: [{name: kube-proxy, version: v1.19.6-eksbuild.2, resolve_conflicts: OVERWRITE}]"),
+			want: ValidationErrors{{
+				Field:   "awsks.addons[0].version",
+				Message: "v1.19.6-eksbuild.2 does not match k8s_version 1.18, kube-proxy major and minor version must match the cluster",
+			}},
+		},
+		{
+			name:     "Fargate profile",
+			replacer: strings.NewReplacer("fargate_profiles: []", "fargate_profiles: [{name: system, selectors: [{namespace: kube-system, labels: null}], subnet_ids: null}]"),
+		},
+		{
+			name: "Fargate only cluster",
+			replacer: strings.NewReplacer(
+				"fargate_profiles: []", "fargate_profiles: [{name: all, selectors: [{namespace: kube-system, labels: null}, {namespace: default, labels: {app: web}}], subnet_ids: null}]",
+				validWorkerGroups, "worker_groups: []\n",
+			),
+		},
+		{
+			name:     "Fargate profile without selectors",
+			replacer: strings.NewReplacer("fargate_profiles: []", "fargate_profiles: [{name: system, selectors: [], subnet_ids: null}]"),
+			want:     ValidationErrors{{Field: "awsks.fargate_profiles[0].selectors", Message: "minimum 1 items required, but found 0 items"}},
+		},
+		{
+			name: "duplicate Fargate profile",
+			replacer: strings.NewReplacer(
+				"fargate_profiles: []",
+				"fargate_profiles: [{name: system, selectors: [{namespace: kube-system, labels: null}], subnet_ids: null}, {name: system, selectors: [{namespace: default, labels: null}], subnet_ids: null}]",
+			),
+			want: ValidationErrors{{Field: "awsks.fargate_profiles[1].name", Message: "duplicates name of awsks.fargate_profiles[0]"}},
+		},
+		{
+			name: "Fargate profile in public subnets",
+			replacer: strings.NewReplacer(
+				"role: private", "role: public",
+				"public_route_table_id: null", "public_route_table_id: rtb-0a1b2c3d",
+				"fargate_profiles: []", "fargate_profiles: [{name: system, selectors: [{namespace: kube-system, labels: null}], subnet_ids: null}]",
+			),
+			want: ValidationErrors{{
+				Field:   "awsks.fargate_profiles[0].subnet_ids",
+				Message: "is required when subnets.role is public, Fargate runs pods only in private subnets",
+			}},
+		},
+		{
+			name: "Fargate profile in private subnets of public cluster",
+			replacer: strings.NewReplacer(
+				"role: private", "role: public",
+				"public_route_table_id: null", "public_route_table_id: rtb-0a1b2c3d",
+				"fargate_profiles: []", "fargate_profiles: [{name: system, selectors: [{namespace: kube-system, labels: null}], subnet_ids: [subnet-0a1b2c3d, subnet-0e1f2a3b]}]",
+			),
+		},
+		{
+			name:     "no worker groups and Fargate profiles",
+			replacer: strings.NewReplacer(validWorkerGroups, "worker_groups: []\n"),
+			want:     ValidationErrors{{Field: "awsks.worker_groups", Message: "cannot be empty when fargate_profiles is empty, pods would have nowhere to run"}},
+		},
+		{
+			name:     "tag value is not a string",
+			replacer: strings.NewReplacer("tags: {}", "tags: {cost-center: 42}"),
+			want:     ValidationErrors{{Field: "awsks.tags.cost-center", Message: "expected string, but got number"}},
+		},
+		{
+			name:     "threshold out of range",
+			replacer: strings.NewReplacer("threshold: 0.65", "threshold: 1.5"),
+			want:     ValidationErrors{{Field: "awsks.autoscaler_scale_down_utilization_threshold", Message: "must be <= 1 but found 1.5"}},
+		},
+		{
+			name:     "unknown ami type",
+			replacer: strings.NewReplacer("ami_type: AL2_x86_64", "ami_type: UBUNTU"),
+			want:     ValidationErrors{{Field: "awsks.ami_type", Message: `value must be one of "AL2_x86_64", "AL2_x86_64_GPU", "AL2_ARM_64"`}},
+		},
+		{
+			name:     "unsupported k8s version",
+			replacer: strings.NewReplacer(`k8s_version: "1.18"`, `k8s_version: "1.12"`),
+			want:     ValidationErrors{{Field: "awsks.k8s_version", Message: `unsupported version "1.12", supported versions are 1.16, 1.17, 1.18, 1.19`}},
+		},
+		{
+			name:     "k8s version is not a string",
+			replacer: strings.NewReplacer(`k8s_version: "1.18"`, `k8s_version: 1.18`),
+			want:     ValidationErrors{{Field: "awsks.k8s_version", Message: "expected string, but got number"}},
+		},
+		{
+			name:     "autoscaler version set",
+			replacer: strings.NewReplacer("autoscaler_version: null", "autoscaler_version: v1.18.1"),
+		},
+		{
+			name:     "autoscaler version does not match k8s version",
+			replacer: strings.NewReplacer("autoscaler_version: null", "autoscaler_version: v1.17.4"),
+			want: ValidationErrors{{
+				Field:   "awsks.autoscaler_version",
+				Message: "v1.17.4 does not match k8s_version 1.18, autoscaler major and minor version must match the cluster",
+			}},
+		},
+		{
+			name:     "unknown field",
+			replacer: strings.NewReplacer("disk_size: 32", "disk_size: 32\n  disk_type: gp2"),
+			want:     ValidationErrors{{Field: "awsks", Message: "additionalProperties 'disk_type' not allowed"}},
+		},
+		{
+			name: "several errors",
+			replacer: strings.NewReplacer(
+				"region: eu-central-1", "region: Frankfurt",
+				"asg_max_size: 1", "asg_max_size: 1\n    - name: default_wg\n      instance_type: t3.medium\n      asg_desired_capacity: 1\n      asg_min_size: 2\n      asg_max_size: 1",
+			),
+			want: ValidationErrors{
+				{Field: "awsks.region", Message: "does not match pattern '^[a-z]{2}(-gov)?-[a-z]+-[0-9]$'"},
+				{Field: "awsks.worker_groups[1].asg_min_size", Message: "must not be greater than asg_max_size (2 > 1)"},
+				{Field: "awsks.worker_groups[1].name", Message: "duplicates name of awsks.worker_groups[0]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.replacer.Replace(validConfig)))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Parse() failed with: %v", err)
+				}
+				return
+			}
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("expected ValidationErrors, got: %v", err)
+			}
+			if diff := deep.Equal(errs, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPublishedSchema(t *testing.T) {
+	published, err := ioutil.ReadFile("../../docs/awsks-config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(published) != Schema {
+		t.Error("docs/awsks-config.schema.json differs from config.Schema, update the published copy")
+	}
+}
+
+func TestAutoscalerVersionsMatchTerraform(t *testing.T) {
+	locals, err := ioutil.ReadFile("../../resources/terraform/locals.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := regexp.MustCompile(`(?s)autoscaler_default_versions\s+= \{.*?\n  \}`).Find(locals)
+	terraform := make(map[string]string)
+	for _, m := range regexp.MustCompile(`(?m)^\s*([0-9]+\.[0-9]+):\s*"(v[^"]+)"`).FindAllStringSubmatch(string(block), -1) {
+		terraform[m[1]] = m[2]
+	}
+	if diff := deep.Equal(AutoscalerVersions, terraform); diff != nil {
+		t.Errorf("AutoscalerVersions differ from autoscaler_default_versions in locals.tf: %v", diff)
+	}
+}
+
+func TestAddonVersionsMatchTerraform(t *testing.T) {
+	locals, err := ioutil.ReadFile("../../resources/terraform/locals.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := regexp.MustCompile(`(?s)addon_default_versions\s+= \{.*?\n  \}`).Find(locals)
+	terraform := make(map[string]map[string]string)
+	for _, m := range regexp.MustCompile(`(?s)([0-9]+\.[0-9]+):\s*\{(.*?)\}`).FindAllSubmatch(block, -1) {
+		versions := make(map[string]string)
+		for _, v := range regexp.MustCompile(`"([a-z-]+)":\s*"(v[^"]+)"`).FindAllSubmatch(m[2], -1) {
+			versions[string(v[1])] = string(v[2])
+		}
+		terraform[string(m[1])] = versions
+	}
+	if diff := deep.Equal(AddonVersions, terraform); diff != nil {
+		t.Errorf("AddonVersions differ from addon_default_versions in locals.tf: %v", diff)
+	}
+}
+
+// TestObjectsMatchTerraform checks that tfvars encoding of worker group, its
+// launch template, subnets, SSH access, encryption and add-ons has exactly
+// the attributes of object variables in root and child modules, as terraform
+// rejects both missing and unknown attributes.
+func TestObjectsMatchTerraform(t *testing.T) {
+	const (
+		root         = "../../resources/terraform/variables.tf"
+		controlPlane = "../../resources/terraform/modules/control_plane/variables.tf"
+		nodes        = "../../resources/terraform/modules/nodes/variables.tf"
+		addons       = "../../resources/terraform/modules/addons/variables.tf"
+		fargate      = "../../resources/terraform/modules/fargate/variables.tf"
+	)
+	tests := []struct {
+		value     interface{}
+		paths     []string
+		block     *regexp.Regexp
+		attribute *regexp.Regexp
+	}{
+		{
+			value:     WorkerGroup{},
+			paths:     []string{root, nodes},
+			block:     regexp.MustCompile(`(?s)variable "worker_groups" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+		{
+			value:     LaunchTemplate{},
+			paths:     []string{root, nodes},
+			block:     regexp.MustCompile(`(?s)launch_template\s+= object\(\{.*?\}\)`),
+			attribute: regexp.MustCompile(`(?m)^      ([a-z_]+)\s+=`),
+		},
+		{
+			value:     Encryption{},
+			paths:     []string{root, controlPlane},
+			block:     regexp.MustCompile(`(?s)variable "encryption" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+		{
+			value:     Subnets{},
+			paths:     []string{root},
+			block:     regexp.MustCompile(`(?s)variable "subnets" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+		{
+			value:     Addon{},
+			paths:     []string{root, addons},
+			block:     regexp.MustCompile(`(?s)variable "addons" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+		{
+			value:     FargateProfile{},
+			paths:     []string{root, fargate},
+			block:     regexp.MustCompile(`(?s)variable "fargate_profiles" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+		{
+			value:     FargateSelector{},
+			paths:     []string{root, fargate},
+			block:     regexp.MustCompile(`(?s)selectors\s+= list\(object\(\{.*?\}\)\)`),
+			attribute: regexp.MustCompile(`(?m)^      ([a-z_]+)\s+=`),
+		},
+		{
+			value:     SSHAccess{},
+			paths:     []string{root},
+			block:     regexp.MustCompile(`(?s)variable "ssh_access" \{.*?\n\}`),
+			attribute: regexp.MustCompile(`(?m)^    ([a-z_]+)\s+=`),
+		},
+	}
+	for _, tt := range tests {
+		for _, path := range tt.paths {
+			variables, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := jsonKeys(t, tt.value)
+			var got []string
+			for _, m := range tt.attribute.FindAllSubmatch(tt.block.Find(variables), -1) {
+				got = append(got, string(m[1]))
+			}
+			sort.Strings(got)
+			if diff := deep.Equal(got, want); diff != nil {
+				t.Errorf("attributes in %s differ from %T: %v", path, tt.value, diff)
+			}
+		}
+	}
+}
+
+func TestScalingConfigMatchesTerraform(t *testing.T) {
+	main, err := ioutil.ReadFile("../../resources/terraform/modules/nodes/main.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := regexp.MustCompile(`(?s)scaling_config \{.*?\}`).Find(main)
+	got := make(map[string]string)
+	for _, m := range regexp.MustCompile(`(?m)^\s*([a-z_]+)\s*=\s*var\.worker_groups\[count\.index\]\.([a-z_]+)`).FindAllSubmatch(block, -1) {
+		got[string(m[1])] = string(m[2])
+	}
+	want := map[string]string{
+		"desired_size": "asg_desired_capacity",
+		"min_size":     "asg_min_size",
+		"max_size":     "asg_max_size",
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("scaling_config of node groups maps wrong worker group attributes: %v", diff)
+	}
+}
+
+// jsonKeys returns sorted keys of JSON encoding of value.
+func jsonKeys(t *testing.T, value interface{}) []string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded map[string]interface{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(encoded))
+	for key := range encoded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.18", b: "1.18", want: 0},
+		{a: "1.9", b: "1.18", want: -1},
+		{a: "v1.19.1", b: "1.19", want: 1},
+	}
+	for _, tt := range tests {
+		got := CompareVersions(tt.a, tt.b)
+		if (got < 0 && tt.want >= 0) || (got > 0 && tt.want <= 0) || (got == 0 && tt.want != 0) {
+			t.Errorf("CompareVersions(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSubnetsCIDRBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		subnets Subnets
+		vpcCIDR string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "default layout",
+			subnets: Subnets{Count: 2, Newbits: 4},
+			vpcCIDR: "10.1.0.0/16",
+			want:    []string{"10.1.240.0/20", "10.1.224.0/20"},
+		},
+		{
+			name:    "netnums",
+			subnets: Subnets{Count: 3, Newbits: 8, Netnums: []int{0, 1, 255}},
+			vpcCIDR: "172.16.0.0/16",
+			want:    []string{"172.16.0.0/24", "172.16.1.0/24", "172.16.255.0/24"},
+		},
+		{
+			name:    "explicit cidrs",
+			subnets: Subnets{Count: 2, CIDRs: []string{"10.0.0.0/24", "10.0.1.0/24"}},
+			vpcCIDR: "10.0.0.0/16",
+			want:    []string{"10.0.0.0/24", "10.0.1.0/24"},
+		},
+		{
+			name:    "prefix too long",
+			subnets: Subnets{Count: 2, Newbits: 8},
+			vpcCIDR: "10.0.0.0/28",
+			wantErr: "cannot extend prefix of 10.0.0.0/28 by 8 bits",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := tt.subnets.CIDRBlocks(tt.vpcCIDR)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CIDRBlocks() failed with: %v", err)
+			}
+			var got []string
+			for _, b := range blocks {
+				got = append(got, b.String())
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
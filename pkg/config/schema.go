@@ -0,0 +1,510 @@
+package config
+
+// SchemaURL identifies the configuration schema. A copy of Schema is
+// published in docs/awsks-config.schema.json.
+const SchemaURL = "https://github.com/epiphany-platform/m-aws-kubernetes-service/docs/awsks-config.schema.json"
+
+// Schema is the JSON Schema of awsks-config.yml.
+const Schema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/epiphany-platform/m-aws-kubernetes-service/docs/awsks-config.schema.json",
+  "title": "AWS Kubernetes Service module configuration",
+  "type": "object",
+  "required": ["kind", "awsks"],
+  "additionalProperties": false,
+  "properties": {
+    "kind": {
+      "const": "awsks-config"
+    },
+    "awsks": {
+      "type": "object",
+      "required": [
+        "name",
+        "vpc_id",
+        "region",
+        "subnet_ids",
+        "private_route_table_id",
+        "disk_size",
+        "autoscaler_scale_down_utilization_threshold",
+        "ami_type",
+        "worker_groups"
+      ],
+      "additionalProperties": false,
+      "properties": {
+        "name": {
+          "description": "Prefix for resource names, used as EKS cluster name",
+          "type": "string",
+          "pattern": "^[0-9A-Za-z][A-Za-z0-9_-]*$",
+          "maxLength": 100
+        },
+        "vpc_id": {
+          "description": "The id of virtual private cloud",
+          "type": "string",
+          "pattern": "^vpc-[0-9a-f]+$"
+        },
+        "region": {
+          "description": "AWS region where to deploy EKS cluster in",
+          "type": "string",
+          "pattern": "^[a-z]{2}(-gov)?-[a-z]+-[0-9]$"
+        },
+        "k8s_version": {
+          "description": "Kubernetes version of the EKS cluster, e.g. \"1.18\"",
+          "default": "1.18",
+          "type": "string",
+          "pattern": "^[0-9]+\\.[0-9]+$"
+        },
+        "autoscaler_version": {
+          "description": "Cluster autoscaler image tag, null to use the default tag for k8s_version",
+          "default": null,
+          "type": ["string", "null"],
+          "pattern": "^v[0-9]+\\.[0-9]+\\.[0-9]+$"
+        },
+        "subnet_ids": {
+          "description": "Existing subnets to deploy EKS cluster in, null to create subnets in the VPC",
+          "type": ["array", "null"],
+          "minItems": 2,
+          "uniqueItems": true,
+          "items": {
+            "type": "string",
+            "pattern": "^subnet-[0-9a-f]+$"
+          }
+        },
+        "private_route_table_id": {
+          "description": "The id of private route table associated with created subnets",
+          "type": "string"
+        },
+        "public_route_table_id": {
+          "description": "The id of route table to an internet gateway associated with created subnets when subnets.role is public",
+          "default": null,
+          "type": ["string", "null"],
+          "pattern": "^rtb-[0-9a-f]+$"
+        },
+        "subnets": {
+          "description": "Layout of subnets created in the VPC, used when subnet_ids is null",
+          "default": {"count": 2, "availability_zones": null, "newbits": 4, "netnums": null, "cidrs": null, "role": "private"},
+          "type": "object",
+          "required": ["count", "newbits", "role"],
+          "additionalProperties": false,
+          "properties": {
+            "count": {
+              "description": "Number of subnets, at least 2 as EKS requires subnets in 2 availability zones",
+              "type": "integer",
+              "minimum": 2
+            },
+            "availability_zones": {
+              "description": "Availability zones used round-robin, null for all available zones of the region",
+              "type": ["array", "null"],
+              "minItems": 2,
+              "uniqueItems": true,
+              "items": {
+                "type": "string",
+                "pattern": "^[a-z]{2}(-gov)?-[a-z]+-[0-9][a-z]$"
+              }
+            },
+            "newbits": {
+              "description": "Bits added to the VPC prefix length to get subnet prefix length",
+              "type": "integer",
+              "minimum": 1,
+              "maximum": 12
+            },
+            "netnums": {
+              "description": "Network numbers of subnets within the VPC CIDR block, null for the last count networks",
+              "type": ["array", "null"],
+              "uniqueItems": true,
+              "items": {
+                "type": "integer",
+                "minimum": 0
+              }
+            },
+            "cidrs": {
+              "description": "Explicit CIDR blocks of subnets, used instead of newbits and netnums",
+              "type": ["array", "null"],
+              "uniqueItems": true,
+              "items": {
+                "type": "string"
+              }
+            },
+            "role": {
+              "description": "Subnets role tag, \"private\" for internal load balancers, \"public\" for internet-facing ones routed through public_route_table_id",
+              "enum": ["private", "public"]
+            }
+          }
+        },
+        "endpoint_private_access": {
+          "description": "Enable private API endpoint reachable from inside the VPC",
+          "default": false,
+          "type": "boolean"
+        },
+        "endpoint_public_access": {
+          "description": "Enable public API endpoint",
+          "default": true,
+          "type": "boolean"
+        },
+        "public_access_cidrs": {
+          "description": "IPv4 CIDR blocks allowed to reach public API endpoint, null for 0.0.0.0/0",
+          "default": null,
+          "type": ["array", "null"],
+          "minItems": 1,
+          "uniqueItems": true,
+          "items": {
+            "type": "string"
+          }
+        },
+        "disk_size": {
+          "description": "Disk size of worker nodes in GiB",
+          "type": "integer",
+          "minimum": 1
+        },
+        "autoscaler_scale_down_utilization_threshold": {
+          "description": "Node utilization level below which node can be considered for scale down",
+          "type": "number",
+          "minimum": 0,
+          "maximum": 1
+        },
+        "ami_type": {
+          "description": "Type of Amazon Machine Image associated with the EKS node groups",
+          "enum": ["AL2_x86_64", "AL2_x86_64_GPU", "AL2_ARM_64"]
+        },
+        "ec2_ssh_key": {
+          "description": "Deprecated, replaced by ssh_access. EC2 key pair name enabling SSH access to the worker nodes",
+          "deprecated": true,
+          "type": ["string", "null"],
+          "minLength": 1
+        },
+        "ssh_access": {
+          "description": "SSH access to the worker nodes",
+          "default": {"enabled": false, "key_name": null, "public_key_path": null, "source_security_group_ids": null},
+          "type": "object",
+          "required": ["enabled"],
+          "additionalProperties": false,
+          "properties": {
+            "enabled": {
+              "type": "boolean"
+            },
+            "key_name": {
+              "description": "Existing EC2 key pair name, required unless public_key_path is set",
+              "type": ["string", "null"],
+              "minLength": 1
+            },
+            "public_key_path": {
+              "description": "Public key file imported as EC2 key pair, relative to the shared directory when not absolute",
+              "type": ["string", "null"],
+              "minLength": 1
+            },
+            "source_security_group_ids": {
+              "description": "Security groups allowed to connect to nodes, null to allow connections from anywhere",
+              "type": ["array", "null"],
+              "minItems": 1,
+              "uniqueItems": true,
+              "items": {
+                "type": "string",
+                "pattern": "^sg-[0-9a-f]+$"
+              }
+            }
+          }
+        },
+        "encryption": {
+          "description": "Envelope encryption of Kubernetes secrets with KMS",
+          "default": {"enabled": false, "kms_key_arn": null},
+          "type": "object",
+          "required": ["enabled"],
+          "additionalProperties": false,
+          "properties": {
+            "enabled": {
+              "type": "boolean"
+            },
+            "kms_key_arn": {
+              "description": "ARN of existing KMS key, null to create a key",
+              "type": ["string", "null"],
+              "pattern": "^arn:aws[a-z-]*:kms:"
+            }
+          }
+        },
+        "log_types": {
+          "description": "Control plane log types sent to CloudWatch, empty to disable logging",
+          "default": ["api", "audit"],
+          "type": "array",
+          "uniqueItems": true,
+          "items": {
+            "enum": ["api", "audit", "authenticator", "controllerManager", "scheduler"]
+          }
+        },
+        "log_retention_days": {
+          "description": "Retention of control plane log group in days, 0 to keep logs forever",
+          "default": 30,
+          "enum": [0, 1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, 3653]
+        },
+        "log_kms_key_id": {
+          "description": "ARN of KMS key encrypting control plane log group, null for CloudWatch default encryption",
+          "default": null,
+          "type": ["string", "null"],
+          "pattern": "^arn:aws[a-z-]*:kms:"
+        },
+        "tags": {
+          "description": "AWS tags added to every taggable resource",
+          "default": {},
+          "type": "object",
+          "propertyNames": {
+            "minLength": 1,
+            "maxLength": 128
+          },
+          "additionalProperties": {
+            "type": "string",
+            "maxLength": 256
+          }
+        },
+        "required_tag_keys": {
+          "description": "Tag keys every taggable resource of the plan has to have",
+          "default": [],
+          "type": "array",
+          "uniqueItems": true,
+          "items": {
+            "type": "string",
+            "minLength": 1,
+            "maxLength": 128
+          }
+        },
+        "addons": {
+          "description": "EKS managed add-ons installed on the cluster",
+          "default": [],
+          "type": "array",
+          "items": {
+            "type": "object",
+            "additionalProperties": false,
+            "required": ["name", "version", "resolve_conflicts"],
+            "properties": {
+              "name": {
+                "enum": ["vpc-cni", "coredns", "kube-proxy"]
+              },
+              "version": {
+                "description": "Add-on version, null for the default version of k8s_version",
+                "type": ["string", "null"],
+                "pattern": "^v[0-9]+\\.[0-9]+\\.[0-9]+-eksbuild\\.[0-9]+$"
+              },
+              "resolve_conflicts": {
+                "description": "How conflicts with existing add-on configuration are resolved",
+                "enum": ["NONE", "OVERWRITE"]
+              }
+            }
+          }
+        },
+        "fargate_profiles": {
+          "description": "Fargate profiles running selected pods without nodes",
+          "default": [],
+          "type": "array",
+          "items": {
+            "type": "object",
+            "additionalProperties": false,
+            "required": ["name", "selectors"],
+            "properties": {
+              "name": {
+                "type": "string",
+                "pattern": "^[0-9A-Za-z][A-Za-z0-9_-]*$",
+                "maxLength": 100
+              },
+              "selectors": {
+                "description": "Pods matching any selector run on Fargate",
+                "type": "array",
+                "minItems": 1,
+                "maxItems": 5,
+                "items": {
+                  "type": "object",
+                  "additionalProperties": false,
+                  "required": ["namespace"],
+                  "properties": {
+                    "namespace": {
+                      "type": "string",
+                      "minLength": 1
+                    },
+                    "labels": {
+                      "description": "Labels pods have to have, null to select the whole namespace",
+                      "type": ["object", "null"],
+                      "maxProperties": 5,
+                      "additionalProperties": {
+                        "type": "string"
+                      }
+                    }
+                  }
+                }
+              },
+              "subnet_ids": {
+                "description": "Private subnets of pods, null for subnets of the cluster",
+                "type": ["array", "null"],
+                "minItems": 1,
+                "items": {
+                  "type": "string",
+                  "pattern": "^subnet-[0-9a-f]+$"
+                }
+              }
+            }
+          }
+        },
+        "worker_groups": {
+          "description": "Worker groups definition list, empty when all pods run on Fargate",
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["name", "asg_desired_capacity", "asg_min_size", "asg_max_size"],
+            "additionalProperties": false,
+            "properties": {
+              "name": {
+                "type": "string",
+                "pattern": "^[0-9A-Za-z][A-Za-z0-9_-]*$"
+              },
+              "instance_type": {
+                "description": "EC2 instance type of nodes, required when instance_types is not set",
+                "type": "string",
+                "pattern": "^[a-z][a-z0-9-]*\\.[a-z0-9]+$"
+              },
+              "instance_types": {
+                "description": "EC2 instance types of nodes, used instead of instance_type to diversify capacity",
+                "type": ["array", "null"],
+                "minItems": 1,
+                "uniqueItems": true,
+                "items": {
+                  "type": "string",
+                  "pattern": "^[a-z][a-z0-9-]*\\.[a-z0-9]+$"
+                }
+              },
+              "capacity_type": {
+                "description": "Capacity type of nodes, null for ON_DEMAND",
+                "enum": ["ON_DEMAND", "SPOT", null]
+              },
+              "allow_single_spot_instance_type": {
+                "description": "Allow SPOT capacity with a single instance type",
+                "type": "boolean"
+              },
+              "asg_desired_capacity": {
+                "type": "integer",
+                "minimum": 0
+              },
+              "asg_min_size": {
+                "type": "integer",
+                "minimum": 0
+              },
+              "asg_max_size": {
+                "type": "integer",
+                "minimum": 1
+              },
+              "disk_size": {
+                "description": "Disk size of nodes in GiB, null to use awsks.disk_size",
+                "type": ["integer", "null"],
+                "minimum": 1
+              },
+              "ami_type": {
+                "description": "Type of Amazon Machine Image of nodes, null to use awsks.ami_type",
+                "enum": ["AL2_x86_64", "AL2_x86_64_GPU", "AL2_ARM_64", null]
+              },
+              "labels": {
+                "description": "Kubernetes labels of nodes",
+                "type": ["object", "null"],
+                "additionalProperties": {
+                  "type": "string",
+                  "maxLength": 63
+                }
+              },
+              "taints": {
+                "description": "Kubernetes taints of nodes",
+                "type": ["array", "null"],
+                "maxItems": 50,
+                "items": {
+                  "type": "object",
+                  "required": ["key", "effect"],
+                  "additionalProperties": false,
+                  "properties": {
+                    "key": {
+                      "type": "string",
+                      "minLength": 1,
+                      "maxLength": 63
+                    },
+                    "value": {
+                      "type": "string",
+                      "maxLength": 63
+                    },
+                    "effect": {
+                      "enum": ["NO_SCHEDULE", "NO_EXECUTE", "PREFER_NO_SCHEDULE"]
+                    }
+                  }
+                }
+              },
+              "tags": {
+                "description": "AWS tags of the node group, added to tags set by the module",
+                "type": ["object", "null"],
+                "additionalProperties": {
+                  "type": "string",
+                  "maxLength": 256
+                }
+              },
+              "launch_template": {
+                "description": "EC2 launch template of nodes rendered by the module, null to use EKS defaults",
+                "type": ["object", "null"],
+                "additionalProperties": false,
+                "properties": {
+                  "user_data": {
+                    "description": "Shell script run on nodes before they join the cluster",
+                    "type": ["string", "null"]
+                  },
+                  "bootstrap_args": {
+                    "description": "Arguments of EKS bootstrap script, e.g. \"--kubelet-extra-args '--max-pods=20'\", setting them makes the module select EKS optimized AMI",
+                    "type": ["string", "null"]
+                  },
+                  "metadata_http_tokens": {
+                    "description": "Use \"required\" to enforce IMDSv2, null for \"optional\"",
+                    "enum": ["optional", "required", null]
+                  },
+                  "metadata_http_put_response_hop_limit": {
+                    "description": "Hop limit of instance metadata requests, null for 1",
+                    "type": ["integer", "null"],
+                    "minimum": 1,
+                    "maximum": 64
+                  },
+                  "ebs_encrypted": {
+                    "description": "Encrypt root volumes of nodes",
+                    "type": "boolean"
+                  },
+                  "ebs_kms_key_id": {
+                    "description": "ARN of KMS key encrypting root volumes, null for the default EBS key",
+                    "type": ["string", "null"],
+                    "pattern": "^arn:aws[a-z-]*:kms:"
+                  },
+                  "security_group_ids": {
+                    "description": "Security groups of nodes added to the cluster security group",
+                    "type": ["array", "null"],
+                    "uniqueItems": true,
+                    "items": {
+                      "type": "string",
+                      "pattern": "^sg-[0-9a-f]+$"
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "if": {
+        "properties": {
+          "subnet_ids": {
+            "type": "null"
+          },
+          "subnets": {
+            "properties": {
+              "role": {
+                "const": "private"
+              }
+            }
+          }
+        }
+      },
+      "then": {
+        "properties": {
+          "private_route_table_id": {
+            "description": "Route table is required when subnets are created by the module",
+            "pattern": "^rtb-[0-9a-f]+$"
+          }
+        }
+      }
+    }
+  }
+}
+`
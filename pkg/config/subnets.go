@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CIDRBlocks returns CIDR blocks of subnets created in VPC with primary CIDR
+// block vpcCIDR. They are computed the same way as in
+// resources/terraform/infra.tf, which has to be kept in sync.
+func (s Subnets) CIDRBlocks(vpcCIDR string) ([]*net.IPNet, error) {
+	if s.CIDRs != nil {
+		blocks := make([]*net.IPNet, 0, len(s.CIDRs))
+		for _, cidr := range s.CIDRs {
+			_, block, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		}
+		return blocks, nil
+	}
+
+	_, vpc, err := net.ParseCIDR(vpcCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR block: %w", err)
+	}
+	blocks := make([]*net.IPNet, 0, s.Count)
+	for i := 0; i < s.Count; i++ {
+		netnum := 1<<s.Newbits - 1 - i
+		if s.Netnums != nil {
+			netnum = s.Netnums[i]
+		}
+		block, err := cidrSubnet(vpc, s.Newbits, netnum)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// NetworksOverlap reports whether two CIDR blocks share any address.
+func NetworksOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// cidrSubnet is terraform cidrsubnet function for IPv4 prefixes.
+func cidrSubnet(base *net.IPNet, newbits, netnum int) (*net.IPNet, error) {
+	ip := base.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 CIDR block", base)
+	}
+	ones, bits := base.Mask.Size()
+	if ones+newbits > bits {
+		return nil, fmt.Errorf("cannot extend prefix of %s by %d bits", base, newbits)
+	}
+	if netnum < 0 || netnum >= 1<<newbits {
+		return nil, fmt.Errorf("netnum %d does not fit in %d bits", netnum, newbits)
+	}
+	addr := binary.BigEndian.Uint32(ip) | uint32(netnum)<<(bits-ones-newbits)
+	subnet := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(subnet, addr)
+	return &net.IPNet{IP: subnet, Mask: net.CIDRMask(ones+newbits, bits)}, nil
+}
+
+// validate checks subnet layout constraints, which are not covered by the
+// schema.
+func (s Subnets) validate(region string) ValidationErrors {
+	var errs ValidationErrors
+	for i, az := range s.AvailabilityZones {
+		if !strings.HasPrefix(az, region) || len(az) != len(region)+1 {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("awsks.subnets.availability_zones[%d]", i), Message: fmt.Sprintf("%q is not in region %s", az, region)})
+		}
+	}
+	switch {
+	case s.CIDRs != nil && s.Netnums != nil:
+		errs = append(errs, FieldError{Field: "awsks.subnets.cidrs", Message: "cannot be set together with netnums"})
+	case s.CIDRs != nil && len(s.CIDRs) != s.Count:
+		errs = append(errs, FieldError{Field: "awsks.subnets.cidrs", Message: fmt.Sprintf("must have count items (%d), got %d", s.Count, len(s.CIDRs))})
+	case s.Netnums != nil && len(s.Netnums) != s.Count:
+		errs = append(errs, FieldError{Field: "awsks.subnets.netnums", Message: fmt.Sprintf("must have count items (%d), got %d", s.Count, len(s.Netnums))})
+	case s.CIDRs == nil && s.Netnums == nil && s.Count > 1<<s.Newbits:
+		errs = append(errs, FieldError{Field: "awsks.subnets.count", Message: fmt.Sprintf("must not be greater than %d networks available with newbits %d", 1<<s.Newbits, s.Newbits)})
+	}
+	for i, netnum := range s.Netnums {
+		if netnum >= 1<<s.Newbits {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("awsks.subnets.netnums[%d]", i), Message: fmt.Sprintf("must be less than %d with newbits %d", 1<<s.Newbits, s.Newbits)})
+		}
+	}
+	blocks := make(map[int]*net.IPNet)
+	for i, cidr := range s.CIDRs {
+		field := fmt.Sprintf("awsks.subnets.cidrs[%d]", i)
+		ip, block, err := net.ParseCIDR(cidr)
+		switch {
+		case err != nil || ip.To4() == nil:
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("%q is not a valid IPv4 CIDR block", cidr)})
+			continue
+		case !ip.Equal(block.IP):
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("%q has host bits set, network address is %s", cidr, block)})
+		}
+		for j := 0; j < i; j++ {
+			if prev, ok := blocks[j]; ok && NetworksOverlap(prev, block) {
+				errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("overlaps awsks.subnets.cidrs[%d]", j)})
+			}
+		}
+		blocks[i] = block
+	}
+	return errs
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AutoscalerVersions maps supported Kubernetes versions to default cluster
+// autoscaler image tags. It has to be kept in sync with
+// autoscaler_default_versions in resources/terraform/locals.tf.
+var AutoscalerVersions = map[string]string{
+	"1.16": "v1.16.7",
+	"1.17": "v1.17.4",
+	"1.18": "v1.18.3",
+	"1.19": "v1.19.1",
+}
+
+// AddonVersions maps Kubernetes versions to default versions of EKS managed
+// add-ons. EKS manages add-ons only since 1.18, so older versions have no
+// entry. It has to be kept in sync with addon_default_versions in
+// resources/terraform/locals.tf.
+var AddonVersions = map[string]map[string]string{
+	"1.18": {
+		"vpc-cni":    "v1.9.1-eksbuild.1",
+		"coredns":    "v1.7.0-eksbuild.1",
+		"kube-proxy": "v1.18.8-eksbuild.1",
+	},
+	"1.19": {
+		"vpc-cni":    "v1.9.1-eksbuild.1",
+		"coredns":    "v1.8.0-eksbuild.1",
+		"kube-proxy": "v1.19.6-eksbuild.2",
+	},
+}
+
+// SupportedK8sVersions returns supported Kubernetes versions from the oldest.
+func SupportedK8sVersions() []string {
+	versions := make([]string, 0, len(AutoscalerVersions))
+	for v := range AutoscalerVersions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) < 0 })
+	return versions
+}
+
+// CheckK8sVersion returns error when Kubernetes version is not supported.
+func CheckK8sVersion(version string) error {
+	if _, ok := AutoscalerVersions[version]; !ok {
+		return fmt.Errorf("unsupported version %q, supported versions are %s", version, strings.Join(SupportedK8sVersions(), ", "))
+	}
+	return nil
+}
+
+// CheckAutoscalerVersion returns error when major and minor version of
+// cluster autoscaler image tag do not match Kubernetes version.
+func CheckAutoscalerVersion(autoscalerVersion, k8sVersion string) error {
+	if MinorVersion(autoscalerVersion) != k8sVersion {
+		return fmt.Errorf("%s does not match k8s_version %s, autoscaler major and minor version must match the cluster", autoscalerVersion, k8sVersion)
+	}
+	return nil
+}
+
+// validateAddonVersions checks that managed add-ons are available in
+// Kubernetes version and that pinned kube-proxy matches it.
+func validateAddonVersions(addons []Addon, k8sVersion string) ValidationErrors {
+	if len(addons) == 0 {
+		return nil
+	}
+	if _, ok := AddonVersions[k8sVersion]; !ok {
+		oldest := ""
+		for v := range AddonVersions {
+			if oldest == "" || CompareVersions(v, oldest) < 0 {
+				oldest = v
+			}
+		}
+		return ValidationErrors{{Field: "awsks.addons", Message: fmt.Sprintf("EKS manages add-ons only in k8s_version %s and later", oldest)}}
+	}
+	var errs ValidationErrors
+	for i, addon := range addons {
+		if addon.Name == AddonKubeProxy && addon.Version != nil && MinorVersion(*addon.Version) != k8sVersion {
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("awsks.addons[%d].version", i),
+				Message: fmt.Sprintf("%s does not match k8s_version %s, kube-proxy major and minor version must match the cluster", *addon.Version, k8sVersion),
+			})
+		}
+	}
+	return errs
+}
+
+// MinorVersion returns major and minor part of version, e.g. "1.18" for
+// "v1.18.3".
+func MinorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// CompareVersions compares dot separated numeric versions like "1.9" and
+// "1.18". Result is negative when a is older than b, zero when they are
+// equal and positive otherwise.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
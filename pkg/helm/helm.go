@@ -0,0 +1,39 @@
+// Package helm runs helm binary against a cluster described by kubeconfig
+// content, which is kept in state file rather than on disk.
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Run executes helm with args and returns its standard output. Kubeconfig is
+// written to a temporary file for the time of the call. Standard error of
+// failed command is included in returned error.
+func Run(kubeconfig string, args ...string) ([]byte, error) {
+	f, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(kubeconfig); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("helm", append(args, "--kubeconfig", f.Name())...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("helm %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,482 @@
+// Package preflight checks the target AWS account with read-only calls
+// before terraform runs, so problems which would otherwise surface deep into
+// terraform apply are reported up front.
+//
+// Every verified requirement is a Check. Failed requirements are reported in
+// Report, other AWS errors stop the preflight.
+package preflight
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+)
+
+const (
+	// clustersQuotaCode is the service quota of EKS clusters per region.
+	clustersQuotaCode = "L-1194D53C"
+	// defaultClustersQuota is used when the quota cannot be read.
+	defaultClustersQuota = 100
+	// minFreeIPAddresses is the number of free addresses EKS requires in
+	// every cluster subnet.
+	minFreeIPAddresses = 6
+	// reservedIPAddresses are addresses AWS reserves in every subnet.
+	reservedIPAddresses = 5
+)
+
+// Check is a single verified requirement.
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Report lists all checks in order they were made.
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Failed returns checks which did not pass.
+func (r *Report) Failed() []Check {
+	var result []Check
+	for _, c := range r.Checks {
+		if !c.Passed {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Err returns *FailedError when any check did not pass.
+func (r *Report) Err() error {
+	if failed := r.Failed(); len(failed) > 0 {
+		names := make([]string, 0, len(failed))
+		for _, c := range failed {
+			names = append(names, c.Name)
+		}
+		return &FailedError{Failed: names, Total: len(r.Checks)}
+	}
+	return nil
+}
+
+// WriteTable prints checks as a table.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+	for _, c := range r.Checks {
+		result := "pass"
+		if !c.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, result, c.Detail)
+	}
+	return tw.Flush()
+}
+
+// FailedError is returned when the account does not meet requirements of
+// the configuration.
+type FailedError struct {
+	Failed []string
+	Total  int
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("%d of %d preflight checks failed: %s", len(e.Failed), e.Total, strings.Join(e.Failed, ", "))
+}
+
+// Owned are resources in terraform state of the module. They are replaced or
+// kept by terraform, so they do not conflict with planned resources.
+type Owned struct {
+	SubnetIDs map[string]bool
+	KeyPairs  map[string]bool
+}
+
+// Checker checks the account of provided AWS clients.
+type Checker struct {
+	ec2    awsapi.EC2API
+	eks    awsapi.EKSAPI
+	quotas awsapi.ServiceQuotasAPI
+
+	report *Report
+}
+
+// New creates Checker using provided AWS clients.
+func New(clients awsapi.Clients) *Checker {
+	return &Checker{
+		ec2:    clients.EC2,
+		eks:    clients.EKS,
+		quotas: clients.ServiceQuotas,
+	}
+}
+
+// subnet is an existing or planned cluster subnet.
+type subnet struct {
+	name   string
+	zone   string
+	freeIP int64
+}
+
+// Run checks the account against configuration. Failed requirements are
+// reported in returned Report, error is returned only when checks could not
+// be completed.
+func (c *Checker) Run(cfg config.AWSKS, owned Owned) (*Report, error) {
+	c.report = &Report{}
+	vpc, err := c.checkVpc(cfg.VpcID)
+	if err != nil {
+		return nil, err
+	}
+	if vpc != nil {
+		var subnets []subnet
+		if cfg.SubnetIDs != nil {
+			subnets, err = c.checkExistingSubnets(cfg.VpcID, cfg.SubnetIDs)
+		} else {
+			subnets, err = c.checkSubnetLayout(cfg, vpc, owned.SubnetIDs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if subnets != nil {
+			c.checkZones(subnets)
+			if err := c.checkInstanceTypes(cfg.WorkerGroups, subnets); err != nil {
+				return nil, err
+			}
+			c.checkFreeIPAddresses(cfg.WorkerGroups, subnets)
+		}
+	}
+	if err := c.checkClustersQuota(cfg.Name); err != nil {
+		return nil, err
+	}
+	if err := c.checkKeyPair(cfg.Name, cfg.SSHAccess, owned.KeyPairs); err != nil {
+		return nil, err
+	}
+	return c.report, nil
+}
+
+func (c *Checker) add(name string, passed bool, format string, args ...interface{}) {
+	c.report.Checks = append(c.report.Checks, Check{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (c *Checker) checkVpc(id string) (*ec2.Vpc, error) {
+	out, err := c.ec2.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: aws.StringSlice([]string{id})})
+	if awsapi.IsErrorCode(err, "InvalidVpcID.NotFound") || err == nil && len(out.Vpcs) == 0 {
+		c.add("vpc", false, "%s not found", id)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe VPC %s: %w", id, err)
+	}
+	vpc := out.Vpcs[0]
+	c.add("vpc", true, "%s exists (%s)", id, aws.StringValue(vpc.CidrBlock))
+	return vpc, nil
+}
+
+// checkExistingSubnets checks subnets of subnet_ids exist in the VPC.
+func (c *Checker) checkExistingSubnets(vpcID string, ids []string) ([]subnet, error) {
+	var subnets []subnet
+	var problems []string
+	for _, id := range ids {
+		out, err := c.ec2.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{id})})
+		if awsapi.IsErrorCode(err, "InvalidSubnetID.NotFound") || err == nil && len(out.Subnets) == 0 {
+			problems = append(problems, id+" not found")
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot describe subnet %s: %w", id, err)
+		}
+		s := out.Subnets[0]
+		if v := aws.StringValue(s.VpcId); v != vpcID {
+			problems = append(problems, fmt.Sprintf("%s is in %s", id, v))
+			continue
+		}
+		subnets = append(subnets, subnet{
+			name:   id,
+			zone:   aws.StringValue(s.AvailabilityZone),
+			freeIP: aws.Int64Value(s.AvailableIpAddressCount),
+		})
+	}
+	if len(problems) > 0 {
+		c.add("subnets", false, "%s", strings.Join(problems, ", "))
+		return nil, nil
+	}
+	c.add("subnets", true, "%s in %s", strings.Join(ids, ", "), vpcID)
+	return subnets, nil
+}
+
+// checkSubnetLayout computes CIDR blocks of subnets created by the module
+// and checks they are inside the VPC and do not overlap its other subnets.
+func (c *Checker) checkSubnetLayout(cfg config.AWSKS, vpc *ec2.Vpc, owned map[string]bool) ([]subnet, error) {
+	blocks, err := cfg.Subnets.CIDRBlocks(aws.StringValue(vpc.CidrBlock))
+	if err != nil {
+		c.add("subnet layout", false, "%v", err)
+		return nil, nil
+	}
+	var vpcBlocks []*net.IPNet
+	for _, a := range vpc.CidrBlockAssociationSet {
+		if _, block, err := net.ParseCIDR(aws.StringValue(a.CidrBlock)); err == nil {
+			vpcBlocks = append(vpcBlocks, block)
+		}
+	}
+	out, err := c.ec2.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{cfg.VpcID})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe subnets of VPC %s: %w", cfg.VpcID, err)
+	}
+	zones, err := c.subnetZones(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets []subnet
+	var cidrs, problems []string
+	for i, block := range blocks {
+		cidrs = append(cidrs, block.String())
+		ones, bits := block.Mask.Size()
+		inVPC := false
+		for _, vpcBlock := range vpcBlocks {
+			if vpcOnes, _ := vpcBlock.Mask.Size(); vpcBlock.Contains(block.IP) && ones >= vpcOnes {
+				inVPC = true
+			}
+		}
+		if !inVPC {
+			problems = append(problems, fmt.Sprintf("%s is outside of VPC %s", block, cfg.VpcID))
+		}
+		for _, s := range out.Subnets {
+			if owned[aws.StringValue(s.SubnetId)] {
+				continue
+			}
+			_, existing, err := net.ParseCIDR(aws.StringValue(s.CidrBlock))
+			if err == nil && config.NetworksOverlap(block, existing) {
+				problems = append(problems, fmt.Sprintf("%s overlaps %s (%s)", block, aws.StringValue(s.SubnetId), existing))
+			}
+		}
+		s := subnet{name: block.String(), freeIP: int64(1)<<(bits-ones) - reservedIPAddresses}
+		if len(zones) > 0 {
+			s.zone = zones[i%len(zones)]
+		}
+		subnets = append(subnets, s)
+	}
+	// Other checks of planned subnets are meaningful despite conflicts.
+	if len(problems) > 0 {
+		c.add("subnet layout", false, "%s", strings.Join(problems, ", "))
+	} else {
+		c.add("subnet layout", true, "%s", strings.Join(cidrs, ", "))
+	}
+	return subnets, nil
+}
+
+// subnetZones returns zones used round-robin by created subnets, the same
+// way as in resources/terraform/infra.tf. Configured zones, which are not
+// available, are reported and skipped.
+func (c *Checker) subnetZones(cfg config.AWSKS) ([]string, error) {
+	out, err := c.ec2.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("state"), Values: aws.StringSlice([]string{ec2.AvailabilityZoneStateAvailable})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe availability zones: %w", err)
+	}
+	available := make(map[string]bool)
+	var zones []string
+	for _, z := range out.AvailabilityZones {
+		available[aws.StringValue(z.ZoneName)] = true
+		zones = append(zones, aws.StringValue(z.ZoneName))
+	}
+	if cfg.Subnets.AvailabilityZones == nil {
+		return zones, nil
+	}
+	var unavailable []string
+	for _, z := range cfg.Subnets.AvailabilityZones {
+		if !available[z] {
+			unavailable = append(unavailable, z)
+		}
+	}
+	if len(unavailable) > 0 {
+		c.add("availability zones", false, "%s not available in %s", strings.Join(unavailable, ", "), cfg.Region)
+		return nil, nil
+	}
+	return cfg.Subnets.AvailabilityZones, nil
+}
+
+// checkZones checks subnets span at least 2 availability zones, as EKS
+// requires. Subnets without zone were already reported by subnetZones.
+func (c *Checker) checkZones(subnets []subnet) {
+	zones := subnetZoneNames(subnets)
+	if len(zones) == 0 {
+		return
+	}
+	if len(zones) < 2 {
+		c.add("availability zones", false, "all subnets are in %s, EKS requires 2 availability zones", zones[0])
+		return
+	}
+	c.add("availability zones", true, "%s", strings.Join(zones, ", "))
+}
+
+// checkInstanceTypes checks instance types of worker groups are offered in
+// every zone of the subnets.
+func (c *Checker) checkInstanceTypes(groups []config.WorkerGroup, subnets []subnet) error {
+	zones := subnetZoneNames(subnets)
+	if len(zones) == 0 {
+		return nil
+	}
+	var types []string
+	seen := make(map[string]bool)
+	for _, wg := range groups {
+		for _, t := range wg.AllInstanceTypes() {
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	// Clusters running only on Fargate have no instances.
+	if len(types) == 0 {
+		return nil
+	}
+	out, err := c.ec2.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-type"), Values: aws.StringSlice(types)},
+			{Name: aws.String("location"), Values: aws.StringSlice(zones)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot describe instance type offerings: %w", err)
+	}
+	offered := make(map[string]bool)
+	for _, o := range out.InstanceTypeOfferings {
+		offered[aws.StringValue(o.InstanceType)+"/"+aws.StringValue(o.Location)] = true
+	}
+	var problems []string
+	for _, t := range types {
+		var missing []string
+		for _, z := range zones {
+			if !offered[t+"/"+z] {
+				missing = append(missing, z)
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s is not offered in %s", t, strings.Join(missing, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		c.add("instance types", false, "%s", strings.Join(problems, ", "))
+		return nil
+	}
+	c.add("instance types", true, "%s offered in %s", strings.Join(types, ", "), strings.Join(zones, ", "))
+	return nil
+}
+
+// checkFreeIPAddresses checks every subnet has addresses EKS requires and
+// all subnets together have an address for every node at maximum size.
+func (c *Checker) checkFreeIPAddresses(groups []config.WorkerGroup, subnets []subnet) {
+	var nodes, free int64
+	for _, wg := range groups {
+		nodes += int64(wg.AsgMaxSize)
+	}
+	var problems []string
+	for _, s := range subnets {
+		free += s.freeIP
+		if s.freeIP < minFreeIPAddresses {
+			problems = append(problems, fmt.Sprintf("%s has %d free addresses, EKS requires %d", s.name, s.freeIP, minFreeIPAddresses))
+		}
+	}
+	if free < nodes {
+		problems = append(problems, fmt.Sprintf("subnets have %d free addresses for %d nodes", free, nodes))
+	}
+	if len(problems) > 0 {
+		c.add("free ip addresses", false, "%s", strings.Join(problems, ", "))
+		return
+	}
+	c.add("free ip addresses", true, "%d free addresses for %d nodes", free, nodes)
+}
+
+// checkClustersQuota checks a new cluster does not exceed EKS clusters quota
+// of the region.
+func (c *Checker) checkClustersQuota(name string) error {
+	var clusters []string
+	err := c.eks.ListClustersPages(&eks.ListClustersInput{}, func(page *eks.ListClustersOutput, lastPage bool) bool {
+		clusters = append(clusters, aws.StringValueSlice(page.Clusters)...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list clusters: %w", err)
+	}
+	for _, cluster := range clusters {
+		if cluster == name {
+			c.add("eks clusters quota", true, "cluster %s exists", name)
+			return nil
+		}
+	}
+
+	quota := float64(defaultClustersQuota)
+	out, err := c.quotas.GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("eks"),
+		QuotaCode:   aws.String(clustersQuotaCode),
+	})
+	switch {
+	case err == nil:
+		quota = aws.Float64Value(out.Quota.Value)
+	// Quotas which were never adjusted are not reported, reading them may
+	// not be permitted, default value applies then.
+	case !awsapi.IsErrorCode(err, servicequotas.ErrCodeNoSuchResourceException, servicequotas.ErrCodeAccessDeniedException):
+		return fmt.Errorf("cannot get EKS clusters quota: %w", err)
+	}
+	c.add("eks clusters quota", float64(len(clusters)) < quota, "%d of %d clusters used", len(clusters), int(quota))
+	return nil
+}
+
+// checkKeyPair checks existing key pair of SSH access is present and key
+// pair imported by the module is not.
+func (c *Checker) checkKeyPair(name string, ssh config.SSHAccess, owned map[string]bool) error {
+	if !ssh.Enabled {
+		return nil
+	}
+	keyName, wantExisting := name+"-nodes-kp", false
+	if ssh.KeyName != nil {
+		keyName, wantExisting = *ssh.KeyName, true
+	}
+	if !wantExisting && owned[keyName] {
+		c.add("key pair", true, "%s imported by the module", keyName)
+		return nil
+	}
+	_, err := c.ec2.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice([]string{keyName})})
+	exists := err == nil
+	if err != nil && !awsapi.IsErrorCode(err, "InvalidKeyPair.NotFound") {
+		return fmt.Errorf("cannot describe key pair %s: %w", keyName, err)
+	}
+	switch {
+	case wantExisting && !exists:
+		c.add("key pair", false, "%s not found", keyName)
+	case wantExisting:
+		c.add("key pair", true, "%s exists", keyName)
+	case exists:
+		c.add("key pair", false, "%s already exists and cannot be imported", keyName)
+	default:
+		c.add("key pair", true, "%s will be imported", keyName)
+	}
+	return nil
+}
+
+// subnetZoneNames returns sorted distinct zones of subnets.
+func subnetZoneNames(subnets []subnet) []string {
+	seen := make(map[string]bool)
+	var zones []string
+	for _, s := range subnets {
+		if s.zone != "" && !seen[s.zone] {
+			seen[s.zone] = true
+			zones = append(zones, s.zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
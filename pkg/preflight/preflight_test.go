@@ -0,0 +1,276 @@
+package preflight
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi/fake"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/go-test/deep"
+)
+
+// awsksConfig returns configuration of cluster "ks" with subnets created in
+// vpc-1.
+func awsksConfig() config.AWSKS {
+	return config.AWSKS{
+		Name:    "ks",
+		VpcID:   "vpc-1",
+		Region:  "eu-central-1",
+		Subnets: config.Subnets{Count: 2, Newbits: 4, Role: "private"},
+		WorkerGroups: []config.WorkerGroup{
+			{Name: "default_wg", InstanceType: "t3.medium", AsgDesiredCapacity: 1, AsgMinSize: 1, AsgMaxSize: 3},
+		},
+	}
+}
+
+// seedAccount seeds account meeting requirements of awsksConfig.
+func seedAccount(cloud *fake.Cloud) {
+	cloud.AddVpc("vpc-1", "10.0.0.0/16")
+	cloud.AddSubnet("subnet-a", "vpc-1", "eu-central-1a", "10.0.0.0/24")
+	cloud.AddSubnet("subnet-b", "vpc-1", "eu-central-1b", "10.0.1.0/28")
+	cloud.AddInstanceTypeOffering("t3.medium", cloud.AvailabilityZones...)
+	cloud.AddCluster(&eks.Cluster{Name: aws.String("other")})
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(cfg *config.AWSKS, cloud *fake.Cloud)
+		owned      Owned
+		wantFailed []Check
+	}{
+		{
+			name: "passing",
+		},
+		{
+			name: "missing VPC",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.VpcID = "vpc-2"
+			},
+			wantFailed: []Check{{Name: "vpc", Detail: "vpc-2 not found"}},
+		},
+		{
+			name: "layout overlapping existing subnets",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.Subnets.Netnums = []int{0, 1}
+				cloud.AddSubnet("subnet-c", "vpc-2", "eu-central-1a", "10.0.16.0/20")
+			},
+			wantFailed: []Check{{Name: "subnet layout", Detail: "10.0.0.0/20 overlaps subnet-a (10.0.0.0/24), 10.0.0.0/20 overlaps subnet-b (10.0.1.0/28)"}},
+		},
+		{
+			name: "layout overlapping subnet of the module",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.Subnets.Netnums = []int{0, 1}
+			},
+			owned: Owned{SubnetIDs: map[string]bool{"subnet-a": true, "subnet-b": true}},
+		},
+		{
+			name: "cidr outside of VPC",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.Subnets.CIDRs = []string{"10.0.2.0/24", "10.1.0.0/24"}
+			},
+			wantFailed: []Check{{Name: "subnet layout", Detail: "10.1.0.0/24 is outside of VPC vpc-1"}},
+		},
+		{
+			name: "unavailable zone",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.Subnets.AvailabilityZones = []string{"eu-central-1a", "eu-central-1d"}
+			},
+			wantFailed: []Check{{Name: "availability zones", Detail: "eu-central-1d not available in eu-central-1"}},
+		},
+		{
+			name: "single zone",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cloud.AvailabilityZones = []string{"eu-central-1a"}
+			},
+			wantFailed: []Check{{Name: "availability zones", Detail: "all subnets are in eu-central-1a, EKS requires 2 availability zones"}},
+		},
+		{
+			name: "instance type not offered in zone",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.WorkerGroups[0].InstanceType = ""
+				cfg.WorkerGroups[0].InstanceTypes = []string{"t3.medium", "m6g.large"}
+				cloud.AddInstanceTypeOffering("m6g.large", "eu-central-1a")
+			},
+			wantFailed: []Check{{Name: "instance types", Detail: "m6g.large is not offered in eu-central-1b"}},
+		},
+		{
+			name: "Fargate only cluster",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.WorkerGroups = nil
+				cloud.FailNext("DescribeInstanceTypeOfferings", "AccessDenied", 1)
+			},
+		},
+		{
+			name: "existing subnets",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SubnetIDs = []string{"subnet-a", "subnet-b"}
+				for i := 0; i < 6; i++ {
+					cloud.AddNetworkInterface("eni-"+string(rune('a'+i)), "subnet-b", true)
+				}
+			},
+			wantFailed: []Check{{Name: "free ip addresses", Detail: "subnet-b has 5 free addresses, EKS requires 6"}},
+		},
+		{
+			name: "existing subnets in other VPC",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SubnetIDs = []string{"subnet-a", "subnet-c", "subnet-d"}
+				cloud.AddSubnet("subnet-c", "vpc-2", "eu-central-1b", "10.1.0.0/24")
+			},
+			wantFailed: []Check{{Name: "subnets", Detail: "subnet-c is in vpc-2, subnet-d not found"}},
+		},
+		{
+			name: "existing subnets in single zone",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SubnetIDs = []string{"subnet-a", "subnet-c"}
+				cloud.AddSubnet("subnet-c", "vpc-1", "eu-central-1a", "10.0.2.0/24")
+			},
+			wantFailed: []Check{{Name: "availability zones", Detail: "all subnets are in eu-central-1a, EKS requires 2 availability zones"}},
+		},
+		{
+			name: "more nodes than addresses",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.Subnets.Newbits = 12
+				cfg.WorkerGroups[0].AsgMaxSize = 30
+			},
+			wantFailed: []Check{{Name: "free ip addresses", Detail: "subnets have 22 free addresses for 30 nodes"}},
+		},
+		{
+			name: "clusters quota reached",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cloud.SetServiceQuota("eks", clustersQuotaCode, 1)
+			},
+			wantFailed: []Check{{Name: "eks clusters quota", Detail: "1 of 1 clusters used"}},
+		},
+		{
+			name: "cluster exists",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cloud.SetServiceQuota("eks", clustersQuotaCode, 1)
+				cloud.AddCluster(&eks.Cluster{Name: aws.String("ks")})
+			},
+		},
+		{
+			name: "missing key pair",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SSHAccess = config.SSHAccess{Enabled: true, KeyName: aws.String("admin")}
+			},
+			wantFailed: []Check{{Name: "key pair", Detail: "admin not found"}},
+		},
+		{
+			name: "existing key pair",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SSHAccess = config.SSHAccess{Enabled: true, KeyName: aws.String("admin")}
+				cloud.AddKeyPair("admin")
+			},
+		},
+		{
+			name: "imported key pair exists",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SSHAccess = config.SSHAccess{Enabled: true, PublicKeyPath: aws.String("vms_rsa.pub")}
+				cloud.AddKeyPair("ks-nodes-kp")
+			},
+			wantFailed: []Check{{Name: "key pair", Detail: "ks-nodes-kp already exists and cannot be imported"}},
+		},
+		{
+			name: "key pair imported by the module",
+			modify: func(cfg *config.AWSKS, cloud *fake.Cloud) {
+				cfg.SSHAccess = config.SSHAccess{Enabled: true, PublicKeyPath: aws.String("vms_rsa.pub")}
+				cloud.AddKeyPair("ks-nodes-kp")
+			},
+			owned: Owned{KeyPairs: map[string]bool{"ks-nodes-kp": true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := fake.New()
+			seedAccount(cloud)
+			cfg := awsksConfig()
+			if tt.modify != nil {
+				tt.modify(&cfg, cloud)
+			}
+
+			report, err := New(cloud.Clients()).Run(cfg, tt.owned)
+			if err != nil {
+				t.Fatalf("Run() failed with: %v", err)
+			}
+			if diff := deep.Equal(report.Failed(), tt.wantFailed); diff != nil {
+				t.Errorf("unexpected failed checks: %v\n%+v", diff, report.Checks)
+			}
+			err = report.Err()
+			var failedErr *FailedError
+			if len(tt.wantFailed) > 0 && !errors.As(err, &failedErr) {
+				t.Errorf("expected FailedError, got: %v", err)
+			}
+			if len(tt.wantFailed) == 0 && err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	cloud := fake.New()
+	seedAccount(cloud)
+	report, err := New(cloud.Clients()).Run(awsksConfig(), Owned{})
+	if err != nil {
+		t.Fatalf("Run() failed with: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `CHECK               RESULT  DETAIL
+vpc                 pass    vpc-1 exists (10.0.0.0/16)
+subnet layout       pass    10.0.240.0/20, 10.0.224.0/20
+availability zones  pass    eu-central-1a, eu-central-1b
+instance types      pass    t3.medium offered in eu-central-1a, eu-central-1b
+free ip addresses   pass    8182 free addresses for 3 nodes
+eks clusters quota  pass    1 of 100 clusters used
+`
+	if diff := deep.Equal(strings.Split(out.String(), "\n"), strings.Split(want, "\n")); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    string
+		wantErr string
+	}{
+		{
+			name:    "VPC",
+			fail:    "DescribeVpcs",
+			wantErr: "cannot describe VPC vpc-1: AccessDenied",
+		},
+		{
+			name:    "instance type offerings",
+			fail:    "DescribeInstanceTypeOfferings",
+			wantErr: "cannot describe instance type offerings: AccessDenied",
+		},
+		{
+			name:    "clusters",
+			fail:    "ListClusters",
+			wantErr: "cannot list clusters: AccessDenied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := fake.New()
+			seedAccount(cloud)
+			cloud.FailNext(tt.fail, "AccessDenied", 1)
+
+			_, err := New(cloud.Clients()).Run(awsksConfig(), Owned{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package state provides model and validation of the shared state file
+// state.yml, which is written by all modules using the same shared
+// directory.
+//
+// Model covers only sections used by this module: awsks written by the
+// module itself and awsbi read during init. State file is still updated
+// section by section, so sections of other modules are kept intact.
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the value of kind field of state document.
+const Kind = "state"
+
+// Status of a module recorded in state file.
+type Status string
+
+const (
+	StatusInitialized Status = "initialized"
+	StatusApplied     Status = "applied"
+	StatusDestroyed   Status = "destroyed"
+)
+
+var knownStatuses = []Status{StatusInitialized, StatusApplied, StatusDestroyed}
+
+// allowedStatuses lists statuses of awsks section required by commands.
+var allowedStatuses = map[string][]Status{
+	"plan":    {StatusInitialized, StatusApplied},
+	"apply":   {StatusInitialized, StatusApplied},
+	"audit":   {StatusApplied},
+	"upgrade": {StatusApplied},
+}
+
+// State is the state.yml document.
+type State struct {
+	Kind  string `yaml:"kind"`
+	AWSBI *AWSBI `yaml:"awsbi"`
+	AWSKS *AWSKS `yaml:"awsks"`
+}
+
+// AWSBI is the section of AWS Basic Infrastructure module.
+type AWSBI struct {
+	Status Status `yaml:"status"`
+	// RsaPubPath is the public key file of virtual machines, which can be
+	// reused for SSH access to worker nodes.
+	RsaPubPath string      `yaml:"rsa_pub_path"`
+	Output     AWSBIOutput `yaml:"output"`
+}
+
+// AWSBIOutput are outputs of AWS Basic Infrastructure module used by this
+// module.
+type AWSBIOutput struct {
+	VpcID               string `yaml:"vpc_id.value"`
+	PrivateRouteTableID string `yaml:"private_route_table_id.value"`
+}
+
+// AWSKS is the section of this module. Configuration fields are copied to it
+// after apply.
+type AWSKS struct {
+	Status       Status `yaml:"status"`
+	config.AWSKS `yaml:",inline"`
+	Output       AWSKSOutput `yaml:"output"`
+	Upgrade      *Upgrade    `yaml:"upgrade"`
+}
+
+// AWSKSOutput are terraform outputs of this module.
+type AWSKSOutput struct {
+	Kubeconfig string `yaml:"kubeconfig.value"`
+	// KubeconfigPrivateOnly is set when public API endpoint is disabled, so
+	// kubeconfig works only from inside the VPC.
+	KubeconfigPrivateOnly bool `yaml:"kubeconfig_private_only.value"`
+	// KMSKeyARN is the key encrypting Kubernetes secrets, empty without
+	// encryption.
+	KMSKeyARN string `yaml:"kms_key_arn.value"`
+}
+
+// Upgrade is the last Kubernetes version upgrade. Steps are marked done as
+// they finish, so an interrupted upgrade can be resumed.
+type Upgrade struct {
+	From  string        `yaml:"from"`
+	To    string        `yaml:"to"`
+	Steps []UpgradeStep `yaml:"steps"`
+}
+
+// UpgradeStep is a single step of upgrade, e.g. update of control plane to
+// Kubernetes version or of autoscaler to image tag.
+type UpgradeStep struct {
+	Action  string `yaml:"action"`
+	Target  string `yaml:"target"`
+	Version string `yaml:"version"`
+	Done    bool   `yaml:"done"`
+}
+
+// Finished reports whether all steps are done.
+func (u *Upgrade) Finished() bool {
+	for _, s := range u.Steps {
+		if !s.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidationErrors lists all problems found in state.
+type ValidationErrors []config.FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return "invalid state:\n" + strings.Join(lines, "\n")
+}
+
+// Load reads and validates state file. Missing file results in empty state.
+func Load(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{}, nil
+		}
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse decodes and validates state document. Empty document results in
+// empty state.
+func Parse(data []byte) (*State, error) {
+	var s State
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("cannot parse state: %w", err)
+	}
+	if errs := s.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return &s, nil
+}
+
+// Validate checks consistency of the state.
+func (s *State) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, config.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	empty := s.Kind == "" && s.AWSBI == nil && s.AWSKS == nil
+	if !empty && s.Kind != Kind {
+		add("kind", "must be %q, got %q", Kind, s.Kind)
+	}
+
+	if s.AWSBI != nil {
+		if v := s.AWSBI.Output.VpcID; v != "" && !strings.HasPrefix(v, "vpc-") {
+			add("awsbi.output.vpc_id.value", "%q is not a VPC id", v)
+		}
+		if v := s.AWSBI.Output.PrivateRouteTableID; v != "" && !strings.HasPrefix(v, "rtb-") {
+			add("awsbi.output.private_route_table_id.value", "%q is not a route table id", v)
+		}
+	}
+
+	if s.AWSKS != nil {
+		if !isKnown(s.AWSKS.Status) {
+			add("awsks.status", "must be one of %s, got %q", statusList(knownStatuses), s.AWSKS.Status)
+		}
+		if s.AWSKS.Status == StatusApplied && s.AWSKS.Name == "" {
+			add("awsks.name", "must be set when status is %s", StatusApplied)
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// ValidateFor checks if command can be run in current state.
+func (s *State) ValidateFor(command string) error {
+	allowed, ok := allowedStatuses[command]
+	if !ok {
+		return nil
+	}
+	if s.AWSKS == nil {
+		return ValidationErrors{{Field: "awsks", Message: fmt.Sprintf("section is missing, run init before %s", command)}}
+	}
+	for _, status := range allowed {
+		if s.AWSKS.Status == status {
+			return nil
+		}
+	}
+	hint := "run init first"
+	if s.AWSKS.Status == StatusInitialized {
+		hint = "run apply first"
+	}
+	return ValidationErrors{{
+		Field:   "awsks.status",
+		Message: fmt.Sprintf("is %s, but %s requires one of %s (%s)", s.AWSKS.Status, command, statusList(allowed), hint),
+	}}
+}
+
+func isKnown(status Status) bool {
+	for _, s := range knownStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func statusList(statuses []Status) string {
+	names := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		names = append(names, string(s))
+	}
+	return strings.Join(names, ", ")
+}
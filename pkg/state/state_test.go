@@ -0,0 +1,222 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/go-test/deep"
+)
+
+const appliedState = `kind: state
+awsbi:
+  status: applied
+  name: epiphany
+  rsa_pub_path: "/shared/vms_rsa.pub"
+  output:
+    private_ip.value: []
+    private_route_table_id.value: rtb-0ffd4cbe3a8dc8c7b
+    vpc_id.value: vpc-0baa2c4e9e48e608c
+awsks:
+  status: applied
+  name: epiphany
+  vpc_id: vpc-0baa2c4e9e48e608c
+  region: eu-central-1
+  k8s_version: "1.18"
+  autoscaler_version: null
+  subnet_ids: null
+  private_route_table_id: rtb-0ffd4cbe3a8dc8c7b
+  subnets:
+    count: 2
+    availability_zones: null
+    newbits: 4
+    netnums: null
+    cidrs: null
+    role: private
+  endpoint_private_access: false
+  endpoint_public_access: true
+  public_access_cidrs: null
+  disk_size: 32
+  autoscaler_scale_down_utilization_threshold: 0.65
+  ami_type: AL2_x86_64
+  ssh_access:
+    enabled: false
+    key_name: null
+    public_key_path: null
+    source_security_group_ids: null
+  encryption:
+    enabled: false
+    kms_key_arn: null
+  log_types:
+    - api
+    - audit
+  log_retention_days: 30
+  log_kms_key_id: null
+  tags: {}
+  required_tag_keys: []
+  addons: []
+  fargate_profiles: []
+  worker_groups:
+    - name: default_wg
+      instance_type: t2.small
+      asg_desired_capacity: 1
+      asg_min_size: 1
+      asg_max_size: 1
+  output:
+    kms_key_arn.value: arn:aws:kms:eu-central-1:123456789012:key/1
+    kubeconfig.value: |
+      apiVersion: v1
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(appliedState))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	want := &State{
+		Kind: Kind,
+		AWSBI: &AWSBI{
+			Status:     StatusApplied,
+			RsaPubPath: "/shared/vms_rsa.pub",
+			Output:     AWSBIOutput{VpcID: "vpc-0baa2c4e9e48e608c", PrivateRouteTableID: "rtb-0ffd4cbe3a8dc8c7b"},
+		},
+		AWSKS: &AWSKS{
+			Status: StatusApplied,
+			AWSKS: config.AWSKS{
+				Name:                                    "epiphany",
+				VpcID:                                   "vpc-0baa2c4e9e48e608c",
+				Region:                                  "eu-central-1",
+				K8sVersion:                              "1.18",
+				PrivateRouteTableID:                     "rtb-0ffd4cbe3a8dc8c7b",
+				Subnets:                                 config.Subnets{Count: 2, Newbits: 4, Role: "private"},
+				EndpointPublicAccess:                    true,
+				DiskSize:                                32,
+				AutoscalerScaleDownUtilizationThreshold: 0.65,
+				AmiType:                                 "AL2_x86_64",
+				LogTypes:                                []string{"api", "audit"},
+				LogRetentionDays:                        30,
+				Tags:                                    map[string]string{},
+				RequiredTagKeys:                         []string{},
+				Addons:                                  []config.Addon{},
+				FargateProfiles:                         []config.FargateProfile{},
+				WorkerGroups: []config.WorkerGroup{
+					{Name: "default_wg", InstanceType: "t2.small", AsgDesiredCapacity: 1, AsgMinSize: 1, AsgMaxSize: 1},
+				},
+			},
+			Output: AWSKSOutput{Kubeconfig: "apiVersion: v1\n", KMSKeyARN: "arn:aws:kms:eu-central-1:123456789012:key/1"},
+		},
+	}
+	if diff := deep.Equal(s, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "corrupted document",
+			content: "kind: state\nawsks:\n  status: [applied\n",
+			wantErr: "cannot parse state",
+		},
+		{
+			name:    "wrong section type",
+			content: "kind: state\nawsks: applied\n",
+			wantErr: "cannot parse state",
+		},
+		{
+			name:    "wrong kind",
+			content: strings.Replace(appliedState, "kind: state", "kind: awsks-config", 1),
+			wantErr: `kind: must be "state", got "awsks-config"`,
+		},
+		{
+			name:    "unknown status",
+			content: strings.Replace(appliedState, "  status: applied\n  name: epiphany\n  vpc_id", "  status: done\n  name: epiphany\n  vpc_id", 1),
+			wantErr: `awsks.status: must be one of initialized, applied, destroyed, got "done"`,
+		},
+		{
+			name:    "applied without configuration",
+			content: "kind: state\nawsks:\n  status: applied\n",
+			wantErr: "awsks.name: must be set when status is applied",
+		},
+		{
+			name:    "awsbi output is not VPC id",
+			content: strings.Replace(appliedState, "vpc_id.value: vpc-0baa2c4e9e48e608c", "vpc_id.value: subnet-0137cf1e7921c1551", 1),
+			wantErr: `awsbi.output.vpc_id.value: "subnet-0137cf1e7921c1551" is not a VPC id`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		command string
+		wantErr string
+	}{
+		{
+			name:    "plan initialized",
+			content: "kind: state\nawsks:\n  status: initialized\n",
+			command: "plan",
+		},
+		{
+			name:    "plan applied",
+			content: appliedState,
+			command: "plan",
+		},
+		{
+			name:    "plan destroyed",
+			content: "kind: state\nawsks:\n  status: destroyed\n",
+			command: "plan",
+			wantErr: "awsks.status: is destroyed, but plan requires one of initialized, applied (run init first)",
+		},
+		{
+			name:    "apply without init",
+			content: "",
+			command: "apply",
+			wantErr: "awsks: section is missing, run init before apply",
+		},
+		{
+			name:    "audit initialized",
+			content: "kind: state\nawsks:\n  status: initialized\n",
+			command: "audit",
+			wantErr: "awsks.status: is initialized, but audit requires one of applied (run apply first)",
+		},
+		{
+			name:    "other commands are not restricted",
+			content: "kind: state\nawsks:\n  status: destroyed\n",
+			command: "validate-state",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse() failed with: %v", err)
+			}
+			err = s.ValidateFor(tt.command)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateFor() failed with: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+func (s *Sweeper) findAddresses() ([]Resource, error) {
+	eipDescInp := &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:resource_group"),
+				Values: []*string{aws.String(s.config.ModuleName)},
+			},
+		},
+	}
+
+	describeEips, err := s.ec2.DescribeAddresses(eipDescInp)
+	if err != nil {
+		return nil, fmt.Errorf("EIP: cannot get EIP list: %w", err)
+	}
+
+	var result []Resource
+	for _, eip := range describeEips.Addresses {
+		result = append(result, Resource{Kind: KindEIP, ID: aws.StringValue(eip.AllocationId)})
+	}
+	return result, nil
+}
+
+func (s *Sweeper) describeInternetGateways(igws []Resource) ([]Resource, error) {
+	var result []Resource
+	for _, igw := range igws {
+		descOut, err := s.ec2.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+			InternetGatewayIds: []*string{aws.String(igw.ID)},
+		})
+		if err != nil {
+			if awsapi.IsErrorCode(err, "InvalidInternetGatewayID.NotFound") {
+				s.logf("Internet Gateway: %s not found", igw.ID)
+				continue
+			}
+			return nil, fmt.Errorf("Internet Gateway: describing internet gateway error: %w", err)
+		}
+		for _, g := range descOut.InternetGateways {
+			r := Resource{Kind: KindInternetGateway, ID: aws.StringValue(g.InternetGatewayId)}
+			if len(g.Attachments) > 0 {
+				r.Parent = aws.StringValue(g.Attachments[0].VpcId)
+			}
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (s *Sweeper) findNetworkInterfaces(subnetID string) ([]Resource, error) {
+	eniDescInp := &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("subnet-id"),
+				Values: []*string{aws.String(subnetID)},
+			},
+		},
+	}
+
+	describeEnis, err := s.ec2.DescribeNetworkInterfaces(eniDescInp)
+	if err != nil {
+		return nil, fmt.Errorf("ENI: cannot get ENI list for subnet %s: %w", subnetID, err)
+	}
+
+	var result []Resource
+	for _, eni := range describeEnis.NetworkInterfaces {
+		r := Resource{Kind: KindNetworkInterface, ID: aws.StringValue(eni.NetworkInterfaceId), Parent: subnetID}
+		if eni.Attachment != nil {
+			r.Attachment = aws.StringValue(eni.Attachment.AttachmentId)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removeEc2(instanceID string) error {
+	s.logf("EC2: Removing instance with ID: %s", instanceID)
+
+	ec2DescInp := &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}
+
+	outDesc, err := s.ec2.DescribeInstances(ec2DescInp)
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidInstanceID.NotFound") {
+			s.logf("EC2: Instance %s not found", instanceID)
+			return nil
+		}
+		return fmt.Errorf("EC2: describe error: %w", err)
+	}
+
+	if len(outDesc.Reservations) == 0 {
+		return nil
+	}
+
+	_, err = s.ec2.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return fmt.Errorf("EC2: terminate error: %w", err)
+	}
+
+	if err := s.ec2.WaitUntilInstanceTerminated(ec2DescInp); err != nil {
+		return fmt.Errorf("EC2: waiting for termination error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeRouteTable(rtID string) error {
+	s.logf("RouteTable: Removing route table: %s", rtID)
+
+	_, err := s.ec2.DeleteRouteTable(&ec2.DeleteRouteTableInput{
+		RouteTableId: aws.String(rtID),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidRouteTableID.NotFound") {
+			s.logf("RouteTable: Route table %s not found", rtID)
+			return nil
+		}
+		return fmt.Errorf("RouteTable: deleting route table error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeSecurityGroup(sgID string) error {
+	s.logf("Security Group: Removing security group: %s", sgID)
+
+	_, err := s.ec2.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(sgID)})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidGroup.NotFound") {
+			s.logf("Security Group: Security group %s not found", sgID)
+			return nil
+		}
+		return fmt.Errorf("Security Group: deleting security group error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeInternetGateway(igwID, vpcID string) error {
+	s.logf("Internet Gateway: Removing internet gateway: %s", igwID)
+
+	if vpcID != "" {
+		_, err := s.ec2.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: aws.String(igwID),
+			VpcId:             aws.String(vpcID),
+		})
+		if err != nil && !awsapi.IsErrorCode(err, "Gateway.NotAttached") {
+			return fmt.Errorf("Internet Gateway: detaching internet gateway error: %w", err)
+		}
+	}
+
+	_, err := s.ec2.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{
+		InternetGatewayId: aws.String(igwID),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidInternetGatewayID.NotFound") {
+			s.logf("Internet Gateway: Internet gateway %s not found", igwID)
+			return nil
+		}
+		return fmt.Errorf("Internet Gateway: deleting internet gateway error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeNatGateway(ngID string) error {
+	s.logf("Nat Gateway: Removing NAT gateway: %s", ngID)
+
+	found, err := s.describeNatGateway(ngID)
+	if err != nil || !found {
+		return err
+	}
+
+	_, err = s.ec2.DeleteNatGateway(&ec2.DeleteNatGatewayInput{
+		NatGatewayId: aws.String(ngID),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "NatGatewayNotFound") {
+			s.logf("Nat Gateway: Element not found.")
+			return nil
+		}
+		return fmt.Errorf("Nat Gateway: deleting NAT Gateway: %w", err)
+	}
+
+	// NAT gateway is deleted asynchronously and holds its EIP and ENI until
+	// it reaches deleted state.
+	return s.poll(fmt.Sprintf("Nat Gateway: waiting for %s deletion", ngID), func() (bool, error) {
+		found, err := s.describeNatGateway(ngID)
+		return !found, err
+	})
+}
+
+func (s *Sweeper) describeNatGateway(ngID string) (bool, error) {
+	outDesc, err := s.ec2.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		NatGatewayIds: []*string{aws.String(ngID)},
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "NatGatewayNotFound") {
+			s.logf("Nat Gateway: Nat Gateway not found.")
+			return false, nil
+		}
+		return false, fmt.Errorf("Nat Gateway: describe error: %w", err)
+	}
+
+	if len(outDesc.NatGateways) == 0 || aws.StringValue(outDesc.NatGateways[0].State) == ec2.NatGatewayStateDeleted {
+		s.logf("Nat Gateway: Element not found or has been already deleted.")
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *Sweeper) removeNetworkInterface(eniID, attachmentID string) error {
+	if attachmentID != "" {
+		_, err := s.ec2.DetachNetworkInterface(&ec2.DetachNetworkInterfaceInput{
+			AttachmentId: aws.String(attachmentID),
+			Force:        aws.Bool(true),
+		})
+		if err != nil && !awsapi.IsErrorCode(err, "InvalidAttachmentID.NotFound") {
+			return fmt.Errorf("ENI: cannot detach ENI with ID %s: %w", eniID, err)
+		}
+		s.logf("ENI: Detached ENI with id %s", eniID)
+	}
+
+	// Detaching is asynchronous, so deletion is retried while interface is
+	// still in use.
+	return s.poll("ENI: deleting ENI "+eniID, func() (bool, error) {
+		_, err := s.ec2.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String(eniID),
+		})
+		if err != nil {
+			if awsapi.IsErrorCode(err, "InvalidNetworkInterfaceID.NotFound") {
+				s.logf("ENI: ENI %s not found", eniID)
+				return true, nil
+			}
+			if awsapi.IsErrorCode(err, "InvalidNetworkInterface.InUse") {
+				return false, nil
+			}
+			return false, fmt.Errorf("ENI: cannot delete ENI with ID %s: %w", eniID, err)
+		}
+		s.logf("ENI: Removed ENI with id %s", eniID)
+		return true, nil
+	})
+}
+
+func (s *Sweeper) removeSubnet(subnetID string) error {
+	s.logf("Subnet: Removing subnet: %s", subnetID)
+
+	_, err := s.ec2.DeleteSubnet(&ec2.DeleteSubnetInput{
+		SubnetId: aws.String(subnetID),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidSubnetID.NotFound") {
+			s.logf("Subnet: Subnet %s not found", subnetID)
+			return nil
+		}
+		return fmt.Errorf("Subnet: deleting subnet error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeVpc(vpcID string) error {
+	s.logf("VPC: Removing VPC: %s", vpcID)
+
+	_, err := s.ec2.DeleteVpc(&ec2.DeleteVpcInput{
+		VpcId: aws.String(vpcID),
+	})
+	if err != nil {
+		// VPC removal is best effort, as it may still hold resources not
+		// created by the module.
+		s.logf("VPC: Delete VPC error: %s", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeKeyPair(kpName string) error {
+	s.logf("Key Pair: Removing key pair: %s", kpName)
+
+	_, err := s.ec2.DeleteKeyPair(&ec2.DeleteKeyPairInput{
+		KeyName: aws.String(kpName),
+	})
+	if err != nil {
+		return fmt.Errorf("Key Pair: deleting key pair error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) removeLaunchTemplate(ltID string) error {
+	s.logf("Launch Template: Removing launch template: %s", ltID)
+
+	_, err := s.ec2.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{
+		LaunchTemplateId: aws.String(ltID),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, "InvalidLaunchTemplateId.NotFound") {
+			s.logf("Launch Template: Launch template %s not found", ltID)
+			return nil
+		}
+		return fmt.Errorf("Launch Template: deleting launch template error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) releaseAddress(allocationID string) error {
+	s.logf("EIP: Releasing EIP with AllocationId: %s", allocationID)
+
+	eipToReleaseInp := &ec2.ReleaseAddressInput{
+		AllocationId: aws.String(allocationID),
+	}
+
+	// AuthFailure is returned while address is still associated with
+	// resource being deleted.
+	return s.poll("EIP: releasing EIP "+allocationID, func() (bool, error) {
+		_, err := s.ec2.ReleaseAddress(eipToReleaseInp)
+		if err == nil || awsapi.IsErrorCode(err, "InvalidAllocationID.NotFound") {
+			return true, nil
+		}
+		if awsapi.IsErrorCode(err, "AuthFailure") {
+			return false, nil
+		}
+		return false, fmt.Errorf("EIP: releasing EIP error: %w", err)
+	})
+}
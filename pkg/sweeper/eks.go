@@ -0,0 +1,127 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+func (s *Sweeper) findNodeGroups() ([]Resource, error) {
+	var result []Resource
+	err := s.eks.ListNodegroupsPages(&eks.ListNodegroupsInput{
+		ClusterName: aws.String(s.clusterName()),
+	}, func(page *eks.ListNodegroupsOutput, lastPage bool) bool {
+		for _, name := range page.Nodegroups {
+			result = append(result, Resource{Kind: KindNodeGroup, ID: aws.StringValue(name), Parent: s.clusterName()})
+		}
+		return true
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			s.logf("EKS: no cluster resource found with name %s", s.clusterName())
+			return nil, nil
+		}
+		return nil, fmt.Errorf("EKS: cannot list node groups: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removeNodeGroup(clusterName, nodeGroupName string) error {
+	s.logf("EKS: Removing node group: %s", nodeGroupName)
+
+	_, err := s.eks.DeleteNodegroup(&eks.DeleteNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodeGroupName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			s.logf("EKS: no node group resource found with name %s", nodeGroupName)
+			return nil
+		}
+		return fmt.Errorf("EKS: deleting node group error: %w", err)
+	}
+
+	err = s.eks.WaitUntilNodegroupDeleted(&eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodeGroupName),
+	})
+	if err != nil {
+		return fmt.Errorf("EKS: waiting for node group deletion error: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) findFargateProfiles() ([]Resource, error) {
+	var result []Resource
+	err := s.eks.ListFargateProfilesPages(&eks.ListFargateProfilesInput{
+		ClusterName: aws.String(s.clusterName()),
+	}, func(page *eks.ListFargateProfilesOutput, lastPage bool) bool {
+		for _, name := range page.FargateProfileNames {
+			result = append(result, Resource{Kind: KindFargateProfile, ID: aws.StringValue(name), Parent: s.clusterName()})
+		}
+		return true
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("EKS: cannot list Fargate profiles: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removeFargateProfile(clusterName, profileName string) error {
+	s.fargateMu.Lock()
+	defer s.fargateMu.Unlock()
+	s.logf("EKS: Removing Fargate profile: %s", profileName)
+
+	_, err := s.eks.DeleteFargateProfile(&eks.DeleteFargateProfileInput{
+		ClusterName:        aws.String(clusterName),
+		FargateProfileName: aws.String(profileName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			s.logf("EKS: no Fargate profile resource found with name %s", profileName)
+			return nil
+		}
+		return fmt.Errorf("EKS: deleting Fargate profile error: %w", err)
+	}
+
+	// SDK has no waiter for Fargate profiles and the next profile of the
+	// cluster can be deleted only after this one is gone.
+	return s.poll(fmt.Sprintf("EKS: waiting for Fargate profile %s deletion", profileName), func() (bool, error) {
+		_, err := s.eks.DescribeFargateProfile(&eks.DescribeFargateProfileInput{
+			ClusterName:        aws.String(clusterName),
+			FargateProfileName: aws.String(profileName),
+		})
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+func (s *Sweeper) removeCluster(clusterName string) error {
+	s.logf("EKS: Removing cluster: %s", clusterName)
+
+	_, err := s.eks.DeleteCluster(&eks.DeleteClusterInput{
+		Name: aws.String(clusterName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			s.logf("EKS: no cluster resource found with name %s", clusterName)
+			return nil
+		}
+		return fmt.Errorf("EKS: deleting cluster error: %w", err)
+	}
+
+	err = s.eks.WaitUntilClusterDeleted(&eks.DescribeClusterInput{
+		Name: aws.String(clusterName),
+	})
+	if err != nil {
+		return fmt.Errorf("EKS: waiting for cluster deletion error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dependsOnKinds lists for each kind which other kinds have to be removed
+// first. Subnet dependency on network interfaces is additionally scoped to
+// interfaces in that subnet (see newGraph).
+var dependsOnKinds = map[Kind][]Kind{
+	KindCluster:          {KindNodeGroup, KindFargateProfile},
+	KindSecurityGroup:    {KindInstance, KindNodeGroup, KindFargateProfile, KindCluster, KindNetworkInterface},
+	KindEIP:              {KindInstance, KindNatGateway},
+	KindInternetGateway:  {KindInstance, KindNatGateway, KindEIP},
+	KindNetworkInterface: {KindInstance, KindNodeGroup, KindFargateProfile, KindCluster, KindNatGateway},
+	KindSubnet:           {KindInstance, KindNodeGroup, KindFargateProfile, KindCluster, KindNatGateway, KindNetworkInterface},
+	KindRouteTable:       {KindSubnet},
+	KindVPC:              {KindSecurityGroup, KindInternetGateway, KindSubnet, KindRouteTable},
+	KindIAMRole:          {KindNodeGroup, KindFargateProfile, KindCluster},
+	KindIAMPolicy:        {KindIAMRole},
+	KindOIDCProvider:     {KindCluster, KindIAMRole},
+	KindLogGroup:         {KindCluster},
+	KindKeyPair:          {KindInstance, KindNodeGroup, KindLaunchTemplate},
+	KindLaunchTemplate:   {KindNodeGroup},
+	KindKMSAlias:         {KindCluster},
+	KindKMSKey:           {KindCluster, KindKMSAlias},
+	KindResourceGroup:    resourceGroupKinds,
+}
+
+type graphNode struct {
+	resource Resource
+	// dependencies have to be removed before this node
+	dependencies []*graphNode
+	// dependents can be removed only after this node
+	dependents []*graphNode
+}
+
+// graph is a dependency graph of resources to remove.
+type graph struct {
+	nodes []*graphNode
+}
+
+func newGraph(plan Plan) *graph {
+	g := &graph{}
+	byKind := make(map[Kind][]*graphNode)
+	for _, r := range plan {
+		n := &graphNode{resource: r}
+		g.nodes = append(g.nodes, n)
+		byKind[r.Kind] = append(byKind[r.Kind], n)
+	}
+
+	for _, n := range g.nodes {
+		for _, kind := range dependsOnKinds[n.resource.Kind] {
+			for _, d := range byKind[kind] {
+				if n.resource.Kind == KindSubnet && kind == KindNetworkInterface && d.resource.Parent != n.resource.ID {
+					continue
+				}
+				n.dependencies = append(n.dependencies, d)
+				d.dependents = append(d.dependents, n)
+			}
+		}
+	}
+	return g
+}
+
+// stages groups resources into consecutive sets which can be removed
+// concurrently. It is used to present deletion plan.
+func (g *graph) stages() [][]Resource {
+	remaining := make(map[*graphNode]int, len(g.nodes))
+	var current []*graphNode
+	for _, n := range g.nodes {
+		remaining[n] = len(n.dependencies)
+		if len(n.dependencies) == 0 {
+			current = append(current, n)
+		}
+	}
+
+	var result [][]Resource
+	for len(current) > 0 {
+		var stage []Resource
+		var next []*graphNode
+		for _, n := range current {
+			stage = append(stage, n.resource)
+			for _, d := range n.dependents {
+				remaining[d]--
+				if remaining[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		result = append(result, stage)
+		current = next
+	}
+	return result
+}
+
+type graphResult struct {
+	node *graphNode
+	err  error
+}
+
+// run calls remove for every node of the graph using at most workers
+// concurrent calls. Node is removed only after all its dependencies were
+// removed successfully. Failure of a node does not stop independent branches,
+// but all its dependents are skipped. Nodes in a dependency cycle never get
+// ready, they are reported as an error too.
+func (g *graph) run(workers int, remove func(Resource) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	remaining := make(map[*graphNode]int, len(g.nodes))
+	var ready []*graphNode
+	for _, n := range g.nodes {
+		remaining[n] = len(n.dependencies)
+		if len(n.dependencies) == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	results := make(chan graphResult)
+	inFlight := 0
+	done := make(map[*graphNode]bool, len(g.nodes))
+	var errs Errors
+	for len(ready) > 0 || inFlight > 0 {
+		for len(ready) > 0 && inFlight < workers {
+			n := ready[0]
+			ready = ready[1:]
+			inFlight++
+			go func(n *graphNode) {
+				results <- graphResult{node: n, err: remove(n.resource)}
+			}(n)
+		}
+
+		res := <-results
+		inFlight--
+		done[res.node] = true
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.node.resource, res.err))
+			continue
+		}
+		for _, d := range res.node.dependents {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	var skipped []string
+	for _, n := range g.nodes {
+		if !done[n] {
+			skipped = append(skipped, n.resource.String())
+		}
+	}
+	switch {
+	case len(errs) > 0 && len(skipped) > 0:
+		errs = append(errs, fmt.Errorf("skipped dependent resources: %s", strings.Join(skipped, ", ")))
+	case len(skipped) > 0:
+		errs = append(errs, fmt.Errorf("resources in dependency cycle were not removed: %s", strings.Join(skipped, ", ")))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Errors collects failures of independent removals.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,165 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+func (s *Sweeper) removeRole(roleName string) error {
+	s.logf("IAM: Role name to remove: %s", roleName)
+
+	// List managed policies for role
+	policies, err := s.iam.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			s.logf("IAM: No role to remove: %s", roleName)
+			return nil
+		}
+		return fmt.Errorf("IAM: listing attached role policies error: %w", err)
+	}
+
+	// Detach managed polices from role
+	for _, policy := range policies.AttachedPolicies {
+		_, err := s.iam.DetachRolePolicy(&iam.DetachRolePolicyInput{
+			PolicyArn: policy.PolicyArn,
+			RoleName:  aws.String(roleName),
+		})
+		if err != nil {
+			return fmt.Errorf("IAM: detaching role policy error: %w", err)
+		}
+	}
+
+	// List inline policies for role
+	inlinePolicies, err := s.iam.ListRolePolicies(&iam.ListRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		return fmt.Errorf("IAM: listing role policies error: %w", err)
+	}
+
+	// Delete inline polices from role
+	for _, inlinePolicy := range inlinePolicies.PolicyNames {
+		_, err := s.iam.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+			PolicyName: inlinePolicy,
+			RoleName:   aws.String(roleName),
+		})
+		if err != nil {
+			return fmt.Errorf("IAM: deleting role policy error: %w", err)
+		}
+	}
+
+	_, err = s.iam.DeleteRole(&iam.DeleteRoleInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		return fmt.Errorf("IAM: deleting role error: %w", err)
+	}
+	return nil
+}
+
+// findPolicies returns the customer managed policy of the cluster autoscaler.
+// Its ARN contains account id, so it is looked up by name.
+func (s *Sweeper) findPolicies() ([]Resource, error) {
+	var result []Resource
+	err := s.iam.ListPoliciesPages(&iam.ListPoliciesInput{
+		Scope: aws.String(iam.PolicyScopeTypeLocal),
+	}, func(page *iam.ListPoliciesOutput, lastPage bool) bool {
+		for _, policy := range page.Policies {
+			if aws.StringValue(policy.PolicyName) == s.policyName() {
+				result = append(result, Resource{Kind: KindIAMPolicy, ID: aws.StringValue(policy.Arn)})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("IAM: cannot list policies: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removePolicy(policyArn string) error {
+	s.logf("IAM: Policy to remove: %s", policyArn)
+
+	versions, err := s.iam.ListPolicyVersions(&iam.ListPolicyVersionsInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			s.logf("IAM: No policy to remove: %s", policyArn)
+			return nil
+		}
+		return fmt.Errorf("IAM: listing policy versions error: %w", err)
+	}
+
+	// Default version is deleted together with the policy
+	for _, version := range versions.Versions {
+		if aws.BoolValue(version.IsDefaultVersion) {
+			continue
+		}
+		_, err := s.iam.DeletePolicyVersion(&iam.DeletePolicyVersionInput{
+			PolicyArn: aws.String(policyArn),
+			VersionId: version.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("IAM: deleting policy version error: %w", err)
+		}
+	}
+
+	_, err = s.iam.DeletePolicy(&iam.DeletePolicyInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	if err != nil {
+		return fmt.Errorf("IAM: deleting policy error: %w", err)
+	}
+	return nil
+}
+
+// findOpenIDConnectProviders returns the OIDC provider of the cluster. Its
+// ARN is built from the cluster ARN and issuer, so the provider is found only
+// while the cluster exists.
+func (s *Sweeper) findOpenIDConnectProviders() ([]Resource, error) {
+	out, err := s.eks.DescribeCluster(&eks.DescribeClusterInput{
+		Name: aws.String(s.clusterName()),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("EKS: cannot describe cluster: %w", err)
+	}
+	cluster := out.Cluster
+	if cluster.Identity == nil || cluster.Identity.Oidc == nil || cluster.Identity.Oidc.Issuer == nil {
+		return nil, nil
+	}
+	// arn:partition:eks:region:account:cluster/name
+	parts := strings.Split(aws.StringValue(cluster.Arn), ":")
+	if len(parts) < 5 {
+		return nil, fmt.Errorf("EKS: unexpected cluster ARN format: %s", aws.StringValue(cluster.Arn))
+	}
+	issuer := strings.TrimPrefix(aws.StringValue(cluster.Identity.Oidc.Issuer), "https://")
+	arn := fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", parts[1], parts[4], issuer)
+	return []Resource{{Kind: KindOIDCProvider, ID: arn}}, nil
+}
+
+func (s *Sweeper) removeOpenIDConnectProvider(providerArn string) error {
+	s.logf("IAM: Removing OpenID Connect provider: %s", providerArn)
+
+	_, err := s.iam.DeleteOpenIDConnectProvider(&iam.DeleteOpenIDConnectProviderInput{
+		OpenIDConnectProviderArn: aws.String(providerArn),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			s.logf("IAM: No OpenID Connect provider to remove: %s", providerArn)
+			return nil
+		}
+		return fmt.Errorf("IAM: deleting OpenID Connect provider error: %w", err)
+	}
+	return nil
+}
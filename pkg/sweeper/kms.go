@@ -0,0 +1,68 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+// kmsKeyPendingWindowDays is the shortest waiting period before AWS deletes
+// a key scheduled for deletion.
+const kmsKeyPendingWindowDays = 7
+
+// findKMSKeys returns alias and key created for encryption of secrets. Key
+// already scheduled for deletion is left out.
+func (s *Sweeper) findKMSKeys() ([]Resource, error) {
+	out, err := s.kms.DescribeKey(&kms.DescribeKeyInput{
+		KeyId: aws.String(s.kmsAliasName()),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, kms.ErrCodeNotFoundException) {
+			s.logf("KMS: no key found with alias %s", s.kmsAliasName())
+			return nil, nil
+		}
+		return nil, fmt.Errorf("KMS: cannot describe key: %w", err)
+	}
+	result := []Resource{{Kind: KindKMSAlias, ID: s.kmsAliasName()}}
+	if aws.StringValue(out.KeyMetadata.KeyState) != kms.KeyStatePendingDeletion {
+		result = append(result, Resource{Kind: KindKMSKey, ID: aws.StringValue(out.KeyMetadata.KeyId)})
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removeKMSAlias(aliasName string) error {
+	s.logf("KMS: Removing alias: %s", aliasName)
+
+	_, err := s.kms.DeleteAlias(&kms.DeleteAliasInput{
+		AliasName: aws.String(aliasName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, kms.ErrCodeNotFoundException) {
+			s.logf("KMS: No alias to remove: %s", aliasName)
+			return nil
+		}
+		return fmt.Errorf("KMS: deleting alias error: %w", err)
+	}
+	return nil
+}
+
+// removeKMSKey schedules deletion of key, AWS does not delete keys
+// immediately.
+func (s *Sweeper) removeKMSKey(keyID string) error {
+	s.logf("KMS: Scheduling deletion of key: %s", keyID)
+
+	_, err := s.kms.ScheduleKeyDeletion(&kms.ScheduleKeyDeletionInput{
+		KeyId:               aws.String(keyID),
+		PendingWindowInDays: aws.Int64(kmsKeyPendingWindowDays),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, kms.ErrCodeNotFoundException) {
+			s.logf("KMS: No key to remove: %s", keyID)
+			return nil
+		}
+		return fmt.Errorf("KMS: scheduling key deletion error: %w", err)
+	}
+	return nil
+}
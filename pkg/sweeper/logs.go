@@ -0,0 +1,25 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+func (s *Sweeper) removeLogGroup(groupName string) error {
+	s.logf("CloudWatch: Removing log group: %s", groupName)
+
+	_, err := s.logs.DeleteLogGroup(&cloudwatchlogs.DeleteLogGroupInput{
+		LogGroupName: aws.String(groupName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+			s.logf("CloudWatch: No log group to remove: %s", groupName)
+			return nil
+		}
+		return fmt.Errorf("CloudWatch: deleting log group error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is a type of AWS resource handled by the sweeper.
+type Kind string
+
+const (
+	KindInstance         Kind = "Instance"
+	KindSecurityGroup    Kind = "SecurityGroup"
+	KindNatGateway       Kind = "NatGateway"
+	KindEIP              Kind = "EIP"
+	KindInternetGateway  Kind = "InternetGateway"
+	KindNetworkInterface Kind = "NetworkInterface"
+	KindSubnet           Kind = "Subnet"
+	KindRouteTable       Kind = "RouteTable"
+	KindVPC              Kind = "VPC"
+	KindNodeGroup        Kind = "NodeGroup"
+	KindFargateProfile   Kind = "FargateProfile"
+	KindCluster          Kind = "Cluster"
+	KindIAMRole          Kind = "IAMRole"
+	KindIAMPolicy        Kind = "IAMPolicy"
+	KindOIDCProvider     Kind = "OIDCProvider"
+	KindLogGroup         Kind = "LogGroup"
+	KindResourceGroup    Kind = "ResourceGroup"
+	KindKeyPair          Kind = "KeyPair"
+	KindLaunchTemplate   Kind = "LaunchTemplate"
+	KindKMSAlias         Kind = "KMSAlias"
+	KindKMSKey           Kind = "KMSKey"
+)
+
+// resourceGroupKinds are kinds discovered using module resource group.
+var resourceGroupKinds = []Kind{
+	KindInstance,
+	KindLaunchTemplate,
+	KindSecurityGroup,
+	KindNatGateway,
+	KindEIP,
+	KindInternetGateway,
+	KindSubnet,
+	KindRouteTable,
+	KindVPC,
+}
+
+// Resource is a single AWS resource scheduled for removal.
+type Resource struct {
+	Kind Kind
+	ID   string
+	// Parent is an id of owning resource when it is required for removal:
+	// cluster name for node groups and Fargate profiles, VPC id for internet gateways and subnet id
+	// for network interfaces.
+	Parent string
+	// Attachment is an id of network interface attachment to force detach.
+	Attachment string
+}
+
+func (r Resource) String() string {
+	if r.Parent != "" {
+		return fmt.Sprintf("%s %s (%s)", r.Kind, r.ID, r.Parent)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.ID)
+}
+
+// Plan is an ordered list of resources to remove.
+type Plan []Resource
+
+func (p Plan) String() string {
+	lines := make([]string, 0, len(p))
+	for i, r := range p {
+		lines = append(lines, fmt.Sprintf("%3d. %s", i+1, r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resourceIDFromArn extracts resource id from ARN of format
+// arn:aws:ec2:region:account:type/id.
+func resourceIDFromArn(arn string) (string, error) {
+	parts := strings.SplitN(arn, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("unexpected ARN format: %s", arn)
+	}
+	return parts[1], nil
+}
+
+// resourceKindFromType extracts kind from resource group type of format
+// AWS::EC2::Type.
+func resourceKindFromType(resourceType string) Kind {
+	parts := strings.Split(resourceType, ":")
+	return Kind(parts[len(parts)-1])
+}
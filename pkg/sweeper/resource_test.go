@@ -0,0 +1,61 @@
+package sweeper
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestResourceIDFromArn(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "subnet",
+			arn:  "arn:aws:ec2:eu-central-1:123456789012:subnet/subnet-0137cf1e7921c1551",
+			want: "subnet-0137cf1e7921c1551",
+		},
+		{
+			name: "nat gateway",
+			arn:  "arn:aws:ec2:eu-central-1:123456789012:natgateway/nat-0a1b2c3d",
+			want: "nat-0a1b2c3d",
+		},
+		{
+			name:    "no resource id",
+			arn:     "arn:aws:ec2:eu-central-1:123456789012:vpc",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resourceIDFromArn(tt.arn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resourceIDFromArn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestResourceKindFromType(t *testing.T) {
+	if diff := deep.Equal(resourceKindFromType("AWS::EC2::NatGateway"), KindNatGateway); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPlanString(t *testing.T) {
+	plan := Plan{
+		{Kind: KindNodeGroup, ID: "default_wg", Parent: "ks"},
+		{Kind: KindCluster, ID: "ks"},
+	}
+	want := "  1. NodeGroup default_wg (ks)\n  2. Cluster ks"
+	if diff := deep.Equal(plan.String(), want); diff != nil {
+		t.Error(diff)
+	}
+}
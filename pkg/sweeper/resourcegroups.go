@@ -0,0 +1,53 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/resourcegroups"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+// listResourceGroup returns resources registered in module resource group
+// grouped by their kind.
+func (s *Sweeper) listResourceGroup() (map[Kind][]Resource, error) {
+	result := make(map[Kind][]Resource)
+	err := s.rg.ListGroupResourcesPages(&resourcegroups.ListGroupResourcesInput{
+		GroupName: aws.String(s.resourceGroupName()),
+	}, func(page *resourcegroups.ListGroupResourcesOutput, lastPage bool) bool {
+		for _, identifier := range page.ResourceIdentifiers {
+			kind := resourceKindFromType(aws.StringValue(identifier.ResourceType))
+			id, err := resourceIDFromArn(aws.StringValue(identifier.ResourceArn))
+			if err != nil {
+				s.logf("Resource group: skipping resource: %s", err)
+				continue
+			}
+			result[kind] = append(result[kind], Resource{Kind: kind, ID: id})
+		}
+		return true
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, resourcegroups.ErrCodeNotFoundException) {
+			s.logf("Resource group: %s not found.", s.resourceGroupName())
+			return result, nil
+		}
+		return nil, fmt.Errorf("Resource group: cannot get list of resources: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Sweeper) removeResourceGroup(rgName string) error {
+	s.logf("Resource Group: Removing resource group: %s", rgName)
+
+	_, err := s.rg.DeleteGroup(&resourcegroups.DeleteGroupInput{
+		GroupName: aws.String(rgName),
+	})
+	if err != nil {
+		if awsapi.IsErrorCode(err, resourcegroups.ErrCodeNotFoundException) {
+			s.logf("Resource Group: Resource group not found.")
+			return nil
+		}
+		return fmt.Errorf("Resource Group: deleting resource group error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+// Package sweeper finds and removes AWS resources left behind by the awsks
+// (and awsbi) modules. It is used by the integration tests to clean up after
+// themselves and by the awsks-sweep command to remove leaked environments.
+package sweeper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+)
+
+const (
+	defaultRetries    = 30
+	defaultRetryDelay = 5 * time.Second
+	defaultWorkers    = 4
+)
+
+// Logger is satisfied by *testing.T as well as by simple writers wrapped with
+// WriterLogger, so the same sweeper can report to tests and to a terminal.
+type Logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// WriterLogger returns Logger printing every message as a separate line to w.
+func WriterLogger(w io.Writer) Logger {
+	return writerLogger{w: w}
+}
+
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l writerLogger) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(l.w, format+"\n", args...)
+}
+
+// Config describes which module environment should be swept.
+type Config struct {
+	// ModuleName is the value of M_NAME used when environment was created.
+	ModuleName string
+	Region     string
+	// AccessKey and SecretKey are optional. When empty default AWS
+	// credentials chain is used.
+	AccessKey string
+	SecretKey string
+	// Retries and RetryDelay control waiting for resources which are
+	// released asynchronously (NAT gateways, EIPs). Zero values mean defaults.
+	Retries    int
+	RetryDelay time.Duration
+	// Workers is the maximal number of resources removed concurrently.
+	Workers int
+	Logger  Logger
+}
+
+// Sweeper discovers and removes resources belonging to a single module
+// environment.
+type Sweeper struct {
+	config Config
+	ec2    awsapi.EC2API
+	eks    awsapi.EKSAPI
+	iam    awsapi.IAMAPI
+	kms    awsapi.KMSAPI
+	logs   awsapi.CloudWatchLogsAPI
+	rg     awsapi.ResourceGroupsAPI
+
+	// fargateMu serializes removal of Fargate profiles, EKS deletes only one
+	// profile of a cluster at a time.
+	fargateMu sync.Mutex
+}
+
+// New creates Sweeper with AWS session for configured region.
+func New(config Config) (*Sweeper, error) {
+	if config.Region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+
+	awsConfig := &aws.Config{
+		Region: aws.String(config.Region),
+	}
+	if config.AccessKey != "" || config.SecretKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+	}
+	s, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get session: %w", err)
+	}
+
+	return NewWithClients(config, awsapi.NewClients(s))
+}
+
+// NewWithClients creates Sweeper using provided AWS clients. It allows to
+// run the sweeper against fake implementations.
+func NewWithClients(config Config, clients awsapi.Clients) (*Sweeper, error) {
+	if config.ModuleName == "" {
+		return nil, fmt.Errorf("module name is required")
+	}
+	if config.Retries == 0 {
+		config.Retries = defaultRetries
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = defaultRetryDelay
+	}
+	if config.Workers == 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.Logger == nil {
+		config.Logger = WriterLogger(ioutil.Discard)
+	}
+
+	return &Sweeper{
+		config: config,
+		ec2:    clients.EC2,
+		eks:    clients.EKS,
+		iam:    clients.IAM,
+		kms:    clients.KMS,
+		logs:   clients.CloudWatchLogs,
+		rg:     clients.ResourceGroups,
+	}, nil
+}
+
+func (s *Sweeper) logf(format string, args ...interface{}) {
+	s.config.Logger.Logf(format, args...)
+}
+
+func (s *Sweeper) resourceGroupName() string {
+	return s.config.ModuleName + "-rg"
+}
+
+// keyPairNames are the key pair of virtual machines and the one imported for
+// SSH access to worker nodes.
+func (s *Sweeper) keyPairNames() []string {
+	return []string{s.config.ModuleName + "-kp", s.config.ModuleName + "-nodes-kp"}
+}
+
+// policyName is the customer managed policy attached to the autoscaler role.
+func (s *Sweeper) policyName() string {
+	return s.config.ModuleName + "-cluster-autoscaler"
+}
+
+// kmsAliasName is the alias of the key created for encryption of secrets.
+func (s *Sweeper) kmsAliasName() string {
+	return "alias/" + s.config.ModuleName + "-eks-secrets"
+}
+
+func (s *Sweeper) logGroupName() string {
+	return s.config.ModuleName + "-log-group"
+}
+
+func (s *Sweeper) clusterName() string {
+	return s.config.ModuleName
+}
+
+func (s *Sweeper) roleNames() []string {
+	return []string{
+		fmt.Sprintf("%s-eks-cluster-iam-role", s.config.ModuleName),
+		fmt.Sprintf("%s-eks-nodes-iam-role", s.config.ModuleName),
+		fmt.Sprintf("%s-eks-fargate-iam-role", s.config.ModuleName),
+		fmt.Sprintf("%s-cluster-autoscaler", s.config.ModuleName),
+	}
+}
+
+// Plan discovers resources of the module environment.
+func (s *Sweeper) Plan() (Plan, error) {
+	groupResources, err := s.listResourceGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan Plan
+	for _, kind := range resourceGroupKinds {
+		switch kind {
+		case KindEIP:
+			eips, err := s.findAddresses()
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, eips...)
+		case KindInternetGateway:
+			igws, err := s.describeInternetGateways(groupResources[kind])
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, igws...)
+		case KindSubnet:
+			for _, subnet := range groupResources[kind] {
+				enis, err := s.findNetworkInterfaces(subnet.ID)
+				if err != nil {
+					return nil, err
+				}
+				plan = append(plan, enis...)
+				plan = append(plan, subnet)
+			}
+		default:
+			plan = append(plan, groupResources[kind]...)
+		}
+	}
+
+	nodeGroups, err := s.findNodeGroups()
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, nodeGroups...)
+	fargateProfiles, err := s.findFargateProfiles()
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, fargateProfiles...)
+	plan = append(plan, Resource{Kind: KindCluster, ID: s.clusterName()})
+	for _, roleName := range s.roleNames() {
+		plan = append(plan, Resource{Kind: KindIAMRole, ID: roleName})
+	}
+	policies, err := s.findPolicies()
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, policies...)
+	oidcProviders, err := s.findOpenIDConnectProviders()
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, oidcProviders...)
+	plan = append(plan, Resource{Kind: KindLogGroup, ID: s.logGroupName()})
+	kmsKeys, err := s.findKMSKeys()
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, kmsKeys...)
+	plan = append(plan, Resource{Kind: KindResourceGroup, ID: s.resourceGroupName()})
+	for _, keyPairName := range s.keyPairNames() {
+		plan = append(plan, Resource{Kind: KindKeyPair, ID: keyPairName})
+	}
+	return plan, nil
+}
+
+// Stages returns resources of the plan grouped into consecutive stages.
+// Resources within a stage do not depend on each other and are removed
+// concurrently.
+func (s *Sweeper) Stages(plan Plan) [][]Resource {
+	return newGraph(plan).stages()
+}
+
+// Sweep removes all resources returned by Plan respecting dependencies between
+// them. When dryRun is true deletion plan is only printed to the logger and
+// nothing is removed.
+func (s *Sweeper) Sweep(dryRun bool) error {
+	plan, err := s.Plan()
+	if err != nil {
+		return err
+	}
+	g := newGraph(plan)
+
+	if dryRun {
+		s.logf("Dry run: following resources would be removed:")
+		for i, stage := range g.stages() {
+			s.logf("Stage %d:", i+1)
+			for _, r := range stage {
+				s.logf("  %s", r)
+			}
+		}
+		return nil
+	}
+
+	return g.run(s.config.Workers, s.remove)
+}
+
+func (s *Sweeper) remove(r Resource) error {
+	switch r.Kind {
+	case KindInstance:
+		return s.removeEc2(r.ID)
+	case KindSecurityGroup:
+		return s.removeSecurityGroup(r.ID)
+	case KindNatGateway:
+		return s.removeNatGateway(r.ID)
+	case KindEIP:
+		return s.releaseAddress(r.ID)
+	case KindInternetGateway:
+		return s.removeInternetGateway(r.ID, r.Parent)
+	case KindNetworkInterface:
+		return s.removeNetworkInterface(r.ID, r.Attachment)
+	case KindSubnet:
+		return s.removeSubnet(r.ID)
+	case KindRouteTable:
+		return s.removeRouteTable(r.ID)
+	case KindVPC:
+		return s.removeVpc(r.ID)
+	case KindNodeGroup:
+		return s.removeNodeGroup(r.Parent, r.ID)
+	case KindFargateProfile:
+		return s.removeFargateProfile(r.Parent, r.ID)
+	case KindCluster:
+		return s.removeCluster(r.ID)
+	case KindIAMRole:
+		return s.removeRole(r.ID)
+	case KindIAMPolicy:
+		return s.removePolicy(r.ID)
+	case KindOIDCProvider:
+		return s.removeOpenIDConnectProvider(r.ID)
+	case KindLogGroup:
+		return s.removeLogGroup(r.ID)
+	case KindResourceGroup:
+		return s.removeResourceGroup(r.ID)
+	case KindKeyPair:
+		return s.removeKeyPair(r.ID)
+	case KindLaunchTemplate:
+		return s.removeLaunchTemplate(r.ID)
+	case KindKMSAlias:
+		return s.removeKMSAlias(r.ID)
+	case KindKMSKey:
+		return s.removeKMSKey(r.ID)
+	}
+	return fmt.Errorf("unknown resource kind")
+}
+
+// poll calls check until it reports completion, returns an error or retries
+// are exhausted. Only the calling branch of the deletion graph is blocked.
+func (s *Sweeper) poll(description string, check func() (bool, error)) error {
+	for retry := 0; retry <= s.config.Retries; retry++ {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+		s.logf("%s - Retry: %d", description, retry)
+		time.Sleep(s.config.RetryDelay)
+	}
+	return fmt.Errorf("%s: not finished after %d retries", description, s.config.Retries)
+}
@@ -0,0 +1,322 @@
+package sweeper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi/fake"
+)
+
+// seedEnvironment creates in cloud resources of awsbi and awsks modules
+// named "ks".
+func seedEnvironment(cloud *fake.Cloud) {
+	cloud.AddVpc("vpc-1", "10.1.0.0/20")
+	cloud.AddSubnet("subnet-1", "vpc-1", "eu-central-1a", "10.1.1.0/24")
+	cloud.AddSubnet("subnet-2", "vpc-1", "eu-central-1b", "10.1.2.0/24")
+	cloud.AddSecurityGroup("sg-1", "vpc-1")
+	cloud.AddRouteTable("rtb-1", "vpc-1", "subnet-1", "subnet-2")
+	cloud.AddInternetGateway("igw-1", "vpc-1")
+	cloud.AddNatGateway("nat-1", "subnet-1", "eipalloc-1")
+	cloud.AddAddress("eipalloc-1", map[string]string{"resource_group": "ks"})
+	cloud.AddNetworkInterface("eni-1", "subnet-1", true)
+	cloud.AddNetworkInterface("eni-2", "subnet-2", false)
+	cloud.AddInstance("i-1", "subnet-2")
+	cloud.AddKeyPair("ks-kp")
+	cloud.AddKeyPair("ks-nodes-kp")
+	cloud.AddLaunchTemplate("lt-1")
+
+	const issuer = "https://oidc.eks.eu-central-1.amazonaws.com/id/0A1B2C3D"
+	cloud.AddCluster(&eks.Cluster{
+		Name:     aws.String("ks"),
+		Version:  aws.String("1.18"),
+		Identity: &eks.Identity{Oidc: &eks.OIDC{Issuer: aws.String(issuer)}},
+	})
+	cloud.AddOpenIDConnectProvider(issuer)
+	cloud.AddKMSKey("key-1", "alias/ks-eks-secrets")
+	cloud.AddNodegroup(&eks.Nodegroup{ClusterName: aws.String("ks"), NodegroupName: aws.String("ng-a")})
+	cloud.AddNodegroup(&eks.Nodegroup{ClusterName: aws.String("ks"), NodegroupName: aws.String("ng-b")})
+	cloud.AddFargateProfile(&eks.FargateProfile{ClusterName: aws.String("ks"), FargateProfileName: aws.String("fp-a")})
+	cloud.AddFargateProfile(&eks.FargateProfile{ClusterName: aws.String("ks"), FargateProfileName: aws.String("fp-b")})
+	cloud.AddRole("ks-eks-cluster-iam-role", []string{"arn:aws:iam::aws:policy/AmazonEKSClusterPolicy"}, nil)
+	cloud.AddRole("ks-eks-nodes-iam-role", []string{"arn:aws:iam::aws:policy/AmazonEKSWorkerNodePolicy"}, []string{"inline"})
+	cloud.AddRole("ks-eks-fargate-iam-role", []string{"arn:aws:iam::aws:policy/AmazonEKSFargatePodExecutionRolePolicy"}, nil)
+	cloud.AddRole("ks-cluster-autoscaler", []string{cloud.AddPolicy("ks-cluster-autoscaler", "v2")}, nil)
+	cloud.AddPolicy("other-cluster-autoscaler")
+	cloud.AddLogGroup("ks-log-group", 30)
+
+	for resourceType, ids := range map[string][]string{
+		"Instance":        {"i-1"},
+		"LaunchTemplate":  {"lt-1"},
+		"SecurityGroup":   {"sg-1"},
+		"NatGateway":      {"nat-1"},
+		"InternetGateway": {"igw-1"},
+		"Subnet":          {"subnet-1", "subnet-2"},
+		"RouteTable":      {"rtb-1"},
+		"VPC":             {"vpc-1"},
+	} {
+		for _, id := range ids {
+			cloud.AddToResourceGroup("ks-rg", resourceType, id)
+		}
+	}
+}
+
+func newFakeSweeper(t *testing.T, cloud *fake.Cloud, config Config) *Sweeper {
+	config.ModuleName = "ks"
+	config.RetryDelay = time.Millisecond
+	config.Logger = t
+	s, err := NewWithClients(config, cloud.Clients())
+	if err != nil {
+		t.Fatalf("NewWithClients() failed with: %v", err)
+	}
+	return s
+}
+
+func TestSweep(t *testing.T) {
+	cloud := fake.New()
+	cloud.NatGatewayDeletingPolls = 3
+	seedEnvironment(cloud)
+	s := newFakeSweeper(t, cloud, Config{})
+
+	if err := s.Sweep(false); err != nil {
+		t.Fatalf("Sweep() failed with: %v", err)
+	}
+
+	tests := []struct {
+		before string
+		after  string
+	}{
+		{before: "DeleteNodegroup ng-a", after: "DeleteCluster ks"},
+		{before: "DeleteNodegroup ng-b", after: "DeleteCluster ks"},
+		{before: "DeleteFargateProfile fp-a", after: "DeleteCluster ks"},
+		{before: "DeleteFargateProfile fp-b", after: "DeleteCluster ks"},
+		{before: "DeleteFargateProfile fp-a", after: "DeleteRole ks-eks-fargate-iam-role"},
+		{before: "DeleteFargateProfile fp-b", after: "DeleteSubnet subnet-1"},
+		{before: "DetachNetworkInterface eni-1", after: "DeleteNetworkInterface eni-1"},
+		{before: "DeleteNetworkInterface eni-1", after: "DeleteSubnet subnet-1"},
+		{before: "DeleteNetworkInterface eni-2", after: "DeleteSubnet subnet-2"},
+		{before: "TerminateInstances i-1", after: "DeleteSubnet subnet-2"},
+		{before: "DeleteNatGateway nat-1", after: "ReleaseAddress eipalloc-1"},
+		{before: "ReleaseAddress eipalloc-1", after: "DetachInternetGateway igw-1"},
+		{before: "DetachInternetGateway igw-1", after: "DeleteVpc vpc-1"},
+		{before: "DeleteSubnet subnet-1", after: "DeleteRouteTable rtb-1"},
+		{before: "DeleteCluster ks", after: "DeleteRole ks-eks-cluster-iam-role"},
+		{before: "DeleteNodegroup ng-a", after: "DeleteRole ks-eks-nodes-iam-role"},
+		{before: "DeleteCluster ks", after: "DeleteLogGroup ks-log-group"},
+		{before: "DeleteVpc vpc-1", after: "DeleteGroup ks-rg"},
+		{before: "DeleteNodegroup ng-b", after: "DeleteKeyPair ks-kp"},
+		{before: "DeleteNodegroup ng-a", after: "DeleteKeyPair ks-nodes-kp"},
+		{before: "DeleteNodegroup ng-b", after: "DeleteLaunchTemplate lt-1"},
+		{before: "DeleteLaunchTemplate lt-1", after: "DeleteGroup ks-rg"},
+		{before: "DeleteRole ks-cluster-autoscaler", after: "DeletePolicy ks-cluster-autoscaler"},
+		{before: "DeletePolicyVersion ks-cluster-autoscaler v2", after: "DeletePolicy ks-cluster-autoscaler"},
+		{before: "DeleteCluster ks", after: "DeleteOpenIDConnectProvider arn:aws:iam::123456789012:oidc-provider/oidc.eks.eu-central-1.amazonaws.com/id/0A1B2C3D"},
+		{before: "DeleteRole ks-cluster-autoscaler", after: "DeleteOpenIDConnectProvider arn:aws:iam::123456789012:oidc-provider/oidc.eks.eu-central-1.amazonaws.com/id/0A1B2C3D"},
+		{before: "DeleteCluster ks", after: "DeleteAlias alias/ks-eks-secrets"},
+		{before: "DeleteAlias alias/ks-eks-secrets", after: "ScheduleKeyDeletion key-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s before %s", tt.before, tt.after), func(t *testing.T) {
+			before, after := cloud.CallIndex(tt.before), cloud.CallIndex(tt.after)
+			if before < 0 || after < 0 {
+				t.Fatalf("expected both %q and %q to be called, got: %v", tt.before, tt.after, cloud.Calls())
+			}
+			if before > after {
+				t.Errorf("expected %q before %q, got: %v", tt.before, tt.after, cloud.Calls())
+			}
+		})
+	}
+	if cloud.CallIndex("DeletePolicy other-cluster-autoscaler") >= 0 {
+		t.Errorf("expected policy of another environment to be kept, got: %v", cloud.Calls())
+	}
+}
+
+func TestSweepConcurrency(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			cloud := fake.New()
+			seedEnvironment(cloud)
+			cloud.Delay = 2 * time.Millisecond
+			s := newFakeSweeper(t, cloud, Config{Workers: workers})
+
+			if err := s.Sweep(false); err != nil {
+				t.Fatalf("Sweep() failed with: %v", err)
+			}
+			got := cloud.MaxConcurrentCalls()
+			if got > workers {
+				t.Errorf("expected at most %d concurrent calls, got %d", workers, got)
+			}
+			if workers > 1 && got < 2 {
+				t.Errorf("expected independent resources to be removed concurrently, got %d concurrent calls", got)
+			}
+		})
+	}
+}
+
+func TestSweepDryRun(t *testing.T) {
+	cloud := fake.New()
+	seedEnvironment(cloud)
+	s := newFakeSweeper(t, cloud, Config{})
+
+	if err := s.Sweep(true); err != nil {
+		t.Fatalf("Sweep() failed with: %v", err)
+	}
+	if calls := cloud.Calls(); len(calls) != 0 {
+		t.Errorf("expected nothing to be removed in dry run, got: %v", calls)
+	}
+}
+
+func TestSweepNotFound(t *testing.T) {
+	cloud := fake.New()
+	s := newFakeSweeper(t, cloud, Config{})
+
+	if err := s.Sweep(false); err != nil {
+		t.Fatalf("Sweep() of empty environment failed with: %v", err)
+	}
+	if calls := cloud.Calls(); len(calls) != 0 {
+		t.Errorf("expected nothing to be removed, got: %v", calls)
+	}
+}
+
+func TestSweepKMSKeyPendingDeletion(t *testing.T) {
+	cloud := fake.New()
+	seedEnvironment(cloud)
+	if _, err := cloud.ScheduleKeyDeletion(&kms.ScheduleKeyDeletionInput{KeyId: aws.String("key-1")}); err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSweeper(t, cloud, Config{})
+
+	if err := s.Sweep(false); err != nil {
+		t.Fatalf("Sweep() failed with: %v", err)
+	}
+	if cloud.CallIndex("DeleteAlias alias/ks-eks-secrets") < 0 {
+		t.Errorf("expected alias to be removed, got: %v", cloud.Calls())
+	}
+}
+
+func TestSweepRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		retries     int
+		deleting    int
+		failures    map[string]string
+		wantErr     string
+		wantSkipped []string
+	}{
+		{
+			name:     "NAT gateway deleted asynchronously",
+			deleting: 5,
+		},
+		{
+			name:     "ENI still in use",
+			failures: map[string]string{"DeleteNetworkInterface": "InvalidNetworkInterface.InUse"},
+		},
+		{
+			name:        "NAT gateway not deleted in time",
+			retries:     2,
+			deleting:    10,
+			wantErr:     "NatGateway nat-1",
+			wantSkipped: []string{"ReleaseAddress eipalloc-1", "DeleteSubnet subnet-1", "DeleteVpc vpc-1"},
+		},
+		{
+			name:        "subnet removal failure",
+			failures:    map[string]string{"DeleteSubnet": "UnauthorizedOperation"},
+			wantErr:     "UnauthorizedOperation",
+			wantSkipped: []string{"DeleteRouteTable rtb-1", "DeleteVpc vpc-1", "DeleteGroup ks-rg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := fake.New()
+			cloud.NatGatewayDeletingPolls = tt.deleting
+			seedEnvironment(cloud)
+			for operation, code := range tt.failures {
+				cloud.FailNext(operation, code, 2)
+			}
+			s := newFakeSweeper(t, cloud, Config{Retries: tt.retries})
+
+			err := s.Sweep(false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Sweep() failed with: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			for _, call := range tt.wantSkipped {
+				if cloud.CallIndex(call) >= 0 {
+					t.Errorf("expected %q to be skipped, got: %v", call, cloud.Calls())
+				}
+			}
+		})
+	}
+}
+
+func TestGraphRunSkipsDependents(t *testing.T) {
+	plan := Plan{
+		{Kind: KindNodeGroup, ID: "ng-a", Parent: "ks"},
+		{Kind: KindCluster, ID: "ks"},
+		{Kind: KindLogGroup, ID: "ks-log-group"},
+		{Kind: KindKeyPair, ID: "ks-kp"},
+		{Kind: KindEIP, ID: "eipalloc-1"},
+	}
+
+	var mu sync.Mutex
+	var removed []string
+	err := newGraph(plan).run(2, func(r Resource) error {
+		if r.ID == "ng-a" {
+			return errors.New("boom")
+		}
+		mu.Lock()
+		removed = append(removed, r.ID)
+		mu.Unlock()
+		return nil
+	})
+
+	want := "NodeGroup ng-a (ks): boom; skipped dependent resources: Cluster ks, LogGroup ks-log-group, KeyPair ks-kp"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected error %q, got: %v", want, err)
+	}
+	if len(removed) != 1 || removed[0] != "eipalloc-1" {
+		t.Errorf("expected only independent eipalloc-1 to be removed, got: %v", removed)
+	}
+	for _, id := range removed {
+		if id == "ks" || id == "ks-log-group" || id == "ks-kp" {
+			t.Errorf("expected %s to be skipped, got removed: %v", id, removed)
+		}
+	}
+}
+
+func TestGraphRunReportsCycle(t *testing.T) {
+	defer func(kinds []Kind) { dependsOnKinds[KindNodeGroup] = kinds }(dependsOnKinds[KindNodeGroup])
+	dependsOnKinds[KindNodeGroup] = []Kind{KindCluster}
+	plan := Plan{
+		{Kind: KindNodeGroup, ID: "ng-a", Parent: "ks"},
+		{Kind: KindCluster, ID: "ks"},
+		{Kind: KindEIP, ID: "eipalloc-1"},
+	}
+
+	var removed []string
+	err := newGraph(plan).run(1, func(r Resource) error {
+		removed = append(removed, r.ID)
+		return nil
+	})
+
+	want := "resources in dependency cycle were not removed: NodeGroup ng-a (ks), Cluster ks"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+	if len(removed) != 1 || removed[0] != "eipalloc-1" {
+		t.Errorf("expected only independent eipalloc-1 to be removed, got: %v", removed)
+	}
+}
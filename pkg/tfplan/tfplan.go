@@ -0,0 +1,221 @@
+// Package tfplan summarizes terraform plans in the JSON format produced by
+// "terraform show -json <plan>".
+package tfplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Action is a summarized change of a single resource.
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionReplace Action = "replace"
+	ActionDelete  Action = "delete"
+)
+
+// RootModule groups resources defined outside of child modules.
+const RootModule = "root"
+
+// destructiveTypes are resource types whose replacement or deletion takes
+// the cluster or its nodes down, or breaks IAM roles of service accounts.
+// Deleting a managed add-on removes it from the cluster as well, replacing a
+// Fargate profile stops pods it runs.
+var destructiveTypes = map[string]bool{
+	"aws_eks_addon":                   true,
+	"aws_eks_cluster":                 true,
+	"aws_eks_fargate_profile":         true,
+	"aws_eks_node_group":              true,
+	"aws_iam_openid_connect_provider": true,
+}
+
+// Plan is the subset of terraform JSON plan used in summary.
+type Plan struct {
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// ResourceChange is a planned change of a resource instance.
+type ResourceChange struct {
+	Address       string `json:"address"`
+	ModuleAddress string `json:"module_address"`
+	Mode          string `json:"mode"`
+	Type          string `json:"type"`
+	Change        struct {
+		Actions []string `json:"actions"`
+		// After are planned attributes, nil when resource is deleted.
+		After map[string]interface{} `json:"after"`
+		// AfterUnknown marks attributes known only after apply.
+		AfterUnknown map[string]interface{} `json:"after_unknown"`
+	} `json:"change"`
+}
+
+// Action returns summarized action of change. It reports false when
+// resource is not changed.
+func (rc *ResourceChange) Action() (Action, bool) {
+	return summarizeActions(rc.Change.Actions)
+}
+
+// MissingTags are required tag keys missing on a planned resource.
+type MissingTags struct {
+	Address string
+	Keys    []string
+}
+
+// MissingTags lists managed resources supporting tags, which are planned
+// without some of required tag keys. Tags are taken from both tags and
+// tags_all attributes, the latter includes default tags of the provider.
+// Resources with tags known only after apply and deleted resources are
+// skipped.
+func (p *Plan) MissingTags(required []string) []MissingTags {
+	var missing []MissingTags
+	for _, rc := range p.ResourceChanges {
+		if rc.Mode != "" && rc.Mode != "managed" || rc.Change.After == nil {
+			continue
+		}
+		if unknown, _ := rc.Change.AfterUnknown["tags"].(bool); unknown {
+			continue
+		}
+		taggable := false
+		tags := make(map[string]bool)
+		for _, attribute := range []string{"tags", "tags_all"} {
+			value, ok := rc.Change.After[attribute]
+			if !ok {
+				continue
+			}
+			taggable = true
+			m, _ := value.(map[string]interface{})
+			for key := range m {
+				tags[key] = true
+			}
+		}
+		if !taggable {
+			continue
+		}
+		var keys []string
+		for _, key := range required {
+			if !tags[key] {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			missing = append(missing, MissingTags{Address: rc.Address, Keys: keys})
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Address < missing[j].Address })
+	return missing
+}
+
+// Change is a resource change in summary.
+type Change struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Action  Action `json:"action"`
+}
+
+// Counts are numbers of changes by action.
+type Counts struct {
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Replace int `json:"replace"`
+	Delete  int `json:"delete"`
+}
+
+// Summary is the machine readable summary of a plan.
+type Summary struct {
+	Counts Counts `json:"counts"`
+	// Modules lists changes by module name, e.g. "control_plane", resources
+	// of the root module are listed under RootModule.
+	Modules map[string][]Change `json:"modules"`
+	// Destructive lists replacements and deletions of the cluster, node
+	// groups, managed add-ons, Fargate profiles and OIDC provider.
+	Destructive []Change `json:"destructive"`
+}
+
+// Parse decodes terraform JSON plan.
+func Parse(data []byte) (*Plan, error) {
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse terraform plan: %w", err)
+	}
+	return &p, nil
+}
+
+// Summarize counts changes of managed resources. Resources without changes
+// are skipped.
+func (p *Plan) Summarize() *Summary {
+	s := &Summary{
+		Modules:     make(map[string][]Change),
+		Destructive: []Change{},
+	}
+	for _, rc := range p.ResourceChanges {
+		if rc.Mode != "" && rc.Mode != "managed" {
+			continue
+		}
+		action, ok := rc.Action()
+		if !ok {
+			continue
+		}
+		change := Change{Address: rc.Address, Type: rc.Type, Action: action}
+		switch action {
+		case ActionCreate:
+			s.Counts.Create++
+		case ActionUpdate:
+			s.Counts.Update++
+		case ActionReplace:
+			s.Counts.Replace++
+		case ActionDelete:
+			s.Counts.Delete++
+		}
+		module := moduleName(rc.ModuleAddress)
+		s.Modules[module] = append(s.Modules[module], change)
+		if destructiveTypes[rc.Type] && (action == ActionReplace || action == ActionDelete) {
+			s.Destructive = append(s.Destructive, change)
+		}
+	}
+	for _, changes := range s.Modules {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	}
+	sort.Slice(s.Destructive, func(i, j int) bool { return s.Destructive[i].Address < s.Destructive[j].Address })
+	return s
+}
+
+// String returns one line summary similar to the one printed by terraform.
+func (s *Summary) String() string {
+	return fmt.Sprintf("Plan summary: %d to create, %d to update, %d to replace, %d to delete.",
+		s.Counts.Create, s.Counts.Update, s.Counts.Replace, s.Counts.Delete)
+}
+
+// summarizeActions maps terraform actions list to Action. No-op and read
+// are reported as not changed.
+func summarizeActions(actions []string) (Action, bool) {
+	switch strings.Join(actions, ",") {
+	case "create":
+		return ActionCreate, true
+	case "update":
+		return ActionUpdate, true
+	case "delete,create", "create,delete":
+		return ActionReplace, true
+	case "delete":
+		return ActionDelete, true
+	default:
+		return "", false
+	}
+}
+
+// moduleName returns name of top level module from address like
+// "module.nodes" or "module.nodes.module.inner".
+func moduleName(address string) string {
+	if address == "" {
+		return RootModule
+	}
+	parts := strings.SplitN(address, ".", 3)
+	if len(parts) < 2 {
+		return address
+	}
+	return strings.SplitN(parts[1], "[", 2)[0]
+}
@@ -0,0 +1,182 @@
+package tfplan
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+const plan = `{
+  "format_version": "0.1",
+  "resource_changes": [
+    {
+      "address": "module.control_plane.aws_eks_cluster.eks_cluster",
+      "module_address": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_eks_cluster",
+      "change": {"actions": ["delete", "create"]}
+    },
+    {
+      "address": "module.control_plane.aws_iam_openid_connect_provider.eks_openid_connect_provider",
+      "module_address": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_iam_openid_connect_provider",
+      "change": {"actions": ["create", "delete"]}
+    },
+    {
+      "address": "module.control_plane.aws_cloudwatch_log_group.eks_log_group",
+      "module_address": "module.control_plane",
+      "mode": "managed",
+      "type": "aws_cloudwatch_log_group",
+      "change": {"actions": ["update"]}
+    },
+    {
+      "address": "module.control_plane.data.aws_eks_cluster_auth.eks_auth",
+      "module_address": "module.control_plane",
+      "mode": "data",
+      "type": "aws_eks_cluster_auth",
+      "change": {"actions": ["read"]}
+    },
+    {
+      "address": "module.nodes.aws_eks_node_group.eks_nodes[1]",
+      "module_address": "module.nodes",
+      "mode": "managed",
+      "type": "aws_eks_node_group",
+      "change": {"actions": ["delete"]}
+    },
+    {
+      "address": "module.nodes.aws_eks_node_group.eks_nodes[0]",
+      "module_address": "module.nodes",
+      "mode": "managed",
+      "type": "aws_eks_node_group",
+      "change": {"actions": ["update"]}
+    },
+    {
+      "address": "module.addons.aws_eks_addon.addon[\"vpc-cni\"]",
+      "module_address": "module.addons",
+      "mode": "managed",
+      "type": "aws_eks_addon",
+      "change": {"actions": ["delete"]}
+    },
+    {
+      "address": "module.fargate.aws_eks_fargate_profile.fargate_profile[\"system\"]",
+      "module_address": "module.fargate",
+      "mode": "managed",
+      "type": "aws_eks_fargate_profile",
+      "change": {"actions": ["delete", "create"]}
+    },
+    {
+      "address": "module.autoscaler.helm_release.cluster-autoscaler",
+      "module_address": "module.autoscaler",
+      "mode": "managed",
+      "type": "helm_release",
+      "change": {"actions": ["no-op"]}
+    },
+    {
+      "address": "aws_subnet.eks_subnet[0]",
+      "mode": "managed",
+      "type": "aws_subnet",
+      "change": {"actions": ["create"]}
+    }
+  ]
+}`
+
+func TestSummarize(t *testing.T) {
+	p, err := Parse([]byte(plan))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	want := &Summary{
+		Counts: Counts{Create: 1, Update: 2, Replace: 3, Delete: 2},
+		Modules: map[string][]Change{
+			"addons": {
+				{Address: `module.addons.aws_eks_addon.addon["vpc-cni"]`, Type: "aws_eks_addon", Action: ActionDelete},
+			},
+			"control_plane": {
+				{Address: "module.control_plane.aws_cloudwatch_log_group.eks_log_group", Type: "aws_cloudwatch_log_group", Action: ActionUpdate},
+				{Address: "module.control_plane.aws_eks_cluster.eks_cluster", Type: "aws_eks_cluster", Action: ActionReplace},
+				{Address: "module.control_plane.aws_iam_openid_connect_provider.eks_openid_connect_provider", Type: "aws_iam_openid_connect_provider", Action: ActionReplace},
+			},
+			"fargate": {
+				{Address: `module.fargate.aws_eks_fargate_profile.fargate_profile["system"]`, Type: "aws_eks_fargate_profile", Action: ActionReplace},
+			},
+			"nodes": {
+				{Address: "module.nodes.aws_eks_node_group.eks_nodes[0]", Type: "aws_eks_node_group", Action: ActionUpdate},
+				{Address: "module.nodes.aws_eks_node_group.eks_nodes[1]", Type: "aws_eks_node_group", Action: ActionDelete},
+			},
+			RootModule: {
+				{Address: "aws_subnet.eks_subnet[0]", Type: "aws_subnet", Action: ActionCreate},
+			},
+		},
+		Destructive: []Change{
+			{Address: `module.addons.aws_eks_addon.addon["vpc-cni"]`, Type: "aws_eks_addon", Action: ActionDelete},
+			{Address: "module.control_plane.aws_eks_cluster.eks_cluster", Type: "aws_eks_cluster", Action: ActionReplace},
+			{Address: "module.control_plane.aws_iam_openid_connect_provider.eks_openid_connect_provider", Type: "aws_iam_openid_connect_provider", Action: ActionReplace},
+			{Address: `module.fargate.aws_eks_fargate_profile.fargate_profile["system"]`, Type: "aws_eks_fargate_profile", Action: ActionReplace},
+			{Address: "module.nodes.aws_eks_node_group.eks_nodes[1]", Type: "aws_eks_node_group", Action: ActionDelete},
+		},
+	}
+	if diff := deep.Equal(p.Summarize(), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	p, err := Parse([]byte(`{"format_version": "0.1"}`))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	s := p.Summarize()
+	if diff := deep.Equal(s, &Summary{Modules: map[string][]Change{}, Destructive: []Change{}}); diff != nil {
+		t.Error(diff)
+	}
+	if got, want := s.String(), "Plan summary: 0 to create, 0 to update, 0 to replace, 0 to delete."; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestMissingTags(t *testing.T) {
+	p, err := Parse([]byte(`{"resource_changes": [
+  {"address": "aws_subnet.eks_subnet[0]", "mode": "managed", "type": "aws_subnet",
+   "change": {"actions": ["create"], "after": {"tags": {"owner": "data", "cost-center": "42"}}}},
+  {"address": "module.control_plane.aws_eks_cluster.eks_cluster", "mode": "managed", "type": "aws_eks_cluster",
+   "change": {"actions": ["no-op"], "after": {"tags": {"owner": "data"}, "tags_all": {"owner": "data", "cost-center": "42"}}}},
+  {"address": "module.control_plane.aws_iam_openid_connect_provider.eks_openid_connect_provider", "mode": "managed", "type": "aws_iam_openid_connect_provider",
+   "change": {"actions": ["update"], "after": {"tags": null}}},
+  {"address": "module.control_plane.aws_cloudwatch_log_group.eks_log_group", "mode": "managed", "type": "aws_cloudwatch_log_group",
+   "change": {"actions": ["create"], "after": {"tags": {"cost-center": "42"}}}},
+  {"address": "module.nodes.aws_iam_role_policy_attachment.AmazonEKS_CNI_Policy", "mode": "managed", "type": "aws_iam_role_policy_attachment",
+   "change": {"actions": ["create"], "after": {"role": "ks-eks-nodes-iam-role"}}},
+  {"address": "module.nodes.aws_key_pair.eks_nodes[0]", "mode": "managed", "type": "aws_key_pair",
+   "change": {"actions": ["create"], "after": {}, "after_unknown": {"tags": true}}},
+  {"address": "aws_subnet.eks_subnet[1]", "mode": "managed", "type": "aws_subnet",
+   "change": {"actions": ["delete"], "after": null}},
+  {"address": "data.aws_vpc.vpc", "mode": "data", "type": "aws_vpc",
+   "change": {"actions": ["read"], "after": {"tags": {}}}}
+]}`))
+	if err != nil {
+		t.Fatalf("Parse() failed with: %v", err)
+	}
+	want := []MissingTags{
+		{Address: "module.control_plane.aws_cloudwatch_log_group.eks_log_group", Keys: []string{"owner"}},
+		{Address: "module.control_plane.aws_iam_openid_connect_provider.eks_openid_connect_provider", Keys: []string{"owner", "cost-center"}},
+	}
+	if diff := deep.Equal(p.MissingTags([]string{"owner", "cost-center"}), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestModuleName(t *testing.T) {
+	tests := map[string]string{
+		"":                          RootModule,
+		"module.nodes":              "nodes",
+		"module.nodes.module.inner": "nodes",
+		`module.addons["vpc-cni"]`:  "addons",
+		"module.control_plane[0]":   "control_plane",
+	}
+	for address, want := range tests {
+		if got := moduleName(address); got != want {
+			t.Errorf("moduleName(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package tfstate reads resources from terraform state file (format version
+// 4, used since terraform 0.12).
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// State is a terraform state file.
+type State struct {
+	Version   int        `json:"version"`
+	Resources []Resource `json:"resources"`
+}
+
+// Resource is a single resource block, with one instance per count or
+// for_each key.
+type Resource struct {
+	Module    string     `json:"module"`
+	Mode      string     `json:"mode"`
+	Type      string     `json:"type"`
+	Name      string     `json:"name"`
+	Instances []Instance `json:"instances"`
+}
+
+// Instance is a single instance of resource.
+type Instance struct {
+	IndexKey   interface{}            `json:"index_key"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Load reads terraform state file.
+func Load(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes terraform state.
+func Parse(data []byte) (*State, error) {
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("cannot parse terraform state: %w", err)
+	}
+	if s.Version != 4 {
+		return nil, fmt.Errorf("unsupported terraform state version %d", s.Version)
+	}
+	return &s, nil
+}
+
+// HasModule reports whether state has resources of module with address like
+// "module.autoscaler", including resources of its child modules.
+func (s *State) HasModule(address string) bool {
+	for _, r := range s.Resources {
+		if r.Module == address || strings.HasPrefix(r.Module, address+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Instances returns all instances of managed resources of given type.
+func (s *State) Instances(resourceType string) []Instance {
+	var result []Instance
+	for _, r := range s.Resources {
+		if r.Mode == "managed" && r.Type == resourceType {
+			result = append(result, r.Instances...)
+		}
+	}
+	return result
+}
+
+// Instance returns the first instance of managed resource of given type, or
+// nil when there is none.
+func (s *State) Instance(resourceType string) *Instance {
+	instances := s.Instances(resourceType)
+	if len(instances) == 0 {
+		return nil
+	}
+	return &instances[0]
+}
+
+// String returns attribute found under dot separated path, e.g.
+// "identity.0.oidc.0.issuer". Numbers and booleans are formatted, missing
+// attributes result in empty string.
+func (i *Instance) String(path string) string {
+	v := i.Value(path)
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%g", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Value returns attribute found under dot separated path or nil.
+func (i *Instance) Value(path string) interface{} {
+	var v interface{} = i.Attributes
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(key, "%d", &index); err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			v = node[index]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// Strings returns list attribute as strings.
+func (i *Instance) Strings(path string) []string {
+	list, _ := i.Value(path).([]interface{})
+	var result []string
+	for _, v := range list {
+		result = append(result, fmt.Sprintf("%v", v))
+	}
+	return result
+}
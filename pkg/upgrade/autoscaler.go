@@ -0,0 +1,33 @@
+package upgrade
+
+import (
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/helm"
+)
+
+// Autoscaler changes image of the cluster autoscaler.
+type Autoscaler interface {
+	SetImageTag(kubeconfig string, release Release, tag string) error
+}
+
+// Release identifies the helm release of cluster autoscaler.
+type Release struct {
+	Name      string
+	Namespace string
+	Chart     string
+	Version   string
+}
+
+// ExecAutoscaler retags cluster autoscaler using helm binary. Other values
+// of the release are kept.
+type ExecAutoscaler struct{}
+
+func (ExecAutoscaler) SetImageTag(kubeconfig string, release Release, tag string) error {
+	_, err := helm.Run(kubeconfig, "upgrade", release.Name, release.Chart,
+		"--namespace", release.Namespace,
+		"--version", release.Version,
+		"--reuse-values",
+		"--set", "image.tag="+tag,
+		"--wait",
+	)
+	return err
+}
@@ -0,0 +1,297 @@
+// Package upgrade moves an EKS cluster to a newer Kubernetes version one
+// minor version at a time. For every minor version the control plane is
+// updated first, then every node group and finally the cluster autoscaler
+// image is retagged.
+//
+// Steps are recorded in state.Upgrade and saved after every finished step.
+// Every step first checks the current version, so running an interrupted
+// upgrade again resumes it without repeating finished updates.
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/config"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+)
+
+// Actions of upgrade steps.
+const (
+	ActionControlPlane = "control-plane"
+	ActionNodegroup    = "nodegroup"
+	ActionAutoscaler   = "autoscaler"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	defaultTimeout      = 60 * time.Minute
+)
+
+// Config describes upgraded cluster.
+type Config struct {
+	ClusterName string
+	// Kubeconfig is the content of kubeconfig used to retag autoscaler.
+	Kubeconfig string
+	// Release is the autoscaler helm release.
+	Release Release
+	// PollInterval and Timeout control waiting for a single update. Zero
+	// values mean defaults.
+	PollInterval time.Duration
+	Timeout      time.Duration
+	// Out receives progress messages.
+	Out io.Writer
+}
+
+// Upgrader runs upgrade steps.
+type Upgrader struct {
+	config     Config
+	eks        awsapi.EKSAPI
+	autoscaler Autoscaler
+}
+
+// New creates Upgrader using provided EKS client and autoscaler.
+func New(config Config, eks awsapi.EKSAPI, autoscaler Autoscaler) *Upgrader {
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.Out == nil {
+		config.Out = ioutil.Discard
+	}
+	return &Upgrader{config: config, eks: eks, autoscaler: autoscaler}
+}
+
+// ClusterVersion returns current Kubernetes version of the control plane.
+func (u *Upgrader) ClusterVersion() (string, error) {
+	out, err := u.eks.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(u.config.ClusterName)})
+	if err != nil {
+		return "", fmt.Errorf("cannot describe cluster %s: %w", u.config.ClusterName, err)
+	}
+	return aws.StringValue(out.Cluster.Version), nil
+}
+
+// NewPlan returns steps upgrading cluster from one version to another.
+// Autoscaler image of intermediate versions is the default one, for the
+// target version autoscalerVersion is used when set. Autoscaler steps are
+// left out when autoscaler is false, e.g. in clusters running only on
+// Fargate.
+func NewPlan(from, to string, nodegroups []string, autoscaler bool, autoscalerVersion *string) (*state.Upgrade, error) {
+	if config.CompareVersions(from, to) >= 0 {
+		return nil, fmt.Errorf("cannot upgrade from %s to %s, only upgrades to newer versions are supported", from, to)
+	}
+	if err := config.CheckK8sVersion(to); err != nil {
+		return nil, err
+	}
+
+	plan := &state.Upgrade{From: from, To: to}
+	for version := nextMinor(from); ; version = nextMinor(version) {
+		if err := config.CheckK8sVersion(version); err != nil {
+			return nil, fmt.Errorf("cannot upgrade from %s to %s through %s: %w", from, to, version, err)
+		}
+		tag := config.AutoscalerVersions[version]
+		if version == to && autoscalerVersion != nil {
+			tag = *autoscalerVersion
+		}
+
+		plan.Steps = append(plan.Steps, state.UpgradeStep{Action: ActionControlPlane, Version: version})
+		for _, name := range nodegroups {
+			plan.Steps = append(plan.Steps, state.UpgradeStep{Action: ActionNodegroup, Target: name, Version: version})
+		}
+		if autoscaler {
+			plan.Steps = append(plan.Steps, state.UpgradeStep{Action: ActionAutoscaler, Target: "cluster-autoscaler", Version: tag})
+		}
+		if version == to {
+			return plan, nil
+		}
+	}
+}
+
+// Run runs steps of plan which are not done yet. save is called after every
+// finished step.
+func (u *Upgrader) Run(plan *state.Upgrade, save func() error) error {
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if step.Done {
+			continue
+		}
+		var err error
+		switch step.Action {
+		case ActionControlPlane:
+			err = u.upgradeControlPlane(step.Version)
+		case ActionNodegroup:
+			err = u.upgradeNodegroup(step.Target, step.Version)
+		case ActionAutoscaler:
+			fmt.Fprintf(u.config.Out, "Setting autoscaler image tag to %s\n", step.Version)
+			err = u.autoscaler.SetImageTag(u.config.Kubeconfig, u.config.Release, step.Version)
+		default:
+			err = fmt.Errorf("unknown action %q", step.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", describe(*step), err)
+		}
+		step.Done = true
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Upgrader) upgradeControlPlane(version string) error {
+	name := u.config.ClusterName
+	return u.update("cluster "+name, version,
+		func() (string, string, error) {
+			out, err := u.eks.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+			if err != nil {
+				return "", "", err
+			}
+			return aws.StringValue(out.Cluster.Version), aws.StringValue(out.Cluster.Status), nil
+		},
+		func() (*eks.Update, error) {
+			out, err := u.eks.UpdateClusterVersion(&eks.UpdateClusterVersionInput{
+				Name:    aws.String(name),
+				Version: aws.String(version),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return out.Update, nil
+		},
+		func(id string) (*eks.Update, error) {
+			out, err := u.eks.DescribeUpdate(&eks.DescribeUpdateInput{
+				Name:     aws.String(name),
+				UpdateId: aws.String(id),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return out.Update, nil
+		},
+	)
+}
+
+func (u *Upgrader) upgradeNodegroup(name, version string) error {
+	in := &eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(u.config.ClusterName),
+		NodegroupName: aws.String(name),
+	}
+	return u.update("node group "+name, version,
+		func() (string, string, error) {
+			out, err := u.eks.DescribeNodegroup(in)
+			if err != nil {
+				return "", "", err
+			}
+			return aws.StringValue(out.Nodegroup.Version), aws.StringValue(out.Nodegroup.Status), nil
+		},
+		func() (*eks.Update, error) {
+			out, err := u.eks.UpdateNodegroupVersion(&eks.UpdateNodegroupVersionInput{
+				ClusterName:   aws.String(u.config.ClusterName),
+				NodegroupName: aws.String(name),
+				Version:       aws.String(version),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return out.Update, nil
+		},
+		func(id string) (*eks.Update, error) {
+			out, err := u.eks.DescribeUpdate(&eks.DescribeUpdateInput{
+				Name:          aws.String(u.config.ClusterName),
+				NodegroupName: aws.String(name),
+				UpdateId:      aws.String(id),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return out.Update, nil
+		},
+	)
+}
+
+// update starts update of resource to version unless it is already running
+// and waits until resource is ACTIVE in requested version. Cluster and node
+// group statuses share the same values.
+//
+// Update is started at most once and then followed by its id. Resource can
+// still be reported ACTIVE in the old version shortly after the update call,
+// starting it again would fail with ResourceInUseException. A failed update
+// leaves the resource ACTIVE in the old version as well, so it is detected
+// only by the status of the update.
+func (u *Upgrader) update(resource, version string, describe func() (string, string, error), start func() (*eks.Update, error), describeUpdate func(id string) (*eks.Update, error)) error {
+	deadline := time.Now().Add(u.config.Timeout)
+	updateID := ""
+	for {
+		if updateID != "" {
+			update, err := describeUpdate(updateID)
+			if err != nil {
+				return fmt.Errorf("cannot describe update %s of %s: %w", updateID, resource, err)
+			}
+			if status := aws.StringValue(update.Status); status == eks.UpdateStatusFailed || status == eks.UpdateStatusCancelled {
+				return fmt.Errorf("update %s of %s is %s: %s", updateID, resource, status, updateErrors(update.Errors))
+			}
+		}
+		current, status, err := describe()
+		if err != nil {
+			return err
+		}
+		switch {
+		case status == eks.ClusterStatusActive && config.CompareVersions(current, version) >= 0:
+			fmt.Fprintf(u.config.Out, "%s is ACTIVE in version %s\n", resource, current)
+			return nil
+		case status == eks.ClusterStatusActive && updateID == "":
+			fmt.Fprintf(u.config.Out, "Updating %s from %s to %s\n", resource, current, version)
+			update, err := start()
+			if err != nil {
+				return err
+			}
+			updateID = aws.StringValue(update.Id)
+			continue
+		case status == eks.ClusterStatusActive:
+			// Update was accepted but is not reported as UPDATING yet.
+		case status != eks.ClusterStatusUpdating:
+			return fmt.Errorf("%s is %s", resource, status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %s to become ACTIVE", resource)
+		}
+		time.Sleep(u.config.PollInterval)
+	}
+}
+
+// updateErrors formats errors of failed update as "code: message" list.
+func updateErrors(details []*eks.ErrorDetail) string {
+	if len(details) == 0 {
+		return "no error details"
+	}
+	messages := make([]string, 0, len(details))
+	for _, d := range details {
+		messages = append(messages, fmt.Sprintf("%s: %s", aws.StringValue(d.ErrorCode), aws.StringValue(d.ErrorMessage)))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// describe returns step as "action [target] version".
+func describe(step state.UpgradeStep) string {
+	if step.Target == "" {
+		return step.Action + " " + step.Version
+	}
+	return step.Action + " " + step.Target + " " + step.Version
+}
+
+// nextMinor returns version with minor part incremented, e.g. "1.19" for
+// "1.18".
+func nextMinor(version string) string {
+	parts := strings.SplitN(version, ".", 2)
+	minor, _ := strconv.Atoi(parts[len(parts)-1])
+	return fmt.Sprintf("%s.%d", parts[0], minor+1)
+}
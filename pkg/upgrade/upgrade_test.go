@@ -0,0 +1,323 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/awsapi/fake"
+	"github.com/epiphany-platform/m-aws-kubernetes-service/pkg/state"
+	"github.com/go-test/deep"
+)
+
+// fakeAutoscaler records image tags together with the number of EKS calls
+// made before, so order of autoscaler and EKS updates can be checked.
+type fakeAutoscaler struct {
+	cloud *fake.Cloud
+	tags  []string
+	fail  error
+}
+
+func (a *fakeAutoscaler) SetImageTag(kubeconfig string, release Release, tag string) error {
+	if a.fail != nil {
+		err := a.fail
+		a.fail = nil
+		return err
+	}
+	a.tags = append(a.tags, fmt.Sprintf("%s after %d calls", tag, len(a.cloud.Calls())))
+	return nil
+}
+
+func newCloud(version string, nodegroups ...string) *fake.Cloud {
+	cloud := fake.New()
+	cloud.UpdatingPolls = 2
+	cloud.AddCluster(&eks.Cluster{Name: aws.String("ks"), Version: aws.String(version)})
+	for _, name := range nodegroups {
+		cloud.AddNodegroup(&eks.Nodegroup{ClusterName: aws.String("ks"), NodegroupName: aws.String(name)})
+	}
+	return cloud
+}
+
+func newUpgrader(cloud *fake.Cloud, autoscaler Autoscaler) *Upgrader {
+	return New(Config{ClusterName: "ks", PollInterval: time.Millisecond, Timeout: time.Second}, cloud, autoscaler)
+}
+
+func TestNewPlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		nodegroups []string
+		// noAutoscaler plans upgrade of cluster without autoscaler.
+		noAutoscaler bool
+		autoscaler   *string
+		want         *state.Upgrade
+		wantErr      string
+	}{
+		{
+			name: "one minor version",
+			from: "1.17",
+			to:   "1.18",
+			want: &state.Upgrade{From: "1.17", To: "1.18", Steps: []state.UpgradeStep{
+				{Action: ActionControlPlane, Version: "1.18"},
+				{Action: ActionNodegroup, Target: "a", Version: "1.18"},
+				{Action: ActionNodegroup, Target: "b", Version: "1.18"},
+				{Action: ActionAutoscaler, Target: "cluster-autoscaler", Version: "v1.18.3"},
+			}},
+		},
+		{
+			name:       "two minor versions with autoscaler version",
+			from:       "1.17",
+			to:         "1.19",
+			autoscaler: aws.String("v1.19.0"),
+			want: &state.Upgrade{From: "1.17", To: "1.19", Steps: []state.UpgradeStep{
+				{Action: ActionControlPlane, Version: "1.18"},
+				{Action: ActionNodegroup, Target: "a", Version: "1.18"},
+				{Action: ActionNodegroup, Target: "b", Version: "1.18"},
+				{Action: ActionAutoscaler, Target: "cluster-autoscaler", Version: "v1.18.3"},
+				{Action: ActionControlPlane, Version: "1.19"},
+				{Action: ActionNodegroup, Target: "a", Version: "1.19"},
+				{Action: ActionNodegroup, Target: "b", Version: "1.19"},
+				{Action: ActionAutoscaler, Target: "cluster-autoscaler", Version: "v1.19.0"},
+			}},
+		},
+		{
+			name:         "Fargate only cluster",
+			from:         "1.17",
+			to:           "1.19",
+			nodegroups:   []string{},
+			noAutoscaler: true,
+			want: &state.Upgrade{From: "1.17", To: "1.19", Steps: []state.UpgradeStep{
+				{Action: ActionControlPlane, Version: "1.18"},
+				{Action: ActionControlPlane, Version: "1.19"},
+			}},
+		},
+		{
+			name:    "downgrade",
+			from:    "1.18",
+			to:      "1.17",
+			wantErr: "cannot upgrade from 1.18 to 1.17, only upgrades to newer versions are supported",
+		},
+		{
+			name:    "same version",
+			from:    "1.18",
+			to:      "1.18",
+			wantErr: "cannot upgrade from 1.18 to 1.18, only upgrades to newer versions are supported",
+		},
+		{
+			name:    "unsupported intermediate version",
+			from:    "1.14",
+			to:      "1.16",
+			wantErr: `cannot upgrade from 1.14 to 1.16 through 1.15: unsupported version "1.15"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodegroups := tt.nodegroups
+			if nodegroups == nil {
+				nodegroups = []string{"a", "b"}
+			}
+			got, err := NewPlan(tt.from, tt.to, nodegroups, !tt.noAutoscaler, tt.autoscaler)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want prefix %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	cloud := newCloud("1.17", "a", "b")
+	autoscaler := &fakeAutoscaler{cloud: cloud}
+	plan, err := NewPlan("1.17", "1.19", []string{"a", "b"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saves := 0
+	if err := newUpgrader(cloud, autoscaler).Run(plan, func() error { saves++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{
+		"UpdateClusterVersion ks 1.18",
+		"UpdateNodegroupVersion a 1.18",
+		"UpdateNodegroupVersion b 1.18",
+		"UpdateClusterVersion ks 1.19",
+		"UpdateNodegroupVersion a 1.19",
+		"UpdateNodegroupVersion b 1.19",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(autoscaler.tags, []string{"v1.18.3 after 3 calls", "v1.19.1 after 6 calls"}); diff != nil {
+		t.Error(diff)
+	}
+	if !plan.Finished() {
+		t.Error("plan not finished")
+	}
+	if saves != len(plan.Steps) {
+		t.Errorf("saved %d times, want %d", saves, len(plan.Steps))
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	cloud := newCloud("1.17", "a")
+	autoscaler := &fakeAutoscaler{cloud: cloud, fail: errors.New("helm upgrade: timed out")}
+	plan, err := NewPlan("1.17", "1.19", []string{"a"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := newUpgrader(cloud, autoscaler)
+
+	err = u.Run(plan, func() error { return nil })
+	if err == nil || err.Error() != "autoscaler cluster-autoscaler v1.18.3: helm upgrade: timed out" {
+		t.Fatalf("error = %v", err)
+	}
+	var done []bool
+	for _, s := range plan.Steps {
+		done = append(done, s.Done)
+	}
+	if diff := deep.Equal(done, []bool{true, true, false, false, false, false}); diff != nil {
+		t.Error(diff)
+	}
+
+	if err := u.Run(plan, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		"UpdateClusterVersion ks 1.18",
+		"UpdateNodegroupVersion a 1.18",
+		"UpdateClusterVersion ks 1.19",
+		"UpdateNodegroupVersion a 1.19",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(autoscaler.tags, []string{"v1.18.3 after 2 calls", "v1.19.1 after 4 calls"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRunUpdateInProgress(t *testing.T) {
+	// Control plane update was started by an interrupted run which did not
+	// save the step.
+	cloud := newCloud("1.17", "a")
+	if _, err := cloud.UpdateClusterVersion(&eks.UpdateClusterVersionInput{Name: aws.String("ks"), Version: aws.String("1.18")}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan("1.17", "1.18", []string{"a"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newUpgrader(cloud, &fakeAutoscaler{cloud: cloud}).Run(plan, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		"UpdateClusterVersion ks 1.18",
+		"UpdateNodegroupVersion a 1.18",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRunStatusDelayed(t *testing.T) {
+	// Cluster and node group are still reported ACTIVE in the old version
+	// right after the update call.
+	cloud := newCloud("1.17", "a")
+	cloud.ActivePolls = 1
+	plan, err := NewPlan("1.17", "1.18", []string{"a"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newUpgrader(cloud, &fakeAutoscaler{cloud: cloud}).Run(plan, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		"UpdateClusterVersion ks 1.18",
+		"UpdateNodegroupVersion a 1.18",
+	}
+	if diff := deep.Equal(cloud.Calls(), wantCalls); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(cloud *fake.Cloud, u *Upgrader)
+		save    func() error
+		wantErr string
+	}{
+		{
+			name: "degraded node group",
+			prepare: func(cloud *fake.Cloud, u *Upgrader) {
+				cloud.AddNodegroup(&eks.Nodegroup{
+					ClusterName:   aws.String("ks"),
+					NodegroupName: aws.String("a"),
+					Status:        aws.String(eks.NodegroupStatusDegraded),
+				})
+			},
+			wantErr: "nodegroup a 1.18: node group a is DEGRADED",
+		},
+		{
+			name: "update rejected",
+			prepare: func(cloud *fake.Cloud, u *Upgrader) {
+				cloud.FailNext("UpdateClusterVersion", "AccessDeniedException", 1)
+			},
+			wantErr: "control-plane 1.18: AccessDeniedException: injected failure of UpdateClusterVersion",
+		},
+		{
+			name: "update failed in EKS",
+			prepare: func(cloud *fake.Cloud, u *Upgrader) {
+				cloud.FailNextUpdate("NodeCreationFailure", "Instances failed to join the kubernetes cluster")
+			},
+			wantErr: "control-plane 1.18: update update-1 of cluster ks is Failed: NodeCreationFailure: Instances failed to join the kubernetes cluster",
+		},
+		{
+			name: "timeout",
+			prepare: func(cloud *fake.Cloud, u *Upgrader) {
+				cloud.UpdatingPolls = 1000
+				u.config.Timeout = 10 * time.Millisecond
+			},
+			wantErr: "control-plane 1.18: timeout waiting for cluster ks to become ACTIVE",
+		},
+		{
+			name:    "save failed",
+			save:    func() error { return errors.New("read-only file system") },
+			wantErr: "read-only file system",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newCloud("1.17", "a")
+			u := newUpgrader(cloud, &fakeAutoscaler{cloud: cloud})
+			if tt.prepare != nil {
+				tt.prepare(cloud, u)
+			}
+			save := tt.save
+			if save == nil {
+				save = func() error { return nil }
+			}
+			plan, err := NewPlan("1.17", "1.18", []string{"a"}, true, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = u.Run(plan, save)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want prefix %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,3 +0,0 @@
-M_MODULE_SHORT := awsks
-M_CONFIG_NAME := awsks-config.yml
-M_STATE_FILE_NAME := state.yml
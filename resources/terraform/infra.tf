@@ -3,35 +3,48 @@ data "aws_vpc" "vpc" {
 }
 
 data "aws_route_table" "private_route_table" {
-  count          = var.subnet_ids != null ? 0 : 1
+  count          = var.subnet_ids == null && var.subnets.role == "private" ? 1 : 0
   route_table_id = var.private_route_table_id
 }
 
+data "aws_route_table" "public_route_table" {
+  count          = var.subnet_ids == null && var.subnets.role == "public" ? 1 : 0
+  route_table_id = var.public_route_table_id
+}
+
 data "aws_availability_zones" "available" {
   state = "available"
 }
 
 resource "aws_subnet" "eks_subnet" {
   # Subnets in at least 2 availability zones are required for EKS
-  count             = var.subnet_ids != null ? 0 : 2
-  availability_zone = data.aws_availability_zones.available.names[count.index]
-  cidr_block        = cidrsubnet(data.aws_vpc.vpc.cidr_block, 4, 15-count.index)
-  vpc_id            = data.aws_vpc.vpc.id
-  tags              = {
+  count                   = var.subnet_ids != null ? 0 : var.subnets.count
+  availability_zone       = element(local.subnet_availability_zones, count.index)
+  cidr_block              = local.subnet_cidrs[count.index]
+  vpc_id                  = data.aws_vpc.vpc.id
+  map_public_ip_on_launch = var.subnets.role == "public"
+  tags                    = merge(var.tags, {
     Name                                = "${var.name}-eks-subnet${count.index}"
     resource_group                      = var.name
     # https://docs.aws.amazon.com/eks/latest/userguide/network_reqs.html#vpc-subnet-tagging
     "kubernetes.io/cluster/${var.name}" = "shared"
-    "kubernetes.io/role/internal-elb"   = 1
-  }
+    (local.subnet_role_tag)             = 1
+  })
 }
 
 resource "aws_route_table_association" "private" {
-  count          = var.subnet_ids != null ? 0 : 2
+  count          = length(data.aws_route_table.private_route_table) > 0 ? var.subnets.count : 0
   subnet_id      = aws_subnet.eks_subnet[count.index].id
   route_table_id = data.aws_route_table.private_route_table[0].route_table_id
 }
 
+# Nodes get public IPs in public subnets, so they are routed to an internet gateway
+resource "aws_route_table_association" "public" {
+  count          = length(data.aws_route_table.public_route_table) > 0 ? var.subnets.count : 0
+  subnet_id      = aws_subnet.eks_subnet[count.index].id
+  route_table_id = data.aws_route_table.public_route_table[0].route_table_id
+}
+
 # https://docs.aws.amazon.com/eks/latest/userguide/network_reqs.html#vpc-tagging
 resource "aws_ec2_tag" "eks_vpc" {
   resource_id = data.aws_vpc.vpc.id
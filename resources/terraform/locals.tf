@@ -1,10 +1,40 @@
 locals {
   subnet_ids                  = var.subnet_ids != null ? var.subnet_ids : aws_subnet.eks_subnet[*].id
+  # Kept in sync with config.Subnets.CIDRBlocks, which checks them before plan
+  subnet_cidrs                = var.subnets.cidrs != null ? var.subnets.cidrs : [
+    for i in range(var.subnets.count) :
+    cidrsubnet(data.aws_vpc.vpc.cidr_block, var.subnets.newbits, var.subnets.netnums != null ? var.subnets.netnums[i] : pow(2, var.subnets.newbits) - 1 - i)
+  ]
+  subnet_availability_zones   = var.subnets.availability_zones != null ? var.subnets.availability_zones : data.aws_availability_zones.available.names
+  subnet_role_tag             = var.subnets.role == "public" ? "kubernetes.io/role/elb" : "kubernetes.io/role/internal-elb"
   autoscaler_version          = var.autoscaler_version != null ? var.autoscaler_version : local.autoscaler_default_versions[var.k8s_version]
+  addons                      = [
+    for addon in var.addons : merge(addon, {
+      version = addon.version != null ? addon.version : local.addon_default_versions[var.k8s_version][addon.name]
+    })
+  ]
+  # Spot and multiple instance type worker groups need autoscaler settings for mixed instances
+  mixed_instances             = length([
+    for wg in var.worker_groups : wg
+    if wg.capacity_type == "SPOT" || (wg.instance_types == null ? 0 : length(wg.instance_types)) > 1
+  ]) > 0
   autoscaler_default_versions = {
     1.16: "v1.16.7",
     1.17: "v1.17.4",
     1.18: "v1.18.3",
     1.19: "v1.19.1"
   }
+  # Kept in sync with config.AddonVersions, EKS manages add-ons since 1.18
+  addon_default_versions      = {
+    1.18: {
+      "vpc-cni":    "v1.9.1-eksbuild.1",
+      "coredns":    "v1.7.0-eksbuild.1",
+      "kube-proxy": "v1.18.8-eksbuild.1"
+    },
+    1.19: {
+      "vpc-cni":    "v1.9.1-eksbuild.1",
+      "coredns":    "v1.8.0-eksbuild.1",
+      "kube-proxy": "v1.19.6-eksbuild.2"
+    }
+  }
 }
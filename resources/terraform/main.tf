@@ -1,9 +1,17 @@
 module "control_plane" {
-  source       = "./modules/control_plane"
-  name         = var.name
-  k8s_version  = var.k8s_version
-  subnet_ids   = local.subnet_ids
-  providers    = {
+  source                  = "./modules/control_plane"
+  name                    = var.name
+  tags                    = var.tags
+  k8s_version             = var.k8s_version
+  subnet_ids              = local.subnet_ids
+  endpoint_private_access = var.endpoint_private_access
+  endpoint_public_access  = var.endpoint_public_access
+  public_access_cidrs     = var.public_access_cidrs
+  encryption              = var.encryption
+  log_types               = var.log_types
+  log_retention_days      = var.log_retention_days
+  log_kms_key_id          = var.log_kms_key_id
+  providers               = {
     aws      = aws
     tls      = tls
     template = template
@@ -11,30 +19,70 @@ module "control_plane" {
 }
 
 module "nodes" {
-  source        = "./modules/nodes"
-  name          = var.name
-  subnet_ids    = local.subnet_ids
-  worker_groups = var.worker_groups
-  depends_on    = [module.control_plane]
-  disk_size     = var.disk_size
-  ami_type      = var.ami_type
-  ec2_ssh_key   = var.ec2_ssh_key
+  source                    = "./modules/nodes"
+  name                      = var.name
+  tags                      = var.tags
+  k8s_version               = var.k8s_version
+  subnet_ids                = local.subnet_ids
+  worker_groups             = var.worker_groups
+  depends_on                = [module.control_plane]
+  disk_size                 = var.disk_size
+  ami_type                  = var.ami_type
+  ssh_key_name              = var.ssh_access.enabled ? var.ssh_access.key_name : null
+  ssh_public_key            = var.ssh_access.enabled ? var.ssh_public_key : null
+  ssh_security_group_ids    = var.ssh_access.enabled ? var.ssh_access.source_security_group_ids : null
+  cluster_endpoint          = module.control_plane.cluster_endpoint
+  cluster_ca                = module.control_plane.cluster_ca
+  cluster_security_group_id = module.control_plane.cluster_security_group_id
   
   providers     = {
     aws = aws
   }
 }
 
+module "fargate" {
+  source           = "./modules/fargate"
+  name             = var.name
+  tags             = var.tags
+  cluster_name     = module.control_plane.cluster_name
+  subnet_ids       = local.subnet_ids
+  fargate_profiles = var.fargate_profiles
+  depends_on       = [module.control_plane]
+
+  providers        = {
+    aws = aws
+  }
+}
+
+# CoreDNS add-on becomes active only when nodes or Fargate can run its pods
+module "addons" {
+  source       = "./modules/addons"
+  name         = var.name
+  tags         = var.tags
+  cluster_name = module.control_plane.cluster_name
+  addons       = local.addons
+  depends_on   = [module.nodes, module.fargate]
+
+  providers    = {
+    aws = aws
+  }
+}
+
+# Fargate-only clusters have no node groups to scale. Resources of the
+# module were moved to module.autoscaler[0] by migrate-terraform-state.
 module "autoscaler" {
   source                                      = "./modules/autoscaler"
+  count                                       = length(var.worker_groups) > 0 ? 1 : 0
   name                                        = var.name
+  tags                                        = var.tags
   region                                      = var.region
   openid_connect_arn                          = module.control_plane.openid_connect_arn
   openid_connect_url                          = module.control_plane.openid_connect_url
   autoscaler_version                          = local.autoscaler_version
   autoscaler_chart_version                    = "7.3.4"
   autoscaler_scale_down_utilization_threshold = var.autoscaler_scale_down_utilization_threshold
-  depends_on                                  = [module.control_plane, module.nodes]
+  mixed_instances                             = local.mixed_instances
+  depends_on                                  = [module.control_plane, module.nodes, module.fargate]
   
   # https://discuss.hashicorp.com/t/module-does-not-support-depends-on/11692/3
   providers                = {
@@ -0,0 +1,5 @@
+locals {
+  tags = merge(var.tags, map(
+    "resource_group", var.name
+  ))
+}
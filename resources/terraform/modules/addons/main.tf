@@ -0,0 +1,10 @@
+# EKS managed add-ons, keyed by name so that removing one does not touch others
+# https://docs.aws.amazon.com/eks/latest/userguide/eks-add-ons.html
+resource "aws_eks_addon" "addon" {
+  for_each          = { for addon in var.addons : addon.name => addon }
+  cluster_name      = var.cluster_name
+  addon_name        = each.key
+  addon_version     = each.value.version
+  resolve_conflicts = each.value.resolve_conflicts
+  tags              = local.tags
+}
@@ -0,0 +1,23 @@
+variable "name" {
+  description = "Prefix for resource names and tags"
+  type        = string
+}
+
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
+variable "cluster_name" {
+  description = "Name of EKS cluster"
+  type        = string
+}
+
+variable "addons" {
+  description = "EKS managed add-ons with versions resolved for the cluster"
+  type        = list(object({
+    name              = string
+    version           = string
+    resolve_conflicts = string
+  }))
+}
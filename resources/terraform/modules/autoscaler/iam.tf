@@ -47,6 +47,7 @@ resource "aws_iam_policy" "cluster_autoscaler" {
   name        = "${var.name}-cluster-autoscaler"
   description = "EKS cluster-autoscaler IAM policy for cluster ${var.name}"
   policy      = data.aws_iam_policy_document.cluster_autoscaler.json
+  tags        = local.tags
 }
 
 resource "aws_iam_role_policy_attachment" "cluster_autoscaler" {
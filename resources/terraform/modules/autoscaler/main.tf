@@ -43,6 +43,18 @@ resource "helm_release" "cluster-autoscaler" {
     type  = "auto"
     value = var.autoscaler_scale_down_utilization_threshold
   }
+  # Set only for mixed instances, so other clusters keep the release they were deployed with
+  dynamic "set" {
+    for_each = var.mixed_instances ? [
+      { name = "extraArgs.balance-similar-node-groups", type = "auto", value = "true" },
+      { name = "extraArgs.expander", type = "string", value = "least-waste" },
+    ] : []
+    content {
+      name  = set.value.name
+      type  = set.value.type
+      value = set.value.value
+    }
+  }
   set {
     name  = "rbac.serviceAccountAnnotations.eks\\.amazonaws\\.com/role-arn"
     type  = "string"
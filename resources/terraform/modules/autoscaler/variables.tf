@@ -3,6 +3,11 @@ variable "name" {
   type        = string
 }
 
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
 variable "region" {
   description = "Region for AWS resources"
   type        = string
@@ -36,3 +41,9 @@ variable "autoscaler_scale_down_utilization_threshold" {
   description = "Autoscaler scale down utilization threshold"
   type        = string
 }
+
+# https://github.com/kubernetes/autoscaler/blob/master/cluster-autoscaler/cloudprovider/aws/README.md#using-mixed-instances-policies-and-spot-instances
+variable "mixed_instances" {
+  description = "Whether any node group uses spot capacity or several instance types"
+  type        = bool
+}
@@ -30,3 +30,55 @@ resource "aws_iam_role_policy_attachment" "eks_iam_vpc_resource_controller_attac
   policy_arn = "arn:aws:iam::aws:policy/AmazonEKSVPCResourceController"
   role       = aws_iam_role.eks_cluster_iam_role.name
 }
+
+data "aws_caller_identity" "current" {}
+
+data "aws_partition" "current" {}
+
+# Key policy of the secrets encryption key created by the module keeps the key manageable by the account
+# and allows the cluster role to use it
+data "aws_iam_policy_document" "eks_secrets_key_policy" {
+  count = local.create_kms_key ? 1 : 0
+
+  statement {
+    sid       = "EnableAccountAdministration"
+    actions   = ["kms:*"]
+    effect    = "Allow"
+    resources = ["*"]
+
+    principals {
+      identifiers = ["arn:${data.aws_partition.current.partition}:iam::${data.aws_caller_identity.current.account_id}:root"]
+      type        = "AWS"
+    }
+  }
+
+  statement {
+    sid       = "AllowClusterRoleUse"
+    actions   = ["kms:Encrypt", "kms:Decrypt", "kms:ReEncrypt*", "kms:GenerateDataKey*", "kms:DescribeKey", "kms:CreateGrant", "kms:ListGrants"]
+    effect    = "Allow"
+    resources = ["*"]
+
+    principals {
+      identifiers = [aws_iam_role.eks_cluster_iam_role.arn]
+      type        = "AWS"
+    }
+  }
+}
+
+# Existing keys usually delegate access to IAM policies, so the cluster role gets permissions for any key
+resource "aws_iam_role_policy" "eks_secrets_encryption" {
+  count  = var.encryption.enabled ? 1 : 0
+  name   = "${var.name}-eks-secrets-encryption"
+  role   = aws_iam_role.eks_cluster_iam_role.id
+  policy = data.aws_iam_policy_document.eks_secrets_encryption[0].json
+}
+
+data "aws_iam_policy_document" "eks_secrets_encryption" {
+  count = var.encryption.enabled ? 1 : 0
+
+  statement {
+    actions   = ["kms:Encrypt", "kms:Decrypt", "kms:DescribeKey", "kms:CreateGrant", "kms:ListGrants"]
+    effect    = "Allow"
+    resources = [local.kms_key_arn]
+  }
+}
@@ -0,0 +1,15 @@
+# Envelope encryption of Kubernetes secrets
+# https://docs.aws.amazon.com/eks/latest/userguide/create-cluster.html#create-cluster-encryption
+resource "aws_kms_key" "eks_secrets" {
+  count               = local.create_kms_key ? 1 : 0
+  description         = "EKS secrets encryption key for cluster ${var.name}"
+  enable_key_rotation = true
+  policy              = data.aws_iam_policy_document.eks_secrets_key_policy[0].json
+  tags                = local.tags
+}
+
+resource "aws_kms_alias" "eks_secrets" {
+  count         = local.create_kms_key ? 1 : 0
+  name          = "alias/${var.name}-eks-secrets"
+  target_key_id = aws_kms_key.eks_secrets[0].key_id
+}
@@ -1,5 +1,9 @@
 locals {
-  tags = map(
+  tags = merge(var.tags, map(
     "resource_group", var.name
+  ))
+  create_kms_key = var.encryption.enabled && var.encryption.kms_key_arn == null
+  kms_key_arn    = !var.encryption.enabled ? null : (
+    local.create_kms_key ? aws_kms_key.eks_secrets[0].arn : var.encryption.kms_key_arn
   )
 }
@@ -5,6 +5,7 @@ resource "aws_iam_openid_connect_provider" "eks_openid_connect_provider" {
   #https://docs.aws.amazon.com/IAM/latest/UserGuide/id_roles_providers_create_oidc_verify-thumbprint.html
   thumbprint_list = [data.tls_certificate.eks_tls.certificates[0].sha1_fingerprint]
   url             = aws_eks_cluster.eks_cluster.identity[0].oidc[0].issuer
+  tags            = local.tags
 }
 
 data "tls_certificate" "eks_tls" {
@@ -20,7 +21,8 @@ data "aws_eks_cluster_auth" "eks_auth" {
 # https://registry.terraform.io/providers/hashicorp/aws/latest/docs/resources/eks_cluster#enabling-control-plane-logging
 resource "aws_cloudwatch_log_group" "eks_log_group" {
   name              = "${var.name}-log-group"
-  retention_in_days = 30
+  retention_in_days = var.log_retention_days
+  kms_key_id        = var.log_kms_key_id
   tags              = local.tags
 }
 
@@ -28,11 +30,24 @@ resource "aws_eks_cluster" "eks_cluster" {
   name                      = var.name
   version                   = var.k8s_version
   role_arn                  = aws_iam_role.eks_cluster_iam_role.arn
-  enabled_cluster_log_types = ["api", "audit"]
+  enabled_cluster_log_types = var.log_types
   tags                      = local.tags
 
   vpc_config {
-    subnet_ids = var.subnet_ids
+    subnet_ids              = var.subnet_ids
+    endpoint_private_access = var.endpoint_private_access
+    endpoint_public_access  = var.endpoint_public_access
+    public_access_cidrs     = var.public_access_cidrs
+  }
+
+  dynamic "encryption_config" {
+    for_each = var.encryption.enabled ? [local.kms_key_arn] : []
+    content {
+      resources = ["secrets"]
+      provider {
+        key_arn = encryption_config.value
+      }
+    }
   }
 
   # Ensure that IAM Role permissions and log group are created before and deleted after EKS Cluster handling.
@@ -40,6 +55,7 @@ resource "aws_eks_cluster" "eks_cluster" {
   depends_on = [
     aws_iam_role_policy_attachment.eks_iam_cluster_policy_attachment,
     aws_iam_role_policy_attachment.eks_iam_vpc_resource_controller_attachment,
+    aws_iam_role_policy.eks_secrets_encryption,
     aws_cloudwatch_log_group.eks_log_group
   ]
 }
@@ -19,12 +19,27 @@ output "cluster_ca" {
   value       = aws_eks_cluster.eks_cluster.certificate_authority.0.data
 }
 
+output "cluster_security_group_id" {
+  description = "Security group created by EKS for the cluster"
+  value       = aws_eks_cluster.eks_cluster.vpc_config[0].cluster_security_group_id
+}
+
 output "kubeconfig" {
   description = "Kubeconfig as generated from template"
   value       = data.template_file.kubeconfig.rendered
   sensitive   = true
 }
 
+output "kubeconfig_private_only" {
+  description = "Whether cluster endpoint in kubeconfig is reachable only from inside the VPC"
+  value       = !aws_eks_cluster.eks_cluster.vpc_config[0].endpoint_public_access
+}
+
+output "kms_key_arn" {
+  description = "KMS key encrypting Kubernetes secrets, null without encryption"
+  value       = local.kms_key_arn
+}
+
 output "openid_connect_url" {
   description = "OpenId connect provider url"
   value       = aws_iam_openid_connect_provider.eks_openid_connect_provider.url
@@ -3,6 +3,11 @@ variable "name" {
   type        = string
 }
 
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
 variable "subnet_ids" {
   description = "Subnet ids to join to"
   type = list(string)
@@ -12,3 +17,41 @@ variable "k8s_version" {
   description = "Kubernetes version to install"
   type        = string
 }
+
+variable "endpoint_private_access" {
+  description = "Whether the EKS private API server endpoint is enabled"
+  type        = bool
+}
+
+variable "endpoint_public_access" {
+  description = "Whether the EKS public API server endpoint is enabled"
+  type        = bool
+}
+
+variable "public_access_cidrs" {
+  description = "CIDR blocks which can access the EKS public API server endpoint, null for 0.0.0.0/0"
+  type        = list(string)
+}
+
+variable "encryption" {
+  description = "Envelope encryption of Kubernetes secrets, KMS key is created when kms_key_arn is null"
+  type        = object({
+    enabled     = bool
+    kms_key_arn = string
+  })
+}
+
+variable "log_types" {
+  description = "Control plane log types sent to CloudWatch"
+  type        = list(string)
+}
+
+variable "log_retention_days" {
+  description = "Retention of control plane log group in days, 0 to keep logs forever"
+  type        = number
+}
+
+variable "log_kms_key_id" {
+  description = "ARN of KMS key encrypting control plane log group, null for CloudWatch default encryption"
+  type        = string
+}
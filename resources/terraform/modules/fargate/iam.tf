@@ -0,0 +1,27 @@
+# https://docs.aws.amazon.com/eks/latest/userguide/pod-execution-role.html
+
+resource "aws_iam_role" "fargate_pod_execution_role" {
+  count              = length(var.fargate_profiles) > 0 ? 1 : 0
+  assume_role_policy = data.aws_iam_policy_document.fargate_assume_role_policy.json
+  name               = "${var.name}-eks-fargate-iam-role"
+  description        = "EKS Fargate pod execution IAM role for cluster ${var.name}"
+  tags               = local.tags
+}
+
+data "aws_iam_policy_document" "fargate_assume_role_policy" {
+  statement {
+    actions = ["sts:AssumeRole"]
+    effect  = "Allow"
+
+    principals {
+      identifiers = ["eks-fargate-pods.amazonaws.com"]
+      type        = "Service"
+    }
+  }
+}
+
+resource "aws_iam_role_policy_attachment" "AmazonEKSFargatePodExecutionRolePolicy" {
+  count      = length(var.fargate_profiles) > 0 ? 1 : 0
+  policy_arn = "arn:aws:iam::aws:policy/AmazonEKSFargatePodExecutionRolePolicy"
+  role       = aws_iam_role.fargate_pod_execution_role[0].name
+}
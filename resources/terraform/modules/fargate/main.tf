@@ -0,0 +1,20 @@
+# Profiles are keyed by name, as EKS cannot update a profile and every change
+# replaces it
+resource "aws_eks_fargate_profile" "fargate_profile" {
+  for_each               = { for profile in var.fargate_profiles : profile.name => profile }
+  cluster_name           = var.cluster_name
+  fargate_profile_name   = each.key
+  pod_execution_role_arn = aws_iam_role.fargate_pod_execution_role[0].arn
+  subnet_ids             = each.value.subnet_ids != null ? each.value.subnet_ids : var.subnet_ids
+  tags                   = local.tags
+
+  dynamic "selector" {
+    for_each = each.value.selectors
+    content {
+      namespace = selector.value.namespace
+      labels    = selector.value.labels
+    }
+  }
+
+  depends_on = [aws_iam_role_policy_attachment.AmazonEKSFargatePodExecutionRolePolicy]
+}
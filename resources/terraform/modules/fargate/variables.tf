@@ -0,0 +1,31 @@
+variable "name" {
+  description = "Prefix for resource names and tags"
+  type        = string
+}
+
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
+variable "cluster_name" {
+  description = "Name of EKS cluster"
+  type        = string
+}
+
+variable "subnet_ids" {
+  description = "Subnets of the cluster used by profiles without own subnets"
+  type        = list(string)
+}
+
+variable "fargate_profiles" {
+  description = "Fargate profiles definition list"
+  type        = list(object({
+    name       = string
+    selectors  = list(object({
+      namespace = string
+      labels    = map(string)
+    }))
+    subnet_ids = list(string)
+  }))
+}
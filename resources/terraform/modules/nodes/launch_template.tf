@@ -0,0 +1,60 @@
+# https://docs.aws.amazon.com/eks/latest/userguide/launch-templates.html
+
+data "aws_ssm_parameter" "eks_ami" {
+  for_each = local.custom_ami_groups
+  name     = "/aws/service/eks/optimized-ami/${var.k8s_version}/${local.ami_ssm_names[each.value.ami_type == null ? var.ami_type : each.value.ami_type]}/recommended/image_id"
+}
+
+resource "aws_launch_template" "eks_nodes" {
+  for_each    = local.launch_template_groups
+  name_prefix = "${var.name}-${each.key}-"
+  description = "EKS node group ${each.key} launch template for cluster ${var.name}"
+  image_id    = contains(keys(local.custom_ami_groups), each.key) ? data.aws_ssm_parameter.eks_ami[each.key].value : null
+  key_name    = local.ssh_key_name
+
+  # EKS does not add the cluster security group when launch template sets security groups
+  vpc_security_group_ids = each.value.launch_template.security_group_ids == null ? null : concat(
+    [var.cluster_security_group_id],
+    each.value.launch_template.security_group_ids
+  )
+
+  # Without custom AMI EKS merges user data with its own bootstrap, which requires MIME multipart format
+  user_data = each.value.launch_template.bootstrap_args != null ? base64encode(templatefile("${path.module}/templates/bootstrap.tpl", {
+    user_data        = each.value.launch_template.user_data == null ? "" : each.value.launch_template.user_data
+    cluster_name     = var.name
+    cluster_ca       = var.cluster_ca
+    cluster_endpoint = var.cluster_endpoint
+    bootstrap_args   = each.value.launch_template.bootstrap_args
+  })) : each.value.launch_template.user_data == null ? null : base64encode(templatefile("${path.module}/templates/user-data.tpl", {
+    user_data = each.value.launch_template.user_data
+  }))
+
+  # Disk size of node group cannot be used together with launch template
+  block_device_mappings {
+    device_name = "/dev/xvda"
+    ebs {
+      volume_size           = each.value.disk_size == null ? var.disk_size : each.value.disk_size
+      volume_type           = "gp2"
+      encrypted             = each.value.launch_template.ebs_encrypted
+      kms_key_id            = each.value.launch_template.ebs_kms_key_id
+      delete_on_termination = true
+    }
+  }
+
+  metadata_options {
+    http_endpoint               = "enabled"
+    http_tokens                 = each.value.launch_template.metadata_http_tokens == null ? "optional" : each.value.launch_template.metadata_http_tokens
+    http_put_response_hop_limit = each.value.launch_template.metadata_http_put_response_hop_limit == null ? 1 : each.value.launch_template.metadata_http_put_response_hop_limit
+  }
+
+  tag_specifications {
+    resource_type = "instance"
+    tags          = merge(var.tags, each.value.tags == null ? {} : each.value.tags, local.module_tags)
+  }
+
+  tags = local.tags
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
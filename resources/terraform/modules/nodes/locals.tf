@@ -1,12 +1,33 @@
 locals {
-  tags = map(
+  # Tags set by the module take precedence over tags of config file
+  module_tags = map(
     "resource_group", var.name
   )
+  tags = merge(var.tags, local.module_tags)
   eks_node_tags = merge(
-    local.tags,
+    local.module_tags,
     map(
       "k8s.io/cluster-autoscaler/enabled", "true",
       "k8s.io/cluster-autoscaler/${var.name}", "true"
     )
   )
+  ssh_key_name = var.ssh_public_key == null ? var.ssh_key_name : aws_key_pair.eks_nodes[0].key_name
+  node_group_names = [
+    for i, wg in var.worker_groups : wg.name == null ? "${var.name}-node-group${i}" : wg.name
+  ]
+  # Worker groups with launch template by node group name
+  launch_template_groups = {
+    for i, wg in var.worker_groups : local.node_group_names[i] => wg if wg.launch_template != null
+  }
+  # Worker groups with bootstrap_args run EKS optimized AMI selected by the module, as bootstrap
+  # arguments can be passed only when launch template specifies the image
+  # https://docs.aws.amazon.com/eks/latest/userguide/launch-templates.html#launch-template-custom-ami
+  custom_ami_groups = {
+    for name, wg in local.launch_template_groups : name => wg if wg.launch_template.bootstrap_args != null
+  }
+  ami_ssm_names = {
+    AL2_x86_64     = "amazon-linux-2"
+    AL2_x86_64_GPU = "amazon-linux-2-gpu"
+    AL2_ARM_64     = "amazon-linux-2-arm64"
+  }
 }
@@ -1,21 +1,50 @@
 resource "aws_eks_node_group" "eks_nodes" {
   count           = length(var.worker_groups)
   cluster_name    = var.name
-  node_group_name = var.worker_groups[count.index].name == null ? "${var.name}-node-group${count.index}" : var.worker_groups[count.index].name
+  node_group_name = local.node_group_names[count.index]
   node_role_arn   = aws_iam_role.eks_nodes_iam_role.arn
   subnet_ids      = var.subnet_ids
-  instance_types  = [var.worker_groups[count.index].instance_type]
-  disk_size       = var.disk_size
-  ami_type        = var.ami_type
+  instance_types  = var.worker_groups[count.index].instance_types == null ? [var.worker_groups[count.index].instance_type] : var.worker_groups[count.index].instance_types
+  capacity_type   = var.worker_groups[count.index].capacity_type
+  labels          = var.worker_groups[count.index].labels
 
-  remote_access {
-    ec2_ssh_key  = var.ec2_ssh_key
+  # Disk size, remote access and, with custom AMI, AMI type are set in launch template
+  disk_size = var.worker_groups[count.index].launch_template != null ? null : (
+    var.worker_groups[count.index].disk_size == null ? var.disk_size : var.worker_groups[count.index].disk_size
+  )
+  ami_type = contains(keys(local.custom_ami_groups), local.node_group_names[count.index]) ? null : (
+    var.worker_groups[count.index].ami_type == null ? var.ami_type : var.worker_groups[count.index].ami_type
+  )
+
+  dynamic "remote_access" {
+    for_each = var.worker_groups[count.index].launch_template == null && local.ssh_key_name != null ? [local.ssh_key_name] : []
+    content {
+      ec2_ssh_key               = remote_access.value
+      source_security_group_ids = var.ssh_security_group_ids
+    }
+  }
+
+  dynamic "launch_template" {
+    for_each = var.worker_groups[count.index].launch_template == null ? [] : [aws_launch_template.eks_nodes[local.node_group_names[count.index]]]
+    content {
+      id      = launch_template.value.id
+      version = launch_template.value.latest_version
+    }
+  }
+
+  dynamic "taint" {
+    for_each = var.worker_groups[count.index].taints == null ? [] : var.worker_groups[count.index].taints
+    content {
+      key    = taint.value.key
+      value  = taint.value.value
+      effect = taint.value.effect
+    }
   }
 
   scaling_config {
     desired_size = var.worker_groups[count.index].asg_desired_capacity
-    max_size     = var.worker_groups[count.index].asg_min_size
-    min_size     = var.worker_groups[count.index].asg_max_size
+    max_size     = var.worker_groups[count.index].asg_max_size
+    min_size     = var.worker_groups[count.index].asg_min_size
   }
 
   # Ensure that IAM Role permissions are created before and deleted after EKS Node Group handling.
@@ -33,5 +62,9 @@ resource "aws_eks_node_group" "eks_nodes" {
 
   # Add necessary tags for cluster autoscaler
   # https://docs.aws.amazon.com/eks/latest/userguide/cluster-autoscaler.html#ca-ng-considerations
-  tags = local.eks_node_tags
+  tags = merge(
+    var.tags,
+    var.worker_groups[count.index].tags == null ? {} : var.worker_groups[count.index].tags,
+    local.eks_node_tags
+  )
 }
@@ -0,0 +1,7 @@
+# Key pair imported from public key file, e.g. the key of virtual machines created by AWS Basic Infrastructure module
+resource "aws_key_pair" "eks_nodes" {
+  count      = var.ssh_public_key == null ? 0 : 1
+  key_name   = "${var.name}-nodes-kp"
+  public_key = var.ssh_public_key
+  tags       = local.tags
+}
@@ -0,0 +1,4 @@
+#!/bin/bash
+set -e
+${user_data}
+/etc/eks/bootstrap.sh ${cluster_name} --b64-cluster-ca '${cluster_ca}' --apiserver-endpoint '${cluster_endpoint}' ${bootstrap_args}
@@ -3,14 +3,39 @@ variable "name" {
   type        = string
 }
 
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
 variable "worker_groups" {
   description = "Worker groups definition list"
   type        = list(object({
     name                 = string
     instance_type        = string
+    instance_types       = list(string)
+    capacity_type        = string
     asg_desired_capacity = number
     asg_min_size         = number
     asg_max_size         = number
+    disk_size            = number
+    ami_type             = string
+    labels               = map(string)
+    taints               = list(object({
+      key    = string
+      value  = string
+      effect = string
+    }))
+    tags                 = map(string)
+    launch_template      = object({
+      user_data                            = string
+      bootstrap_args                       = string
+      metadata_http_tokens                 = string
+      metadata_http_put_response_hop_limit = number
+      ebs_encrypted                        = bool
+      ebs_kms_key_id                       = string
+      security_group_ids                   = list(string)
+    })
   }))
 }
 
@@ -20,16 +45,46 @@ variable "subnet_ids" {
 }
 
 variable "disk_size" {
-  description = "Disk size"
+  description = "Disk size used by worker groups without own disk_size"
   type        = number
 }
 
 variable "ami_type" {
-  description = "Type of Amazon Machine Image (AMI) associated with the EKS Node Group"
+  description = "Type of Amazon Machine Image (AMI) used by worker groups without own ami_type"
+  type        = string
+}
+
+variable "ssh_key_name" {
+  description = "Existing EC2 Key Pair name that provides SSH access to the worker nodes, null without SSH access"
+  type        = string
+}
+
+variable "ssh_public_key" {
+  description = "Public key imported as EC2 Key Pair that provides SSH access to the worker nodes, used instead of ssh_key_name"
+  type        = string
+}
+
+variable "ssh_security_group_ids" {
+  description = "Security groups allowed to connect to the worker nodes with SSH, null to allow connections from anywhere"
+  type        = list(string)
+}
+
+variable "k8s_version" {
+  description = "Kubernetes version used to select EKS optimized AMI of worker groups with bootstrap_args"
+  type        = string
+}
+
+variable "cluster_endpoint" {
+  description = "Cluster endpoint passed to bootstrap script"
+  type        = string
+}
+
+variable "cluster_ca" {
+  description = "Cluster CA data passed to bootstrap script"
   type        = string
 }
 
-variable "ec2_ssh_key" {
-  description = "EC2 Key Pair name that provides access for SSH communication with the worker nodes in the EKS Node Group"
+variable "cluster_security_group_id" {
+  description = "Cluster security group added to launch templates with own security groups"
   type        = string
 }
@@ -3,3 +3,13 @@ output "kubeconfig" {
   value       = module.control_plane.kubeconfig
   sensitive   = true
 }
+
+output "kubeconfig_private_only" {
+  description = "Whether cluster endpoint in kubeconfig is reachable only from inside the VPC"
+  value       = module.control_plane.kubeconfig_private_only
+}
+
+output "kms_key_arn" {
+  description = "KMS key encrypting Kubernetes secrets, null without encryption"
+  value       = module.control_plane.kms_key_arn
+}
@@ -31,9 +31,41 @@ variable "worker_groups" {
   type        = list(object({
     name                 = string
     instance_type        = string
+    instance_types       = list(string)
+    capacity_type        = string
     asg_desired_capacity = number
     asg_min_size         = number
     asg_max_size         = number
+    disk_size            = number
+    ami_type             = string
+    labels               = map(string)
+    taints               = list(object({
+      key    = string
+      value  = string
+      effect = string
+    }))
+    tags                 = map(string)
+    launch_template      = object({
+      user_data                            = string
+      bootstrap_args                       = string
+      metadata_http_tokens                 = string
+      metadata_http_put_response_hop_limit = number
+      ebs_encrypted                        = bool
+      ebs_kms_key_id                       = string
+      security_group_ids                   = list(string)
+    })
+  }))
+}
+
+variable "fargate_profiles" {
+  description = "Fargate profiles running selected pods without nodes"
+  type        = list(object({
+    name       = string
+    selectors  = list(object({
+      namespace = string
+      labels    = map(string)
+    }))
+    subnet_ids = list(string)
   }))
 }
 
@@ -47,6 +79,38 @@ variable "private_route_table_id" {
   type        = string
 }
 
+variable "public_route_table_id" {
+  description = "Public route table id for table associations of subnets with public role"
+  type        = string
+}
+
+variable "subnets" {
+  description = "Layout of subnets created when subnet_ids is null"
+  type        = object({
+    count              = number
+    availability_zones = list(string)
+    newbits            = number
+    netnums            = list(number)
+    cidrs              = list(string)
+    role               = string
+  })
+}
+
+variable "endpoint_private_access" {
+  description = "Whether the EKS private API server endpoint is enabled"
+  type        = bool
+}
+
+variable "endpoint_public_access" {
+  description = "Whether the EKS public API server endpoint is enabled"
+  type        = bool
+}
+
+variable "public_access_cidrs" {
+  description = "CIDR blocks which can access the EKS public API server endpoint, null for 0.0.0.0/0"
+  type        = list(string)
+}
+
 variable "disk_size" {
   description = "Disk size"
   type        = number
@@ -62,7 +126,55 @@ variable "ami_type" {
   type        = string
 }
 
-variable "ec2_ssh_key" {
-  description = "EC2 Key Pair name that provides access for SSH communication with the worker nodes in the EKS Node Group"
+variable "tags" {
+  description = "Tags added to every taggable resource"
+  type        = map(string)
+}
+
+variable "addons" {
+  description = "EKS managed add-ons, version null selects the default version of k8s_version"
+  type        = list(object({
+    name              = string
+    version           = string
+    resolve_conflicts = string
+  }))
+}
+
+variable "log_types" {
+  description = "Control plane log types sent to CloudWatch"
+  type        = list(string)
+}
+
+variable "log_retention_days" {
+  description = "Retention of control plane log group in days, 0 to keep logs forever"
+  type        = number
+}
+
+variable "log_kms_key_id" {
+  description = "ARN of KMS key encrypting control plane log group, null for CloudWatch default encryption"
+  type        = string
+}
+
+variable "encryption" {
+  description = "Envelope encryption of Kubernetes secrets, KMS key is created when kms_key_arn is null"
+  type        = object({
+    enabled     = bool
+    kms_key_arn = string
+  })
+}
+
+variable "ssh_access" {
+  description = "SSH access to the worker nodes in the EKS Node Groups"
+  type        = object({
+    enabled                   = bool
+    key_name                  = string
+    public_key_path           = string
+    source_security_group_ids = list(string)
+  })
+}
+
+variable "ssh_public_key" {
+  description = "Content of ssh_access.public_key_path file imported as EC2 Key Pair"
   type        = string
+  default     = null
 }
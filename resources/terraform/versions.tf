@@ -3,7 +3,7 @@ terraform {
 
   required_providers {
     aws = {
-      version = "3.21.0"
+      version = "3.63.0"
     }
 
     kubernetes = {